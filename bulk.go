@@ -0,0 +1,268 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "sync"
+
+    "github.com/pivotal-cf/app-automator-cf-client/internal"
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+    "go.opentelemetry.io/otel/attribute"
+)
+
+const defaultBulkConcurrency = 4
+
+// AppSelector chooses the apps of the space that a bulk operation acts on.
+// Names and LabelSelector, e.g. "env=staging,!critical", narrow the
+// selection together. An empty selector selects every app in the space.
+type AppSelector struct {
+    Names         []string
+    LabelSelector string
+}
+
+// AppResult is the outcome of a bulk operation for one app. Apps that were
+// selected by name but not found have an empty guid and an error. Apps
+// selected by name alone are resolved by the AppGuidCache and only have their
+// name and guid.
+type AppResult struct {
+    App models.App
+    Err error
+
+    // DryRun is the request that would have been sent for the app in dry
+    // run mode, in which case Err is nil
+    DryRun *DryRunRequest
+}
+
+// BulkReport holds one result per selected app, in the order of
+// AppSelector.Names or of the app listing if no names were given
+type BulkReport struct {
+    Results []AppResult
+}
+
+// Failed returns the results that have an error
+func (r BulkReport) Failed() []AppResult {
+    var failed []AppResult
+    for _, res := range r.Results {
+        if res.Err != nil {
+            failed = append(failed, res)
+        }
+    }
+    return failed
+}
+
+// Err returns a *BulkError if any app failed and nil otherwise
+func (r BulkReport) Err() error {
+    failed := r.Failed()
+    if len(failed) == 0 {
+        return nil
+    }
+    return &BulkError{Failed: failed, Total: len(r.Results)}
+}
+
+// BulkError is returned by bulk operations when some apps failed. It
+// unwraps to the error of every failed app.
+type BulkError struct {
+    Failed []AppResult
+    Total  int
+}
+
+func (e *BulkError) Error() string {
+    var failures []string
+    for _, res := range e.Failed {
+        failures = append(failures, fmt.Sprintf("%s: %s", res.App.Name, res.Err))
+    }
+    return fmt.Sprintf("%d of %d apps failed: %s", len(e.Failed), e.Total, strings.Join(failures, "; "))
+}
+
+func (e *BulkError) Unwrap() []error {
+    errs := make([]error, 0, len(e.Failed))
+    for _, res := range e.Failed {
+        errs = append(errs, res.Err)
+    }
+    return errs
+}
+
+// ScaleMany scales the web process of every selected app. The returned error
+// is a *BulkError if some apps failed; the report has the result of each.
+func (c *Client) ScaleMany(selector AppSelector, instanceTarget uint, opts ...models.HeaderOption) (BulkReport, error) {
+    return c.ScaleManyContext(context.Background(), selector, instanceTarget, opts...)
+}
+
+// ScaleManyContext is ScaleMany with a context
+func (c *Client) ScaleManyContext(ctx context.Context, selector AppSelector, instanceTarget uint, opts ...models.HeaderOption) (report BulkReport, err error) {
+    err = validateInstances(instanceTarget)
+    if err != nil {
+        return BulkReport{}, err
+    }
+
+    ctx, span := c.startSpan(ctx, "ScaleMany", attribute.Int("cf.instances", int(instanceTarget)))
+    defer func() { internal.EndSpan(span, err) }()
+
+    return c.forEachApp(ctx, selector, func(ctx context.Context, app models.App) error {
+        return c.capi().ScaleContext(ctx, app.Guid, defaultProcessType, instanceTarget, opts...)
+    })
+}
+
+// StopMany stops every selected app. The returned error is a *BulkError if
+// some apps failed; the report has the result of each.
+func (c *Client) StopMany(selector AppSelector, opts ...models.HeaderOption) (BulkReport, error) {
+    return c.StopManyContext(context.Background(), selector, opts...)
+}
+
+// StopManyContext is StopMany with a context
+func (c *Client) StopManyContext(ctx context.Context, selector AppSelector, opts ...models.HeaderOption) (report BulkReport, err error) {
+    ctx, span := c.startSpan(ctx, "StopMany")
+    defer func() { internal.EndSpan(span, err) }()
+
+    return c.forEachApp(ctx, selector, func(ctx context.Context, app models.App) error {
+        return c.capi().StopContext(ctx, app.Guid, opts...)
+    })
+}
+
+// ForEachApp calls fn for every selected app on a pool of BulkConcurrency
+// workers. The apps are looked up at once, from the AppGuidCache or with a
+// single listing, so fn gets their guids without further lookups. The
+// returned error is a *BulkError if fn failed for some apps; the report has
+// the result of each. A *DryRunError returned by fn is reported in
+// AppResult.DryRun rather than as a failure.
+func (c *Client) ForEachApp(selector AppSelector, fn func(app models.App) error) (BulkReport, error) {
+    return c.ForEachAppContext(context.Background(), selector, func(_ context.Context, app models.App) error {
+        return fn(app)
+    })
+}
+
+// ForEachAppContext is ForEachApp with a context, which is passed on to fn
+func (c *Client) ForEachAppContext(ctx context.Context, selector AppSelector, fn func(ctx context.Context, app models.App) error) (report BulkReport, err error) {
+    ctx, span := c.startSpan(ctx, "ForEachApp")
+    defer func() { internal.EndSpan(span, err) }()
+
+    return c.forEachApp(ctx, selector, fn)
+}
+
+func (c *Client) forEachApp(ctx context.Context, selector AppSelector, fn func(context.Context, models.App) error) (BulkReport, error) {
+    results, cached, err := c.selectApps(ctx, selector)
+    if err != nil {
+        return BulkReport{}, err
+    }
+
+    if cached {
+        // cached guids may be stale, so retry with a fresh one as the single
+        // app operations do
+        fnWithGuid := fn
+        fn = func(ctx context.Context, app models.App) error {
+            return c.tryWithRefresh(ctx, app.Name, func(appGuid string) error {
+                app.Guid = appGuid
+                return fnWithGuid(ctx, app)
+            })
+        }
+    }
+
+    workers := c.bulkConcurrency
+    if workers <= 0 {
+        workers = defaultBulkConcurrency
+    }
+
+    work := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < workers && w < len(results); w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range work {
+                results[i].Err = fn(ctx, results[i].App)
+
+                var dryRun *DryRunError
+                if errors.As(results[i].Err, &dryRun) {
+                    results[i].DryRun = &dryRun.Request
+                    results[i].Err = nil
+                }
+            }
+        }()
+    }
+
+    for i, res := range results {
+        if res.Err == nil {
+            work <- i
+        }
+    }
+    close(work)
+    wg.Wait()
+
+    report := BulkReport{Results: results}
+    return report, report.Err()
+}
+
+// selectApps looks up the selected apps, from the AppGuidCache if they are
+// selected by name alone and with one listing otherwise. It reports whether
+// the guids came from the cache. Names that are not found get a result with
+// an error so that they show up in the report.
+func (c *Client) selectApps(ctx context.Context, selector AppSelector) ([]AppResult, bool, error) {
+    if cache, ok := c.AppGuidCache.(AppGuidCacheMany); ok && len(selector.Names) > 0 && selector.LabelSelector == "" {
+        guids, err := cache.GetMany(ctx, selector.Names)
+        if err != nil {
+            return nil, false, fmt.Errorf("unable to select apps: %w", err)
+        }
+
+        byName := map[string]models.App{}
+        for name, guid := range guids {
+            byName[name] = models.App{Name: name, Guid: guid}
+        }
+        return resultsByName(selector.Names, byName), true, nil
+    }
+
+    query := map[string]string{
+        "space_guids": c.SpaceGuid,
+    }
+    if len(selector.Names) > 0 {
+        query["names"] = strings.Join(selector.Names, ",")
+    }
+    if selector.LabelSelector != "" {
+        query["label_selector"] = selector.LabelSelector
+    }
+
+    apps, err := c.capi().AppsContext(ctx, query)
+    if err != nil {
+        return nil, false, fmt.Errorf("unable to select apps: %w", err)
+    }
+
+    if len(selector.Names) == 0 {
+        results := make([]AppResult, 0, len(apps))
+        for _, app := range apps {
+            results = append(results, AppResult{App: app})
+        }
+        return results, false, nil
+    }
+
+    byName := map[string]models.App{}
+    for _, app := range apps {
+        byName[app.Name] = app
+    }
+    return resultsByName(selector.Names, byName), false, nil
+}
+
+// resultsByName returns a result for each name in order, skipping
+// duplicates
+func resultsByName(names []string, byName map[string]models.App) []AppResult {
+    var results []AppResult
+    seen := map[string]bool{}
+    for _, name := range names {
+        if seen[name] {
+            continue
+        }
+        seen[name] = true
+
+        app, ok := byName[name]
+        if !ok {
+            results = append(results, AppResult{
+                App: models.App{Name: name},
+                Err: fmt.Errorf("app '%s' not found", name),
+            })
+            continue
+        }
+        results = append(results, AppResult{App: app})
+    }
+
+    return results
+}
@@ -0,0 +1,229 @@
+package client_test
+
+import (
+    "errors"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+    "github.com/pivotal-cf/app-automator-cf-client/cftest"
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bulk operations", func() {
+    var (
+        server *cftest.Server
+        cfg    client.Config
+        apps   map[string]cftest.App
+    )
+
+    BeforeEach(func() {
+        server = cftest.NewServer()
+        apps = map[string]cftest.App{}
+        for _, a := range []cftest.App{
+            {Name: "api", Labels: map[string]string{"env": "staging", "tier": "web"}},
+            {Name: "worker", Labels: map[string]string{"env": "staging"}},
+            {Name: "billing", Labels: map[string]string{"env": "staging", "critical": "true"}},
+            {Name: "prod-api", Labels: map[string]string{"env": "production"}},
+        } {
+            apps[a.Name] = server.AddApp(a)
+        }
+        server.AddApp(cftest.App{Name: "elsewhere", SpaceGuid: "other-space"})
+
+        cfg = server.Config()
+    })
+
+    AfterEach(func() {
+        server.Close()
+    })
+
+    instances := func(name string) int {
+        p, ok := server.Process(apps[name].Guid, "web")
+        Expect(ok).To(BeTrue())
+        return p.Instances
+    }
+
+    appRequests := func() int {
+        var n int
+        for _, r := range server.Requests() {
+            if r.Method == http.MethodGet && r.Path == "/v3/apps" {
+                n++
+            }
+        }
+        return n
+    }
+
+    Describe("ScaleMany()", func() {
+        It("scales the apps matching the label selector", func() {
+            c := client.New(cfg)
+
+            report, err := c.ScaleMany(client.AppSelector{LabelSelector: "env=staging,!critical"}, 0)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(report.Results).To(HaveLen(2))
+            Expect(report.Failed()).To(BeEmpty())
+
+            Expect(instances("api")).To(Equal(0))
+            Expect(instances("worker")).To(Equal(0))
+            Expect(instances("billing")).To(Equal(1))
+            Expect(instances("prod-api")).To(Equal(1))
+        })
+
+        It("looks the apps up with a single request", func() {
+            c := client.New(cfg)
+
+            _, err := c.ScaleMany(client.AppSelector{Names: []string{"api", "worker", "billing"}}, 3)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(appRequests()).To(Equal(1))
+        })
+
+        It("resolves apps selected by name through the AppGuidCache", func() {
+            c := client.New(cfg)
+            Expect(c.Scale("billing", 2)).To(Succeed())
+            Expect(appRequests()).To(Equal(1))
+
+            _, err := c.ScaleMany(client.AppSelector{Names: []string{"api", "worker"}}, 3)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(instances("api")).To(Equal(3))
+            Expect(instances("worker")).To(Equal(3))
+
+            Expect(c.Scale("prod-api", 2)).To(Succeed())
+            Expect(appRequests()).To(Equal(1))
+        })
+
+        It("refreshes a stale cached guid and retries", func() {
+            c := client.New(cfg)
+            Expect(c.Scale("api", 2)).To(Succeed())
+            server.Fail(http.MethodPost, "/v3/apps/"+apps["worker"].Guid+"/processes/web/actions/scale", http.StatusNotFound, 1)
+
+            _, err := c.ScaleMany(client.AppSelector{Names: []string{"worker"}}, 3)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(instances("worker")).To(Equal(3))
+            Expect(appRequests()).To(Equal(2))
+        })
+
+        It("reports apps that fail or are not found", func() {
+            server.Fail(http.MethodPost, "/v3/apps/"+apps["worker"].Guid+"/processes/web/actions/scale", http.StatusServiceUnavailable, -1)
+            c := client.New(cfg)
+
+            report, err := c.ScaleMany(client.AppSelector{Names: []string{"api", "worker", "lemons", "api"}}, 2)
+            Expect(err).To(MatchError(HavePrefix("2 of 3 apps failed: worker: ")))
+
+            var bulkErr *client.BulkError
+            Expect(errors.As(err, &bulkErr)).To(BeTrue())
+            Expect(bulkErr.Failed).To(HaveLen(2))
+
+            var capiErr *client.CapiError
+            Expect(errors.As(err, &capiErr)).To(BeTrue())
+            Expect(capiErr.ResponseCode).To(Equal(http.StatusServiceUnavailable))
+
+            Expect(report.Results).To(HaveLen(3))
+            Expect(report.Results[0].App.Name).To(Equal("api"))
+            Expect(report.Results[0].Err).ToNot(HaveOccurred())
+            Expect(report.Results[1].App.Name).To(Equal("worker"))
+            Expect(report.Results[1].Err).To(HaveOccurred())
+            Expect(report.Results[2].App).To(Equal(models.App{Name: "lemons"}))
+            Expect(report.Results[2].Err).To(MatchError("app 'lemons' not found"))
+
+            Expect(instances("api")).To(Equal(2))
+        })
+
+        It("previews the scaling in dry run mode without failing", func() {
+            var mu sync.Mutex
+            var dryRuns []client.DryRunRequest
+            cfg.DryRun = true
+            cfg.OnDryRun = func(r client.DryRunRequest) {
+                mu.Lock()
+                dryRuns = append(dryRuns, r)
+                mu.Unlock()
+            }
+            c := client.New(cfg)
+
+            report, err := c.ScaleMany(client.AppSelector{Names: []string{"api", "worker"}}, 3)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(report.Failed()).To(BeEmpty())
+            Expect(dryRuns).To(HaveLen(2))
+            for _, res := range report.Results {
+                Expect(res.DryRun).ToNot(BeNil())
+                Expect(res.DryRun.URL).To(HaveSuffix("/v3/apps/" + res.App.Guid + "/processes/web/actions/scale"))
+            }
+            Expect(instances("api")).To(Equal(1))
+        })
+
+        It("returns an error if the apps cannot be listed", func() {
+            server.Fail(http.MethodGet, "/v3/apps", http.StatusInternalServerError, -1)
+            c := client.New(cfg)
+
+            report, err := c.ScaleMany(client.AppSelector{}, 2)
+            Expect(err).To(MatchError(HavePrefix("unable to select apps")))
+            Expect(report.Results).To(BeEmpty())
+
+            var capiErr *client.CapiError
+            Expect(errors.As(err, &capiErr)).To(BeTrue())
+            Expect(capiErr.ResponseCode).To(Equal(http.StatusInternalServerError))
+        })
+    })
+
+    Describe("StopMany()", func() {
+        It("stops every app in the space for an empty selector", func() {
+            c := client.New(cfg)
+
+            report, err := c.StopMany(client.AppSelector{})
+            Expect(err).ToNot(HaveOccurred())
+            Expect(report.Results).To(HaveLen(4))
+
+            for name := range apps {
+                app, _ := server.App(name)
+                Expect(app.State).To(Equal("STOPPED"), name)
+            }
+            app, _ := server.App("elsewhere")
+            Expect(app.State).To(Equal("STARTED"))
+        })
+    })
+
+    Describe("ForEachApp()", func() {
+        It("passes the apps with their guids to fn", func() {
+            c := client.New(cfg)
+
+            var mu sync.Mutex
+            guids := map[string]string{}
+            report, err := c.ForEachApp(client.AppSelector{Names: []string{"api", "worker"}}, func(app models.App) error {
+                mu.Lock()
+                defer mu.Unlock()
+                guids[app.Name] = app.Guid
+                return nil
+            })
+            Expect(err).ToNot(HaveOccurred())
+            Expect(report.Results).To(HaveLen(2))
+            Expect(guids).To(Equal(map[string]string{
+                "api":    apps["api"].Guid,
+                "worker": apps["worker"].Guid,
+            }))
+        })
+
+        It("runs at most BulkConcurrency apps at once", func() {
+            cfg.BulkConcurrency = 2
+            c := client.New(cfg)
+
+            var running, maxRunning int32
+            _, err := c.ForEachApp(client.AppSelector{}, func(app models.App) error {
+                n := atomic.AddInt32(&running, 1)
+                defer atomic.AddInt32(&running, -1)
+                for {
+                    max := atomic.LoadInt32(&maxRunning)
+                    if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+                        break
+                    }
+                }
+                time.Sleep(20 * time.Millisecond)
+                return nil
+            })
+            Expect(err).ToNot(HaveOccurred())
+            Expect(atomic.LoadInt32(&maxRunning)).To(BeEquivalentTo(2))
+        })
+    })
+})
@@ -0,0 +1,108 @@
+package client
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+)
+
+// capiWithoutContext adapts a Capi that does not implement CapiContext by
+// dropping the context and, except for CreateTask, the header options. Calls
+// outside of Capi go to CapiExtended if the Capi implements it.
+type capiWithoutContext struct {
+    Capi
+}
+
+func (c capiWithoutContext) extended(call string) (CapiExtended, error) {
+    capi, ok := c.Capi.(CapiExtended)
+    if !ok {
+        return nil, fmt.Errorf("%s: %w", call, ErrNotSupported)
+    }
+    return capi, nil
+}
+
+func (c capiWithoutContext) RootContext(context.Context) (models.Root, error) {
+    capi, err := c.extended("Root")
+    if err != nil {
+        return models.Root{}, err
+    }
+    return capi.Root()
+}
+
+func (c capiWithoutContext) InfoContext(context.Context) (models.Info, error) {
+    capi, err := c.extended("Info")
+    if err != nil {
+        return models.Info{}, err
+    }
+    return capi.Info()
+}
+
+func (c capiWithoutContext) AppsContext(_ context.Context, query map[string]string) ([]models.App, error) {
+    return c.Apps(query)
+}
+
+func (c capiWithoutContext) ProcessContext(_ context.Context, appGuid, processType string, _ ...models.HeaderOption) (models.Process, error) {
+    return c.Process(appGuid, processType)
+}
+
+func (c capiWithoutContext) ProcessStatsContext(_ context.Context, appGuid, processType string, _ ...models.HeaderOption) ([]models.ProcessStats, error) {
+    capi, err := c.extended("ProcessStats")
+    if err != nil {
+        return nil, err
+    }
+    return capi.ProcessStats(appGuid, processType)
+}
+
+func (c capiWithoutContext) ScaleContext(_ context.Context, appGuid, processType string, instanceCount uint, _ ...models.HeaderOption) error {
+    return c.Scale(appGuid, processType, instanceCount)
+}
+
+func (c capiWithoutContext) CreateTaskContext(_ context.Context, appGuid, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
+    return c.CreateTask(appGuid, command, cfg, opts...)
+}
+
+func (c capiWithoutContext) StopContext(_ context.Context, appGuid string, _ ...models.HeaderOption) error {
+    return c.Stop(appGuid)
+}
+
+func (c capiWithoutContext) StartContext(_ context.Context, appGuid string, _ ...models.HeaderOption) error {
+    capi, err := c.extended("Start")
+    if err != nil {
+        return err
+    }
+    return capi.Start(appGuid)
+}
+
+func (c capiWithoutContext) TasksContext(_ context.Context, appGuid string, query map[string]string) ([]models.Task, error) {
+    capi, err := c.extended("Tasks")
+    if err != nil {
+        return nil, err
+    }
+    return capi.Tasks(appGuid, query)
+}
+
+func (c capiWithoutContext) DeleteAppContext(_ context.Context, appGuid string, _ ...models.HeaderOption) (string, error) {
+    capi, err := c.extended("DeleteApp")
+    if err != nil {
+        return "", err
+    }
+    return capi.DeleteApp(appGuid)
+}
+
+func (c capiWithoutContext) JobContext(_ context.Context, location string) (models.Job, error) {
+    capi, err := c.extended("Job")
+    if err != nil {
+        return models.Job{}, err
+    }
+    return capi.Job(location)
+}
+
+func (c capiWithoutContext) WaitForJobContext(_ context.Context, location string, pollInterval time.Duration) (models.Job, error) {
+    capi, err := c.extended("WaitForJob")
+    if err != nil {
+        return models.Job{}, err
+    }
+    return capi.WaitForJob(location, pollInterval)
+}
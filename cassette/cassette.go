@@ -0,0 +1,302 @@
+// Package cassette records CAPI and UAA interactions to a file and replays
+// them in tests. Use a Transport as the HttpClient transport of the client
+// config:
+//
+//    t, err := cassette.New("fixtures/scale.json", cassette.Replay, nil)
+//    cfg.HttpClient = &http.Client{Transport: t}
+//
+// Tokens, passwords, secrets and cookies are scrubbed from requests and
+// responses before interactions are saved.
+package cassette
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "sync"
+)
+
+type Mode int
+
+const (
+    // Replay answers requests from the cassette without sending them
+    Replay Mode = iota
+
+    // Record sends requests and saves the interactions on Save
+    Record
+)
+
+const redacted = "REDACTED"
+
+var sensitiveFields = []string{"access_token", "refresh_token", "id_token", "password", "client_secret"}
+
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+type Interaction struct {
+    Request  Request  `json:"request"`
+    Response Response `json:"response"`
+}
+
+type Request struct {
+    Method string      `json:"method"`
+    URL    string      `json:"url"`
+    Header http.Header `json:"header"`
+    Body   string      `json:"body"`
+}
+
+type Response struct {
+    Status int         `json:"status"`
+    Header http.Header `json:"header"`
+    Body   string      `json:"body"`
+}
+
+// Transport is an http.RoundTripper that records or replays interactions
+type Transport struct {
+    path string
+    mode Mode
+    next http.RoundTripper
+
+    mu           sync.Mutex
+    interactions []Interaction
+    replayed     []bool
+}
+
+// New creates a Transport for the cassette at path. In Replay mode the
+// cassette is loaded right away. In Record mode requests are sent with next,
+// or http.DefaultTransport if it is nil.
+func New(path string, mode Mode, next http.RoundTripper) (*Transport, error) {
+    if next == nil {
+        next = http.DefaultTransport
+    }
+
+    t := &Transport{
+        path: path,
+        mode: mode,
+        next: next,
+    }
+
+    if mode == Replay {
+        data, err := ioutil.ReadFile(path)
+        if err != nil {
+            return nil, err
+        }
+
+        err = json.Unmarshal(data, &t.interactions)
+        if err != nil {
+            return nil, fmt.Errorf("cannot decode cassette %s: %s", path, err)
+        }
+        t.replayed = make([]bool, len(t.interactions))
+    }
+
+    return t, nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+    reqBody, err := readBody(req)
+    if err != nil {
+        return nil, err
+    }
+    recorded := Request{
+        Method: req.Method,
+        URL:    req.URL.String(),
+        Header: scrubHeader(req.Header),
+        Body:   scrubBody(reqBody),
+    }
+
+    if t.mode == Replay {
+        return t.replay(req, recorded)
+    }
+
+    resp, err := t.next.RoundTrip(req)
+    if err != nil {
+        return nil, err
+    }
+
+    respBody, err := ioutil.ReadAll(resp.Body)
+    resp.Body.Close()
+    if err != nil {
+        return nil, err
+    }
+    resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+    t.mu.Lock()
+    t.interactions = append(t.interactions, Interaction{
+        Request: recorded,
+        Response: Response{
+            Status: resp.StatusCode,
+            Header: scrubHeader(resp.Header),
+            Body:   scrubBody(string(respBody)),
+        },
+    })
+    t.mu.Unlock()
+
+    return resp, nil
+}
+
+// replay answers with the first interaction that has not been replayed yet
+// and matches the method, path, query and scrubbed body. The host is ignored
+// so that cassettes can be replayed against any API url.
+func (t *Transport) replay(req *http.Request, recorded Request) (*http.Response, error) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    for i, interaction := range t.interactions {
+        if t.replayed[i] || !matches(interaction.Request, recorded) {
+            continue
+        }
+
+        t.replayed[i] = true
+        return &http.Response{
+            Status:     fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+            StatusCode: interaction.Response.Status,
+            Proto:      "HTTP/1.1",
+            ProtoMajor: 1,
+            ProtoMinor: 1,
+            Header:     interaction.Response.Header.Clone(),
+            Body:       ioutil.NopCloser(bytes.NewReader([]byte(interaction.Response.Body))),
+            Request:    req,
+        }, nil
+    }
+
+    return nil, fmt.Errorf("cassette %s has no interaction left for %s %s", t.path, req.Method, req.URL.RequestURI())
+}
+
+// Save writes the recorded interactions to the cassette, creating its
+// directory if needed. It does nothing in Replay mode.
+func (t *Transport) Save() error {
+    if t.mode != Record {
+        return nil
+    }
+
+    t.mu.Lock()
+    data, err := json.MarshalIndent(t.interactions, "", "  ")
+    t.mu.Unlock()
+    if err != nil {
+        return err
+    }
+
+    err = os.MkdirAll(filepath.Dir(t.path), 0755)
+    if err != nil {
+        return err
+    }
+
+    return ioutil.WriteFile(t.path, append(data, '\n'), 0644)
+}
+
+func matches(recorded, req Request) bool {
+    recordedUrl, err := url.Parse(recorded.URL)
+    if err != nil {
+        return false
+    }
+    reqUrl, err := url.Parse(req.URL)
+    if err != nil {
+        return false
+    }
+
+    return recorded.Method == req.Method &&
+        recordedUrl.Path == reqUrl.Path &&
+        recordedUrl.Query().Encode() == reqUrl.Query().Encode() &&
+        recorded.Body == req.Body
+}
+
+func readBody(req *http.Request) (string, error) {
+    if req.Body == nil {
+        return "", nil
+    }
+
+    body, err := ioutil.ReadAll(req.Body)
+    req.Body.Close()
+    if err != nil {
+        return "", err
+    }
+    req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+    return string(body), nil
+}
+
+func scrubHeader(header http.Header) http.Header {
+    scrubbed := header.Clone()
+    for _, name := range sensitiveHeaders {
+        values := scrubbed.Values(name)
+        for i := range values {
+            values[i] = redacted
+        }
+    }
+    return scrubbed
+}
+
+// scrubBody redacts the sensitive fields of JSON and form encoded bodies and
+// leaves any other body untouched. Fields are redacted at any depth of a JSON
+// body.
+func scrubBody(body string) string {
+    var doc interface{}
+    if json.Unmarshal([]byte(body), &doc) == nil {
+        if !scrubJSON(doc) {
+            return body
+        }
+
+        data, err := json.Marshal(doc)
+        if err != nil {
+            return body
+        }
+        return string(data)
+    }
+
+    form, err := url.ParseQuery(body)
+    if err != nil || len(form) == 0 {
+        return body
+    }
+
+    changed := false
+    for _, f := range sensitiveFields {
+        if _, ok := form[f]; ok {
+            form.Set(f, redacted)
+            changed = true
+        }
+    }
+    if !changed {
+        return body
+    }
+
+    return form.Encode()
+}
+
+// scrubJSON redacts the sensitive fields of the decoded JSON value in place
+// and reports whether it changed anything
+func scrubJSON(value interface{}) bool {
+    changed := false
+    switch v := value.(type) {
+    case map[string]interface{}:
+        for key, field := range v {
+            if isSensitiveField(key) {
+                v[key] = redacted
+                changed = true
+                continue
+            }
+            if scrubJSON(field) {
+                changed = true
+            }
+        }
+    case []interface{}:
+        for _, item := range v {
+            if scrubJSON(item) {
+                changed = true
+            }
+        }
+    }
+    return changed
+}
+
+func isSensitiveField(name string) bool {
+    for _, f := range sensitiveFields {
+        if f == name {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,13 @@
+package cassette_test
+
+import (
+    "testing"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+func TestCassette(t *testing.T) {
+    RegisterFailHandler(Fail)
+    RunSpecs(t, "Cassette Suite")
+}
@@ -0,0 +1,136 @@
+package cassette_test
+
+import (
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+    "github.com/pivotal-cf/app-automator-cf-client/cassette"
+    "github.com/pivotal-cf/app-automator-cf-client/cftest"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("Transport", func() {
+    var (
+        dir    string
+        path   string
+        server *cftest.Server
+    )
+
+    BeforeEach(func() {
+        var err error
+        dir, err = ioutil.TempDir("", "cassette")
+        Expect(err).ToNot(HaveOccurred())
+        path = filepath.Join(dir, "fixtures", "scale.json")
+
+        server = cftest.NewServer()
+        server.AddApp(cftest.App{Name: "lemons"})
+    })
+
+    AfterEach(func() {
+        server.Close()
+        os.RemoveAll(dir)
+    })
+
+    var record = func() {
+        recorder, err := cassette.New(path, cassette.Record, server.Client().Transport)
+        Expect(err).ToNot(HaveOccurred())
+
+        cfg := server.Config()
+        cfg.HttpClient = &http.Client{Transport: recorder}
+        c := client.New(cfg)
+        Expect(c.Scale("lemons", 3)).To(Succeed())
+        Expect(c.Process("lemons", "web")).To(HaveField("Instances", 3))
+
+        Expect(recorder.Save()).To(Succeed())
+    }
+
+    It("replays recorded interactions without sending them", func() {
+        record()
+        recorded := len(server.Requests())
+        server.Close()
+
+        player, err := cassette.New(path, cassette.Replay, nil)
+        Expect(err).ToNot(HaveOccurred())
+
+        cfg := server.Config()
+        cfg.CloudControllerUrl = "https://api.example.com"
+        cfg.HttpClient = &http.Client{Transport: player}
+        c := client.New(cfg)
+        Expect(c.Scale("lemons", 3)).To(Succeed())
+        Expect(c.Process("lemons", "web")).To(HaveField("Instances", 3))
+
+        Expect(server.Requests()).To(HaveLen(recorded))
+    })
+
+    It("scrubs tokens and passwords", func() {
+        record()
+
+        data, err := ioutil.ReadFile(path)
+        Expect(err).ToNot(HaveOccurred())
+        Expect(string(data)).To(ContainSubstring("REDACTED"))
+        Expect(string(data)).ToNot(ContainSubstring(cftest.Password))
+        Expect(string(data)).ToNot(ContainSubstring("fake-signature"))
+    })
+
+    It("scrubs cookies and nested fields from requests and responses", func() {
+        recorder, err := cassette.New(path, cassette.Record, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+            return &http.Response{
+                StatusCode: http.StatusOK,
+                Header: http.Header{
+                    "Set-Cookie":   {"JSESSIONID=lemons", "__VCAP_ID__=limes"},
+                    "Content-Type": {"application/json"},
+                },
+                Body: ioutil.NopCloser(strings.NewReader(`{"resources": [{"credentials": {"client_secret": "grapefruit"}}]}`)),
+            }, nil
+        }))
+        Expect(err).ToNot(HaveOccurred())
+
+        req, err := http.NewRequest(http.MethodPost, "https://api.example.com/v3/service_credential_bindings", strings.NewReader(`{"parameters": {"password": "mango"}}`))
+        Expect(err).ToNot(HaveOccurred())
+        req.Header.Set("Cookie", "JSESSIONID=lemons")
+        _, err = recorder.RoundTrip(req)
+        Expect(err).ToNot(HaveOccurred())
+        Expect(recorder.Save()).To(Succeed())
+
+        data, err := ioutil.ReadFile(path)
+        Expect(err).ToNot(HaveOccurred())
+        for _, secret := range []string{"lemons", "limes", "grapefruit", "mango"} {
+            Expect(string(data)).ToNot(ContainSubstring(secret))
+        }
+        Expect(string(data)).To(ContainSubstring("application/json"))
+    })
+
+    It("fails requests that were not recorded", func() {
+        record()
+
+        player, err := cassette.New(path, cassette.Replay, nil)
+        Expect(err).ToNot(HaveOccurred())
+
+        cfg := server.Config()
+        cfg.HttpClient = &http.Client{Transport: player}
+        c := client.New(cfg)
+        Expect(c.Stop("lemons")).To(MatchError(ContainSubstring("has no interaction left for POST /v3/apps/")))
+    })
+
+    It("returns an error if the cassette cannot be loaded", func() {
+        _, err := cassette.New(filepath.Join(dir, "missing.json"), cassette.Replay, nil)
+        Expect(err).To(HaveOccurred())
+
+        bad := filepath.Join(dir, "bad.json")
+        Expect(ioutil.WriteFile(bad, []byte("not json"), 0644)).To(Succeed())
+        _, err = cassette.New(bad, cassette.Replay, nil)
+        Expect(err).To(HaveOccurred())
+    })
+})
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+    return f(req)
+}
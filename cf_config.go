@@ -0,0 +1,116 @@
+package client
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+)
+
+// CfConfig is the subset of the cf CLI's config.json needed to talk to the
+// targeted foundation
+type CfConfig struct {
+    Target               string `json:"Target"`
+    SSLDisabled          bool   `json:"SSLDisabled"`
+    AccessToken          string `json:"AccessToken"`
+    RefreshToken         string `json:"RefreshToken"`
+    UaaEndpoint          string `json:"UaaEndpoint"`
+    UAAOAuthClient       string `json:"UAAOAuthClient"`
+    UAAOAuthClientSecret string `json:"UAAOAuthClientSecret"`
+    SpaceFields          struct {
+        GUID string `json:"GUID"`
+        Name string `json:"Name"`
+    } `json:"SpaceFields"`
+}
+
+// CfConfigPath returns the location of the cf CLI config, honoring $CF_HOME
+func CfConfigPath() (string, error) {
+    home := os.Getenv("CF_HOME")
+    if home == "" {
+        var err error
+        home, err = os.UserHomeDir()
+        if err != nil {
+            return "", err
+        }
+    }
+
+    return filepath.Join(home, ".cf", "config.json"), nil
+}
+
+// LoadCfConfig reads the cf CLI config from its default location
+func LoadCfConfig() (CfConfig, error) {
+    path, err := CfConfigPath()
+    if err != nil {
+        return CfConfig{}, err
+    }
+
+    return LoadCfConfigFrom(path)
+}
+
+// LoadCfConfigFrom reads the cf CLI config at path
+func LoadCfConfigFrom(path string) (CfConfig, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return CfConfig{}, fmt.Errorf("unable to read cf config: %s", err)
+    }
+
+    var cfg CfConfig
+    err = json.Unmarshal(data, &cfg)
+    if err != nil {
+        return CfConfig{}, fmt.Errorf("unable to decode cf config: %s", err)
+    }
+
+    if cfg.Target == "" {
+        return CfConfig{}, fmt.Errorf("cf config has no target, run 'cf login' first")
+    }
+
+    if cfg.UAAOAuthClient == "" {
+        cfg.UAAOAuthClient = "cf"
+    }
+
+    return cfg, nil
+}
+
+// BuildFromCfConfig creates a Client for the foundation and space targeted by
+// the cf CLI
+func BuildFromCfConfig() (*Client, error) {
+    cfg, err := LoadCfConfig()
+    if err != nil {
+        return nil, err
+    }
+
+    return NewFromCfConfig(cfg)
+}
+
+// NewFromCfConfig creates a Client that uses the cf CLI's tokens, refreshing
+// them with its refresh token when they expire
+func NewFromCfConfig(cfCfg CfConfig) (*Client, error) {
+    cfg, err := ConfigFromCfConfig(cfCfg)
+    if err != nil {
+        return nil, err
+    }
+
+    return New(cfg), nil
+}
+
+// ConfigFromCfConfig returns the Config that NewFromCfConfig would use, so
+// that it can be adjusted before calling New
+func ConfigFromCfConfig(cfCfg CfConfig) (Config, error) {
+    tlsConfig, err := TLSOptions{SkipSslValidation: cfCfg.SSLDisabled}.TLSConfig()
+    if err != nil {
+        return Config{}, err
+    }
+
+    return Config{
+        CloudControllerUrl: cfCfg.Target,
+        SpaceGuid:          cfCfg.SpaceFields.GUID,
+        OauthUrl:           cfCfg.UaaEndpoint,
+        Client:             cfCfg.UAAOAuthClient,
+        ClientSecret:       cfCfg.UAAOAuthClientSecret,
+        AccessToken:        cfCfg.AccessToken,
+        RefreshToken:       cfCfg.RefreshToken,
+        TLSConfig:          tlsConfig,
+        HttpTimeout:        defaultHttpTimeout,
+    }, nil
+}
@@ -0,0 +1,155 @@
+package client_test
+
+import (
+    "encoding/base64"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("CfConfig", func() {
+    var dir string
+
+    BeforeEach(func() {
+        var err error
+        dir, err = ioutil.TempDir("", "cf-home")
+        Expect(err).ToNot(HaveOccurred())
+        Expect(os.Mkdir(filepath.Join(dir, ".cf"), 0700)).To(Succeed())
+    })
+
+    AfterEach(func() {
+        os.RemoveAll(dir)
+    })
+
+    var writeCfConfig = func(contents string) string {
+        return writeTestFile(filepath.Join(dir, ".cf"), "config.json", []byte(contents))
+    }
+
+    Describe("CfConfigPath()", func() {
+        It("uses CF_HOME if set", func() {
+            os.Setenv("CF_HOME", dir)
+            defer os.Unsetenv("CF_HOME")
+
+            path, err := client.CfConfigPath()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(path).To(Equal(filepath.Join(dir, ".cf", "config.json")))
+        })
+    })
+
+    Describe("LoadCfConfigFrom()", func() {
+        It("reads the target, tokens and space", func() {
+            path := writeCfConfig(`{
+                "ConfigVersion": 3,
+                "Target": "https://api.example.com",
+                "SSLDisabled": true,
+                "AccessToken": "bearer access",
+                "RefreshToken": "refresh",
+                "UaaEndpoint": "https://uaa.example.com",
+                "SpaceFields": {"GUID": "space-guid", "Name": "space"}
+            }`)
+
+            cfg, err := client.LoadCfConfigFrom(path)
+            Expect(err).ToNot(HaveOccurred())
+
+            Expect(cfg.Target).To(Equal("https://api.example.com"))
+            Expect(cfg.SSLDisabled).To(BeTrue())
+            Expect(cfg.AccessToken).To(Equal("bearer access"))
+            Expect(cfg.RefreshToken).To(Equal("refresh"))
+            Expect(cfg.UaaEndpoint).To(Equal("https://uaa.example.com"))
+            Expect(cfg.SpaceFields.GUID).To(Equal("space-guid"))
+            Expect(cfg.UAAOAuthClient).To(Equal("cf"))
+        })
+
+        It("returns an error if the file does not exist", func() {
+            _, err := client.LoadCfConfigFrom(filepath.Join(dir, "nope.json"))
+            Expect(err).To(HaveOccurred())
+        })
+
+        It("returns an error if the file is not json", func() {
+            _, err := client.LoadCfConfigFrom(writeCfConfig("lemons"))
+            Expect(err).To(HaveOccurred())
+        })
+
+        It("returns an error if nothing is targeted", func() {
+            _, err := client.LoadCfConfigFrom(writeCfConfig(`{"ConfigVersion": 3}`))
+            Expect(err).To(MatchError(ContainSubstring("cf login")))
+        })
+    })
+
+    Describe("NewFromCfConfig()", func() {
+        It("uses the access token until it expires", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            accessToken := "bearer header." + base64.RawURLEncoding.EncodeToString([]byte(
+                fmt.Sprintf(`{"exp": %d}`, time.Now().Add(time.Hour).Unix()),
+            )) + ".signature"
+            tc.expectedToken = accessToken
+
+            cfg := client.CfConfig{
+                Target:       tc.server.URL,
+                AccessToken:  accessToken,
+                RefreshToken: "refresh",
+                UaaEndpoint:  tc.server.URL,
+            }
+            cfg.SpaceFields.GUID = "space-guid"
+
+            c, err := client.NewFromCfConfig(cfg)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(tc.oauthCalled).To(Equal(0))
+            Expect(tc.getAppsQuery).To(HaveKeyWithValue("space_guids", []string{"space-guid"}))
+        })
+
+        It("refreshes the token with the refresh token", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            c, err := client.NewFromCfConfig(client.CfConfig{
+                Target:         tc.server.URL,
+                AccessToken:    "bearer expired",
+                RefreshToken:   "refresh",
+                UaaEndpoint:    tc.server.URL,
+                UAAOAuthClient: "cf",
+            })
+            Expect(err).ToNot(HaveOccurred())
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(tc.oauthForm.Get("grant_type")).To(Equal("refresh_token"))
+            Expect(tc.oauthForm.Get("refresh_token")).To(Equal("refresh"))
+            Expect(tc.oauthForm.Get("client_id")).To(Equal("cf"))
+        })
+    })
+
+    Describe("ConfigFromCfConfig()", func() {
+        It("maps the target, space and tokens", func() {
+            cfCfg := client.CfConfig{
+                Target:         "https://api.example.com",
+                SSLDisabled:    true,
+                AccessToken:    "bearer access",
+                RefreshToken:   "refresh",
+                UaaEndpoint:    "https://uaa.example.com",
+                UAAOAuthClient: "cf",
+            }
+            cfCfg.SpaceFields.GUID = "space-guid"
+
+            cfg, err := client.ConfigFromCfConfig(cfCfg)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(cfg.CloudControllerUrl).To(Equal("https://api.example.com"))
+            Expect(cfg.SpaceGuid).To(Equal("space-guid"))
+            Expect(cfg.OauthUrl).To(Equal("https://uaa.example.com"))
+            Expect(cfg.Client).To(Equal("cf"))
+            Expect(cfg.AccessToken).To(Equal("bearer access"))
+            Expect(cfg.RefreshToken).To(Equal("refresh"))
+            Expect(cfg.TLSConfig.InsecureSkipVerify).To(BeTrue())
+        })
+    })
+})
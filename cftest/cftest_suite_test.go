@@ -0,0 +1,13 @@
+package cftest_test
+
+import (
+    "testing"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+func TestCftest(t *testing.T) {
+    RegisterFailHandler(Fail)
+    RunSpecs(t, "Cftest Suite")
+}
@@ -0,0 +1,645 @@
+package cftest
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/gorilla/mux"
+)
+
+const megabyte = 1024 * 1024
+
+func (s *Server) routes(router *mux.Router) {
+    router.HandleFunc("/", s.handleRoot).Methods(http.MethodGet)
+    router.HandleFunc("/oauth/token", s.handleToken).Methods(http.MethodPost)
+
+    v3 := router.PathPrefix("/v3").Subrouter()
+    v3.Use(s.authorize)
+    v3.HandleFunc("/info", s.handleInfo).Methods(http.MethodGet)
+    v3.HandleFunc("/apps", s.handleListApps).Methods(http.MethodGet)
+    v3.HandleFunc("/apps/{guid}", s.handleGetApp).Methods(http.MethodGet)
+    v3.HandleFunc("/apps/{guid}", s.handleDeleteApp).Methods(http.MethodDelete)
+    v3.HandleFunc("/apps/{guid}/actions/start", s.handleAppState("STARTED")).Methods(http.MethodPost)
+    v3.HandleFunc("/apps/{guid}/actions/stop", s.handleAppState("STOPPED")).Methods(http.MethodPost)
+    v3.HandleFunc("/apps/{guid}/processes/{type}", s.handleGetProcess).Methods(http.MethodGet)
+    v3.HandleFunc("/apps/{guid}/processes/{type}/stats", s.handleProcessStats).Methods(http.MethodGet)
+    v3.HandleFunc("/apps/{guid}/processes/{type}/actions/scale", s.handleScale).Methods(http.MethodPost)
+    v3.HandleFunc("/apps/{guid}/tasks", s.handleListTasks).Methods(http.MethodGet)
+    v3.HandleFunc("/apps/{guid}/tasks", s.handleCreateTask).Methods(http.MethodPost)
+    v3.HandleFunc("/tasks/{guid}", s.handleGetTask).Methods(http.MethodGet)
+    v3.HandleFunc("/tasks/{guid}/actions/cancel", s.handleCancelTask).Methods(http.MethodPost)
+    v3.HandleFunc("/deployments", s.handleListDeployments).Methods(http.MethodGet)
+    v3.HandleFunc("/deployments", s.handleCreateDeployment).Methods(http.MethodPost)
+    v3.HandleFunc("/deployments/{guid}", s.handleGetDeployment).Methods(http.MethodGet)
+    v3.HandleFunc("/jobs/{guid}", s.handleGetJob).Methods(http.MethodGet)
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        if req.Header.Get("Authorization") != "bearer "+s.token {
+            writeError(w, http.StatusUnauthorized, "CF-InvalidAuthToken", "Invalid Auth Token")
+            return
+        }
+
+        next.ServeHTTP(w, req)
+    })
+}
+
+func (s *Server) handleRoot(w http.ResponseWriter, req *http.Request) {
+    link := func(path string) map[string]string {
+        return map[string]string{"href": s.URL + path}
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "links": map[string]interface{}{
+            "self":                link(""),
+            "cloud_controller_v3": link("/v3"),
+            "login":               link(""),
+            "uaa":                 link(""),
+        },
+    })
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, req *http.Request) {
+    err := req.ParseForm()
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+        return
+    }
+
+    valid := false
+    switch req.PostForm.Get("grant_type") {
+    case "password":
+        valid = req.PostForm.Get("username") == Username && req.PostForm.Get("password") == Password
+    case "client_credentials", "refresh_token":
+        valid = req.PostForm.Get("client_id") != ""
+    }
+    if !valid {
+        writeError(w, http.StatusUnauthorized, "unauthorized", "Bad credentials")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "access_token": s.token,
+        "token_type":   "bearer",
+        "expires_in":   3600,
+    })
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, req *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "name":        "cftest",
+        "build":       "fake",
+        "version":     3,
+        "description": "fake Cloud Controller",
+    })
+}
+
+func (s *Server) handleListApps(w http.ResponseWriter, req *http.Request) {
+    names := filter(req, "names")
+    spaces := filter(req, "space_guids")
+    labels, err := parseLabelSelector(req.URL.Query().Get("label_selector"))
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "CF-BadQueryParameter", "The query parameter is invalid: "+err.Error())
+        return
+    }
+
+    s.mu.Lock()
+    var resources []interface{}
+    for _, a := range s.sortedApps() {
+        if names.matches(a.Name) && spaces.matches(a.SpaceGuid) && labels.matches(a.Labels) {
+            resources = append(resources, appResource(a))
+        }
+    }
+    s.mu.Unlock()
+
+    writeList(w, resources)
+}
+
+func (s *Server) handleGetApp(w http.ResponseWriter, req *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    app, ok := s.apps[mux.Vars(req)["guid"]]
+    if !ok {
+        writeNotFound(w, "App")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, appResource(app))
+}
+
+func (s *Server) handleDeleteApp(w http.ResponseWriter, req *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    guid := mux.Vars(req)["guid"]
+    if _, ok := s.apps[guid]; !ok {
+        writeNotFound(w, "App")
+        return
+    }
+
+    delete(s.apps, guid)
+    for key, p := range s.processes {
+        if p.AppGuid == guid {
+            delete(s.processes, key)
+        }
+    }
+
+    jobGuid := newGuid()
+    s.jobs[jobGuid] = "app.delete"
+    w.Header().Set("Location", s.URL+"/v3/jobs/"+jobGuid)
+    w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) handleAppState(state string) http.HandlerFunc {
+    return func(w http.ResponseWriter, req *http.Request) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        app, ok := s.apps[mux.Vars(req)["guid"]]
+        if !ok {
+            writeNotFound(w, "App")
+            return
+        }
+
+        app.State = state
+        writeJSON(w, http.StatusOK, appResource(app))
+    }
+}
+
+func (s *Server) handleGetProcess(w http.ResponseWriter, req *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    vars := mux.Vars(req)
+    p, ok := s.processes[processKey(vars["guid"], vars["type"])]
+    if !ok {
+        writeNotFound(w, "Process")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, processResource(p))
+}
+
+func (s *Server) handleProcessStats(w http.ResponseWriter, req *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    vars := mux.Vars(req)
+    p, ok := s.processes[processKey(vars["guid"], vars["type"])]
+    if !ok {
+        writeNotFound(w, "Process")
+        return
+    }
+
+    state := "RUNNING"
+    if app, ok := s.apps[p.AppGuid]; !ok || app.State != "STARTED" {
+        state = "DOWN"
+    }
+
+    resources := []interface{}{}
+    for i := 0; i < p.Instances; i++ {
+        resources = append(resources, map[string]interface{}{
+            "type":  p.Type,
+            "index": i,
+            "state": state,
+            "usage": map[string]interface{}{
+                "time": time.Now().UTC().Format(time.RFC3339),
+                "cpu":  p.CPU,
+                "mem":  uint64(p.MemoryUsedInMB) * megabyte,
+                "disk": 0,
+            },
+            "mem_quota":  uint64(p.MemoryInMB) * megabyte,
+            "disk_quota": uint64(p.DiskInMB) * megabyte,
+        })
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{"resources": resources})
+}
+
+func (s *Server) handleScale(w http.ResponseWriter, req *http.Request) {
+    var scale struct {
+        Instances  *int  `json:"instances"`
+        MemoryInMB *uint `json:"memory_in_mb"`
+        DiskInMB   *uint `json:"disk_in_mb"`
+    }
+    if !decodeBody(w, req, &scale) {
+        return
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    vars := mux.Vars(req)
+    p, ok := s.processes[processKey(vars["guid"], vars["type"])]
+    if !ok {
+        writeNotFound(w, "Process")
+        return
+    }
+
+    if scale.Instances != nil {
+        p.Instances = *scale.Instances
+    }
+    if scale.MemoryInMB != nil {
+        p.MemoryInMB = *scale.MemoryInMB
+    }
+    if scale.DiskInMB != nil {
+        p.DiskInMB = *scale.DiskInMB
+    }
+
+    writeJSON(w, http.StatusAccepted, processResource(p))
+}
+
+func (s *Server) handleListTasks(w http.ResponseWriter, req *http.Request) {
+    names := filter(req, "names")
+    states := filter(req, "states")
+
+    s.mu.Lock()
+    appGuid := mux.Vars(req)["guid"]
+    if _, ok := s.apps[appGuid]; !ok {
+        s.mu.Unlock()
+        writeNotFound(w, "App")
+        return
+    }
+
+    var resources []interface{}
+    for _, t := range s.sortedTasks() {
+        if t.AppGuid == appGuid && names.matches(t.Name) && states.matches(t.State) {
+            resources = append(resources, taskResource(t))
+        }
+    }
+    s.mu.Unlock()
+
+    writeList(w, resources)
+}
+
+func (s *Server) handleCreateTask(w http.ResponseWriter, req *http.Request) {
+    var create struct {
+        Name        string `json:"name"`
+        Command     string `json:"command"`
+        MemoryInMB  uint   `json:"memory_in_mb"`
+        DiskInMB    uint   `json:"disk_in_mb"`
+        DropletGuid string `json:"droplet_guid"`
+    }
+    if !decodeBody(w, req, &create) {
+        return
+    }
+
+    if create.Command == "" {
+        writeError(w, http.StatusUnprocessableEntity, "CF-UnprocessableEntity", "The request is semantically invalid: command presence")
+        return
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    appGuid := mux.Vars(req)["guid"]
+    if _, ok := s.apps[appGuid]; !ok {
+        writeNotFound(w, "App")
+        return
+    }
+
+    t := s.addTask(Task{
+        AppGuid:     appGuid,
+        Name:        create.Name,
+        Command:     create.Command,
+        MemoryInMB:  create.MemoryInMB,
+        DiskInMB:    create.DiskInMB,
+        DropletGuid: create.DropletGuid,
+    })
+    writeJSON(w, http.StatusAccepted, taskResource(&t))
+}
+
+func (s *Server) handleGetTask(w http.ResponseWriter, req *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    t, ok := s.tasks[mux.Vars(req)["guid"]]
+    if !ok {
+        writeNotFound(w, "Task")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, taskResource(t))
+}
+
+func (s *Server) handleCancelTask(w http.ResponseWriter, req *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    t, ok := s.tasks[mux.Vars(req)["guid"]]
+    if !ok {
+        writeNotFound(w, "Task")
+        return
+    }
+
+    t.State = "CANCELING"
+    writeJSON(w, http.StatusAccepted, taskResource(t))
+}
+
+func (s *Server) handleListDeployments(w http.ResponseWriter, req *http.Request) {
+    apps := filter(req, "app_guids")
+    states := filter(req, "states")
+
+    s.mu.Lock()
+    var resources []interface{}
+    for _, d := range s.sortedDeployments() {
+        if apps.matches(d.AppGuid) && states.matches(d.State) {
+            resources = append(resources, deploymentResource(d))
+        }
+    }
+    s.mu.Unlock()
+
+    writeList(w, resources)
+}
+
+func (s *Server) handleCreateDeployment(w http.ResponseWriter, req *http.Request) {
+    var create struct {
+        Strategy      string `json:"strategy"`
+        Relationships struct {
+            App struct {
+                Data struct {
+                    Guid string `json:"guid"`
+                } `json:"data"`
+            } `json:"app"`
+        } `json:"relationships"`
+    }
+    if !decodeBody(w, req, &create) {
+        return
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    appGuid := create.Relationships.App.Data.Guid
+    if _, ok := s.apps[appGuid]; !ok {
+        writeError(w, http.StatusUnprocessableEntity, "CF-UnprocessableEntity", "App not found")
+        return
+    }
+
+    d := s.addDeployment(Deployment{AppGuid: appGuid, Strategy: create.Strategy})
+    writeJSON(w, http.StatusCreated, deploymentResource(&d))
+}
+
+func (s *Server) handleGetDeployment(w http.ResponseWriter, req *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    d, ok := s.deployments[mux.Vars(req)["guid"]]
+    if !ok {
+        writeNotFound(w, "Deployment")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, deploymentResource(d))
+}
+
+// handleGetJob completes every job right away
+func (s *Server) handleGetJob(w http.ResponseWriter, req *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    guid := mux.Vars(req)["guid"]
+    operation, ok := s.jobs[guid]
+    if !ok {
+        writeNotFound(w, "Job")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "guid":      guid,
+        "operation": operation,
+        "state":     "COMPLETE",
+        "errors":    []interface{}{},
+        "warnings":  []interface{}{},
+    })
+}
+
+func (s *Server) sortedApps() []*App {
+    var apps []*App
+    for _, a := range s.apps {
+        apps = append(apps, a)
+    }
+    sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+    return apps
+}
+
+func (s *Server) sortedTasks() []*Task {
+    var tasks []*Task
+    for _, t := range s.tasks {
+        tasks = append(tasks, t)
+    }
+    sort.Slice(tasks, func(i, j int) bool { return tasks[i].SequenceID < tasks[j].SequenceID })
+    return tasks
+}
+
+func (s *Server) sortedDeployments() []*Deployment {
+    var deployments []*Deployment
+    for _, d := range s.deployments {
+        deployments = append(deployments, d)
+    }
+    sort.Slice(deployments, func(i, j int) bool { return deployments[i].Guid < deployments[j].Guid })
+    return deployments
+}
+
+func appResource(a *App) map[string]interface{} {
+    return map[string]interface{}{
+        "guid":  a.Guid,
+        "name":  a.Name,
+        "state": a.State,
+        "metadata": map[string]interface{}{
+            "labels": a.Labels,
+        },
+        "relationships": map[string]interface{}{
+            "space": relationship(a.SpaceGuid),
+        },
+    }
+}
+
+func processResource(p *Process) map[string]interface{} {
+    return map[string]interface{}{
+        "guid":         p.Guid,
+        "type":         p.Type,
+        "instances":    p.Instances,
+        "memory_in_mb": p.MemoryInMB,
+        "disk_in_mb":   p.DiskInMB,
+        "relationships": map[string]interface{}{
+            "app": relationship(p.AppGuid),
+        },
+    }
+}
+
+func taskResource(t *Task) map[string]interface{} {
+    return map[string]interface{}{
+        "guid":         t.Guid,
+        "sequence_id":  t.SequenceID,
+        "name":         t.Name,
+        "command":      t.Command,
+        "state":        t.State,
+        "memory_in_mb": t.MemoryInMB,
+        "disk_in_mb":   t.DiskInMB,
+        "droplet_guid": t.DropletGuid,
+        "relationships": map[string]interface{}{
+            "app": relationship(t.AppGuid),
+        },
+    }
+}
+
+func deploymentResource(d *Deployment) map[string]interface{} {
+    return map[string]interface{}{
+        "guid":     d.Guid,
+        "state":    d.State,
+        "strategy": d.Strategy,
+        "relationships": map[string]interface{}{
+            "app": relationship(d.AppGuid),
+        },
+    }
+}
+
+func relationship(guid string) map[string]interface{} {
+    return map[string]interface{}{
+        "data": map[string]string{"guid": guid},
+    }
+}
+
+type queryFilter []string
+
+// filter returns the comma separated values of a CAPI list filter
+func filter(req *http.Request, name string) queryFilter {
+    value := req.URL.Query().Get(name)
+    if value == "" {
+        return nil
+    }
+    return strings.Split(value, ",")
+}
+
+func (f queryFilter) matches(value string) bool {
+    if len(f) == 0 {
+        return true
+    }
+
+    for _, v := range f {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
+
+// labelRequirement is one requirement of a label selector: key=value,
+// key!=value, key or !key
+type labelRequirement struct {
+    key   string
+    value string
+    op    string
+}
+
+type labelSelector []labelRequirement
+
+// parseLabelSelector supports the equality and existence requirements of
+// CAPI label selectors, but not set based ones such as "key in (a,b)"
+func parseLabelSelector(selector string) (labelSelector, error) {
+    if selector == "" {
+        return nil, nil
+    }
+
+    var requirements labelSelector
+    for _, part := range strings.Split(selector, ",") {
+        part = strings.TrimSpace(part)
+        switch {
+        case strings.Contains(part, "!="):
+            kv := strings.SplitN(part, "!=", 2)
+            requirements = append(requirements, labelRequirement{key: kv[0], value: kv[1], op: "!="})
+        case strings.Contains(part, "=="):
+            kv := strings.SplitN(part, "==", 2)
+            requirements = append(requirements, labelRequirement{key: kv[0], value: kv[1], op: "="})
+        case strings.Contains(part, "="):
+            kv := strings.SplitN(part, "=", 2)
+            requirements = append(requirements, labelRequirement{key: kv[0], value: kv[1], op: "="})
+        case strings.HasPrefix(part, "!"):
+            requirements = append(requirements, labelRequirement{key: part[1:], op: "!"})
+        default:
+            requirements = append(requirements, labelRequirement{key: part, op: "exists"})
+        }
+    }
+
+    for _, r := range requirements {
+        if r.key == "" || strings.ContainsAny(r.key, " ()") {
+            return nil, fmt.Errorf("unsupported label selector %q", selector)
+        }
+    }
+
+    return requirements, nil
+}
+
+func (s labelSelector) matches(labels map[string]string) bool {
+    for _, r := range s {
+        value, ok := labels[r.key]
+        switch r.op {
+        case "=":
+            if !ok || value != r.value {
+                return false
+            }
+        case "!=":
+            if ok && value == r.value {
+                return false
+            }
+        case "!":
+            if ok {
+                return false
+            }
+        case "exists":
+            if !ok {
+                return false
+            }
+        }
+    }
+    return true
+}
+
+func decodeBody(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+    err := json.NewDecoder(req.Body).Decode(v)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "CF-MessageParseError", "Request invalid due to parse error: "+err.Error())
+        return false
+    }
+    return true
+}
+
+func writeList(w http.ResponseWriter, resources []interface{}) {
+    if resources == nil {
+        resources = []interface{}{}
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "pagination": map[string]interface{}{
+            "total_results": len(resources),
+            "total_pages":   1,
+            "next":          nil,
+        },
+        "resources": resources,
+    })
+}
+
+func writeNotFound(w http.ResponseWriter, resource string) {
+    writeError(w, http.StatusNotFound, "CF-ResourceNotFound", fmt.Sprintf("%s not found", resource))
+}
+
+func writeError(w http.ResponseWriter, status int, title, detail string) {
+    writeJSON(w, status, map[string]interface{}{
+        "errors": []map[string]interface{}{
+            {"title": title, "detail": detail},
+        },
+    })
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,398 @@
+// Package cftest provides an in-memory fake Cloud Controller and UAA for
+// testing code that uses the client.
+package cftest
+
+import (
+    "bytes"
+    "crypto/rand"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "path"
+    "sync"
+    "time"
+
+    "github.com/gorilla/mux"
+    "github.com/pivotal-cf/app-automator-cf-client"
+)
+
+const (
+    Username  = "admin"
+    Password  = "supersecret"
+    SpaceGuid = "space-guid"
+)
+
+type App struct {
+    Guid      string
+    Name      string
+    SpaceGuid string
+    State     string
+    Labels    map[string]string
+}
+
+type Process struct {
+    Guid       string
+    AppGuid    string
+    Type       string
+    Instances  int
+    MemoryInMB uint
+    DiskInMB   uint
+
+    // CPU and MemoryUsedInMB are the usage reported by every instance in
+    // the process stats
+    CPU            float64
+    MemoryUsedInMB uint
+}
+
+type Task struct {
+    Guid        string
+    AppGuid     string
+    SequenceID  int
+    Name        string
+    Command     string
+    State       string
+    MemoryInMB  uint
+    DiskInMB    uint
+    DropletGuid string
+}
+
+type Deployment struct {
+    Guid     string
+    AppGuid  string
+    State    string
+    Strategy string
+}
+
+// Request is a request received by the server
+type Request struct {
+    Method string
+    Path   string
+    Query  string
+    Header http.Header
+    Body   string
+}
+
+type fault struct {
+    method string
+    path   string
+    status int
+    times  int
+    delay  time.Duration
+}
+
+// Server is a fake CAPI and UAA. The zero value is not usable, see
+// NewServer.
+type Server struct {
+    *httptest.Server
+
+    token string
+
+    mu          sync.Mutex
+    apps        map[string]*App
+    processes   map[string]*Process
+    tasks       map[string]*Task
+    deployments map[string]*Deployment
+    jobs        map[string]string
+    requests    []Request
+    faults      []*fault
+}
+
+// NewServer starts a fake CAPI and UAA. Close it when done.
+func NewServer() *Server {
+    s := &Server{
+        apps:        map[string]*App{},
+        processes:   map[string]*Process{},
+        tasks:       map[string]*Task{},
+        deployments: map[string]*Deployment{},
+        jobs:        map[string]string{},
+    }
+
+    router := mux.NewRouter()
+    s.routes(router)
+    s.Server = httptest.NewServer(s.record(router))
+    s.token = fakeJWT(time.Now().Add(time.Hour))
+
+    return s
+}
+
+// Config returns a client config that talks to the server as Username
+func (s *Server) Config() client.Config {
+    return client.Config{
+        CloudControllerUrl: s.URL,
+        SpaceGuid:          SpaceGuid,
+        Username:           Username,
+        Password:           Password,
+        HttpClient:         s.Client(),
+    }
+}
+
+// AddApp seeds an app with a web process of one instance. The guid, space
+// and state default to a random guid, SpaceGuid and STARTED.
+func (s *Server) AddApp(app App) App {
+    if app.Guid == "" {
+        app.Guid = newGuid()
+    }
+    if app.SpaceGuid == "" {
+        app.SpaceGuid = SpaceGuid
+    }
+    if app.State == "" {
+        app.State = "STARTED"
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.apps[app.Guid] = &app
+    s.processes[processKey(app.Guid, "web")] = &Process{
+        Guid:       newGuid(),
+        AppGuid:    app.Guid,
+        Type:       "web",
+        Instances:  1,
+        MemoryInMB: 1024,
+        DiskInMB:   1024,
+    }
+
+    return app
+}
+
+// SetProcess adds or replaces a process of an app
+func (s *Server) SetProcess(p Process) Process {
+    if p.Guid == "" {
+        p.Guid = newGuid()
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.processes[processKey(p.AppGuid, p.Type)] = &p
+    return p
+}
+
+// AddTask seeds a task. The guid and state default to a random guid and
+// RUNNING.
+func (s *Server) AddTask(t Task) Task {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.addTask(t)
+}
+
+func (s *Server) addTask(t Task) Task {
+    if t.Guid == "" {
+        t.Guid = newGuid()
+    }
+    if t.State == "" {
+        t.State = "RUNNING"
+    }
+    if t.SequenceID == 0 {
+        t.SequenceID = len(s.tasks) + 1
+    }
+
+    s.tasks[t.Guid] = &t
+    return t
+}
+
+// SetTaskState changes the state of a task, e.g. to SUCCEEDED or FAILED
+func (s *Server) SetTaskState(taskGuid, state string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if t, ok := s.tasks[taskGuid]; ok {
+        t.State = state
+    }
+}
+
+// AddDeployment seeds a deployment. The guid, state and strategy default to a
+// random guid, DEPLOYING and rolling.
+func (s *Server) AddDeployment(d Deployment) Deployment {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.addDeployment(d)
+}
+
+func (s *Server) addDeployment(d Deployment) Deployment {
+    if d.Guid == "" {
+        d.Guid = newGuid()
+    }
+    if d.State == "" {
+        d.State = "DEPLOYING"
+    }
+    if d.Strategy == "" {
+        d.Strategy = "rolling"
+    }
+
+    s.deployments[d.Guid] = &d
+    return d
+}
+
+// App returns the app with the given name
+func (s *Server) App(name string) (App, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, a := range s.apps {
+        if a.Name == name {
+            return *a, true
+        }
+    }
+
+    return App{}, false
+}
+
+// Process returns the process of the given type of an app
+func (s *Server) Process(appGuid, processType string) (Process, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    p, ok := s.processes[processKey(appGuid, processType)]
+    if !ok {
+        return Process{}, false
+    }
+    return *p, true
+}
+
+// Tasks returns the tasks of an app
+func (s *Server) Tasks(appGuid string) []Task {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var tasks []Task
+    for _, t := range s.sortedTasks() {
+        if t.AppGuid == appGuid {
+            tasks = append(tasks, *t)
+        }
+    }
+
+    return tasks
+}
+
+// Deployments returns the deployments of an app
+func (s *Server) Deployments(appGuid string) []Deployment {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var deployments []Deployment
+    for _, d := range s.deployments {
+        if d.AppGuid == appGuid {
+            deployments = append(deployments, *d)
+        }
+    }
+
+    return deployments
+}
+
+// Requests returns every request received so far, oldest first
+func (s *Server) Requests() []Request {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return append([]Request(nil), s.requests...)
+}
+
+// Fail makes the next times requests whose method and path match respond
+// with status. An empty method matches every method and the path may be a
+// pattern such as /v3/apps/*/actions/stop. A negative times fails every
+// matching request.
+func (s *Server) Fail(method, pathPattern string, status, times int) {
+    s.addFault(&fault{method: method, path: pathPattern, status: status, times: times})
+}
+
+// Delay makes every request whose method and path match wait before it is
+// handled, e.g. to test timeouts
+func (s *Server) Delay(method, pathPattern string, d time.Duration) {
+    s.addFault(&fault{method: method, path: pathPattern, delay: d, times: -1})
+}
+
+// Reset removes every fault added with Fail and Delay
+func (s *Server) Reset() {
+    s.mu.Lock()
+    s.faults = nil
+    s.mu.Unlock()
+}
+
+func (s *Server) addFault(f *fault) {
+    s.mu.Lock()
+    s.faults = append(s.faults, f)
+    s.mu.Unlock()
+}
+
+// record remembers every request and applies the faults before handing it
+// to the router
+func (s *Server) record(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        body, _ := ioutil.ReadAll(req.Body)
+        req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+        s.mu.Lock()
+        s.requests = append(s.requests, Request{
+            Method: req.Method,
+            Path:   req.URL.Path,
+            Query:  req.URL.RawQuery,
+            Header: req.Header.Clone(),
+            Body:   string(body),
+        })
+        delay, status := s.matchFaults(req)
+        s.mu.Unlock()
+
+        time.Sleep(delay)
+        if status != 0 {
+            writeError(w, status, "CF-InjectedFault", "injected by cftest")
+            return
+        }
+
+        next.ServeHTTP(w, req)
+    })
+}
+
+func (s *Server) matchFaults(req *http.Request) (time.Duration, int) {
+    var delay time.Duration
+    var status int
+    for _, f := range s.faults {
+        if f.times == 0 || (f.method != "" && f.method != req.Method) {
+            continue
+        }
+        if ok, _ := path.Match(f.path, req.URL.Path); !ok {
+            continue
+        }
+
+        delay += f.delay
+        if f.status != 0 && status == 0 {
+            status = f.status
+            if f.times > 0 {
+                f.times--
+            }
+        }
+    }
+
+    return delay, status
+}
+
+func processKey(appGuid, processType string) string {
+    return appGuid + "/" + processType
+}
+
+func newGuid() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    b[6] = (b[6] & 0x0f) | 0x40
+    b[8] = (b[8] & 0x3f) | 0x80
+    return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// fakeJWT builds an unsigned token that the client can decode claims from
+func fakeJWT(expiresAt time.Time) string {
+    header, _ := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+    claims, _ := json.Marshal(map[string]interface{}{
+        "scope":     []string{"cloud_controller.read", "cloud_controller.write"},
+        "user_name": Username,
+        "client_id": "cf",
+        "exp":       expiresAt.Unix(),
+    })
+
+    encode := base64.RawURLEncoding.EncodeToString
+    return encode(header) + "." + encode(claims) + ".fake-signature"
+}
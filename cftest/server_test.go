@@ -0,0 +1,173 @@
+package cftest_test
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+    "github.com/pivotal-cf/app-automator-cf-client/cftest"
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+    var (
+        server *cftest.Server
+        c      *client.Client
+        lemons cftest.App
+    )
+
+    BeforeEach(func() {
+        server = cftest.NewServer()
+        lemons = server.AddApp(cftest.App{Name: "lemons"})
+        server.AddApp(cftest.App{Name: "limes", SpaceGuid: "other-space"})
+        c = client.New(server.Config())
+    })
+
+    AfterEach(func() {
+        server.Close()
+    })
+
+    It("scales processes", func() {
+        Expect(c.Scale("lemons", 3)).To(Succeed())
+
+        p, ok := server.Process(lemons.Guid, "web")
+        Expect(ok).To(BeTrue())
+        Expect(p.Instances).To(Equal(3))
+
+        proc, err := c.Process("lemons", "web")
+        Expect(err).ToNot(HaveOccurred())
+        Expect(proc.Instances).To(Equal(3))
+    })
+
+    It("reports process stats for every instance", func() {
+        p, _ := server.Process(lemons.Guid, "web")
+        p.Instances = 2
+        p.CPU = 0.5
+        p.MemoryUsedInMB = 256
+        server.SetProcess(p)
+
+        stats, err := c.ProcessStats("lemons", "web")
+        Expect(err).ToNot(HaveOccurred())
+        Expect(stats).To(HaveLen(2))
+        Expect(stats[1].Index).To(Equal(1))
+        Expect(stats[1].State).To(Equal("RUNNING"))
+        Expect(stats[1].Usage.CPU).To(Equal(0.5))
+        Expect(stats[1].Usage.Mem).To(BeEquivalentTo(256 * 1024 * 1024))
+        Expect(stats[1].MemQuota).To(BeEquivalentTo(1024 * 1024 * 1024))
+    })
+
+    It("filters apps by label selector", func() {
+        server.AddApp(cftest.App{Name: "oranges", Labels: map[string]string{"env": "staging", "critical": "true"}})
+        server.AddApp(cftest.App{Name: "grapes", Labels: map[string]string{"env": "staging"}})
+
+        report, err := c.ForEachApp(client.AppSelector{LabelSelector: "env=staging,!critical"}, func(models.App) error {
+            return nil
+        })
+        Expect(err).ToNot(HaveOccurred())
+        Expect(report.Results).To(HaveLen(1))
+        Expect(report.Results[0].App.Name).To(Equal("grapes"))
+    })
+
+    It("only finds apps in the configured space", func() {
+        Expect(c.Scale("limes", 3)).To(MatchError(ContainSubstring("app 'limes' not found")))
+    })
+
+    It("stops apps", func() {
+        Expect(c.Stop("lemons")).To(Succeed())
+
+        app, _ := server.App("lemons")
+        Expect(app.State).To(Equal("STOPPED"))
+    })
+
+    It("creates tasks", func() {
+        task, err := c.CreateTask("lemons", "rake db:migrate", models.TaskConfig{MemoryInMB: 256})
+        Expect(err).ToNot(HaveOccurred())
+
+        tasks := server.Tasks(lemons.Guid)
+        Expect(tasks).To(HaveLen(1))
+        Expect(tasks[0].Guid).To(Equal(task.Guid))
+        Expect(tasks[0].Name).To(Equal("rake db:migrate"))
+        Expect(tasks[0].MemoryInMB).To(BeEquivalentTo(256))
+        Expect(tasks[0].State).To(Equal("RUNNING"))
+
+        server.SetTaskState(task.Guid, "SUCCEEDED")
+        Expect(server.Tasks(lemons.Guid)[0].State).To(Equal("SUCCEEDED"))
+    })
+
+    It("deletes apps with a job", func() {
+        location, err := c.DeleteApp("lemons")
+        Expect(err).ToNot(HaveOccurred())
+
+        job, err := c.WaitForJob(location, time.Millisecond, time.Second)
+        Expect(err).ToNot(HaveOccurred())
+        Expect(job.Operation).To(Equal("app.delete"))
+
+        _, ok := server.App("lemons")
+        Expect(ok).To(BeFalse())
+    })
+
+    It("seeds deployments", func() {
+        d := server.AddDeployment(cftest.Deployment{AppGuid: lemons.Guid})
+        Expect(server.Deployments(lemons.Guid)).To(ConsistOf(cftest.Deployment{
+            Guid:     d.Guid,
+            AppGuid:  lemons.Guid,
+            State:    "DEPLOYING",
+            Strategy: "rolling",
+        }))
+    })
+
+    It("issues tokens the client can read claims from", func() {
+        Expect(c.RequireScopes("cloud_controller.write")).To(Succeed())
+    })
+
+    It("records requests", func() {
+        Expect(c.Scale("lemons", 2)).To(Succeed())
+
+        var paths []string
+        for _, r := range server.Requests() {
+            paths = append(paths, r.Method+" "+r.Path)
+        }
+        Expect(paths).To(Equal([]string{
+            "GET /",
+            "POST /oauth/token",
+            "GET /v3/apps",
+            "POST /v3/apps/" + lemons.Guid + "/processes/web/actions/scale",
+        }))
+
+        scale := server.Requests()[3]
+        Expect(scale.Body).To(MatchJSON(`{"instances": 2}`))
+        Expect(scale.Header.Get("Authorization")).To(HavePrefix("bearer "))
+    })
+
+    It("rejects requests without a valid token", func() {
+        resp, err := http.Get(server.URL + "/v3/apps")
+        Expect(err).ToNot(HaveOccurred())
+        Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+    })
+
+    It("injects errors", func() {
+        server.Fail(http.MethodPost, "/v3/apps/*/processes/*/actions/scale", http.StatusServiceUnavailable, 1)
+
+        err := c.Scale("lemons", 2)
+        capiErr, ok := err.(*client.CapiError)
+        Expect(ok).To(BeTrue())
+        Expect(capiErr.ResponseCode).To(Equal(http.StatusServiceUnavailable))
+
+        Expect(c.Scale("lemons", 2)).To(Succeed())
+    })
+
+    It("injects delays", func() {
+        cfg := server.Config()
+        cfg.HttpClient.Timeout = 50 * time.Millisecond
+        c = client.New(cfg)
+        server.Delay("", "/v3/apps", 200*time.Millisecond)
+
+        Expect(c.Scale("lemons", 2)).ToNot(Succeed())
+
+        server.Reset()
+        Expect(c.Scale("lemons", 2)).To(Succeed())
+    })
+})
@@ -1,16 +1,69 @@
 package client
 
 import (
+    "context"
     "crypto/tls"
+    "errors"
+    "fmt"
+    "log"
+    "log/slog"
+    "math"
     "net/http"
+    "net/url"
     "strings"
+    "time"
 
     "github.com/pivotal-cf/app-automator-cf-client/internal"
     "github.com/pivotal-cf/app-automator-cf-client/models"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/trace"
 )
 
 const (
-    defaultProcessType = "web"
+    defaultProcessType     = "web"
+    defaultHttpTimeout     = 15 * time.Second
+    defaultJobPollInterval = time.Second
+
+    // maxCapiInt is the largest instance count, memory or disk size that
+    // CAPI stores
+    maxCapiInt = math.MaxInt32
+)
+
+// ErrCircuitOpen is returned instead of sending a request while CAPI or UAA is
+// considered unhealthy
+var ErrCircuitOpen = internal.ErrCircuitOpen
+
+// ErrNotSupported is returned by calls that the Capi of a Client does not
+// implement, see CapiExtended
+var ErrNotSupported = errors.New("not supported by the Capi")
+
+type CircuitState = internal.CircuitState
+
+// CapiError is returned when CAPI responds with an unexpected status. It
+// carries the request id, headers and duration of the response.
+type CapiError = internal.CapiError
+
+// DryRunRequest is a request that a mutating operation such as Scale, Stop
+// or CreateTask would have sent in dry run mode
+type DryRunRequest = models.DryRunRequest
+
+// DryRunError is returned by mutating operations in dry run mode. It carries
+// the request that the call would have sent.
+type DryRunError = models.DryRunError
+
+// JobFailedError is returned by WaitForJob when the job fails. The job holds
+// the errors reported by CAPI.
+type JobFailedError = internal.JobFailedError
+
+// Metrics receives measurements about CAPI requests, UAA token fetches and
+// the app guid cache
+type Metrics = internal.Metrics
+
+const (
+    CircuitClosed   = internal.CircuitClosed
+    CircuitOpen     = internal.CircuitOpen
+    CircuitHalfOpen = internal.CircuitHalfOpen
 )
 
 type Oauth interface {
@@ -25,10 +78,60 @@ type Capi interface {
     Stop(appGuid string) error
 }
 
+// CapiExtended is implemented by a Capi that supports the calls added after
+// Capi. The Client uses it when the Capi does not implement CapiContext.
+// Without either, Root, Info, ProcessStats, Start, Tasks, DeleteApp and
+// WaitForJob return ErrNotSupported.
+type CapiExtended interface {
+    Root() (models.Root, error)
+    Info() (models.Info, error)
+    ProcessStats(appGuid, processType string) ([]models.ProcessStats, error)
+    Start(appGuid string) error
+    Tasks(appGuid string, query map[string]string) ([]models.Task, error)
+    DeleteApp(appGuid string) (string, error)
+    Job(location string) (models.Job, error)
+    WaitForJob(location string, pollInterval time.Duration) (models.Job, error)
+}
+
+// CapiContext is implemented by a Capi whose requests take a context. The
+// Client uses it when available, so that the context of a Client operation
+// cancels its requests and parents their spans. A Capi without it gets
+// context.Background() semantics: nothing is cancelled and WaitForJob
+// timeouts do not apply. Header options are only passed to the CreateTask of
+// such a Capi.
+type CapiContext interface {
+    RootContext(ctx context.Context) (models.Root, error)
+    InfoContext(ctx context.Context) (models.Info, error)
+    AppsContext(ctx context.Context, query map[string]string) ([]models.App, error)
+    ProcessContext(ctx context.Context, appGuid, processType string, opts ...models.HeaderOption) (models.Process, error)
+    ProcessStatsContext(ctx context.Context, appGuid, processType string, opts ...models.HeaderOption) ([]models.ProcessStats, error)
+    ScaleContext(ctx context.Context, appGuid, processType string, instanceCount uint, opts ...models.HeaderOption) error
+    CreateTaskContext(ctx context.Context, appGuid, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error)
+    StopContext(ctx context.Context, appGuid string, opts ...models.HeaderOption) error
+    StartContext(ctx context.Context, appGuid string, opts ...models.HeaderOption) error
+    TasksContext(ctx context.Context, appGuid string, query map[string]string) ([]models.Task, error)
+    DeleteAppContext(ctx context.Context, appGuid string, opts ...models.HeaderOption) (string, error)
+    JobContext(ctx context.Context, location string) (models.Job, error)
+    WaitForJobContext(ctx context.Context, location string, pollInterval time.Duration) (models.Job, error)
+}
+
 type AppGuidCache interface {
     TryWithRefresh(appName string, f func(appGuid string) error) error
 }
 
+// AppGuidCacheContext is implemented by an AppGuidCache whose lookups take a
+// context. The Client uses it when available.
+type AppGuidCacheContext interface {
+    TryWithRefreshContext(ctx context.Context, appName string, f func(appGuid string) error) error
+}
+
+// AppGuidCacheMany is implemented by an AppGuidCache that can look up several
+// apps at once. Bulk operations use it to resolve apps selected by name,
+// expecting the guids of the apps that exist.
+type AppGuidCacheMany interface {
+    GetMany(ctx context.Context, names []string) (map[string]string, error)
+}
+
 type Client struct {
     CloudControllerUrl string
     SpaceGuid          string
@@ -36,6 +139,9 @@ type Client struct {
     Oauth        Oauth
     Capi         Capi
     AppGuidCache AppGuidCache
+
+    tracer          trace.Tracer
+    bulkConcurrency int
 }
 
 type Config struct {
@@ -44,90 +150,547 @@ type Config struct {
     HttpClient         *http.Client
     Username           string
     Password           string
+    Client             string
+    ClientSecret       string
+    RefreshToken       string
+    AccessToken        string
     TokenGetter        func() (string, error)
+
+    // OauthUrl overrides the token endpoint, which is otherwise discovered
+    // from the CAPI root document
+    OauthUrl string
+
+    // TLSConfig and HttpTimeout are used to build an HttpClient if none is
+    // given. See TLSOptions for loading CA bundles and client certificates.
+    TLSConfig   *tls.Config
+    HttpTimeout time.Duration
+
+    // Proxy is used for both CAPI and UAA requests unless CapiProxy or
+    // UaaProxy is set. Without any of them HTTPS_PROXY, HTTP_PROXY and
+    // NO_PROXY are honored. Proxies only apply if HttpClient is not given.
+    Proxy     *url.URL
+    CapiProxy *url.URL
+    UaaProxy  *url.URL
+
+    // RateLimit is the number of CAPI requests per second, with bursts of up
+    // to RateLimitBurst. Requests wait instead of failing, at most until the
+    // context given to a ...Context method is done. The limiter also slows
+    // down when CAPI's X-RateLimit headers ask for it. Zero disables both.
+    RateLimit      float64
+    RateLimitBurst int
+
+    // CircuitBreakerThreshold is the number of consecutive CAPI or UAA
+    // failures after which requests fail fast with ErrCircuitOpen. Each time
+    // CircuitBreakerCooldown, 30s by default, has passed the breaker goes
+    // half-open and probes the CAPI root or UAA's /healthz, closing if it
+    // responds without a 5xx and reopening if not. Zero disables the
+    // breakers.
+    CircuitBreakerThreshold int
+    CircuitBreakerCooldown  time.Duration
+    OnCircuitStateChange    func(name string, from, to CircuitState)
+
+    // Middleware wraps every CAPI request, e.g. for audit logging, adding
+    // correlation ids or injecting faults in tests
+    Middleware []models.Middleware
+
+    // Logger receives CAPI and UAA requests at info level and cache
+    // refreshes at debug level. Nothing is logged if it is nil.
+    Logger *slog.Logger
+
+    // Metrics receives request, token and cache measurements, see the
+    // metrics package for a Prometheus collector
+    Metrics Metrics
+
+    // TracerProvider receives a span for every Client operation, with child
+    // spans for the app guid lookup, the token and each CAPI request. Nothing
+    // is traced if it is nil.
+    TracerProvider trace.TracerProvider
+
+    // Propagator injects the trace context into CAPI requests. W3C trace
+    // context is used if it is nil.
+    Propagator propagation.TextMapPropagator
+
+    // OnResponse is called with the request id, headers and duration of
+    // every successful CAPI request. Failed requests return a *CapiError
+    // with the same information. Pass a context from
+    // models.WithResponseMetadata to a ...Context method to get the metadata
+    // of a single call instead.
+    OnResponse func(models.ResponseMetadata)
+
+    // OnWarnings is called with every CAPI response, successful or not,
+    // that carries warnings
+    OnWarnings func(models.ResponseMetadata)
+
+    // DryRun still resolves app guids and validates inputs but does not send
+    // mutating requests. Scale, Stop, Start, CreateTask and DeleteApp return
+    // a *DryRunError with the request they would have sent instead, see
+    // errors.As. OnDryRun is also called with every such request.
+    DryRun   bool
+    OnDryRun func(DryRunRequest)
+
+    // BulkConcurrency is the number of apps ScaleMany, StopMany and
+    // ForEachApp act on at once, 4 by default
+    BulkConcurrency int
 }
 
+// Build creates a Client from the Cloud Foundry environment and exits if the
+// environment is invalid
 func Build() *Client {
-    env := LoadEnv()
-    httpClient := buildHttpClient(env)
+    c, err := BuildWithError()
+    if err != nil {
+        log.Fatalf("unable to build client: %s", err)
+    }
+
+    return c
+}
+
+// BuildWithError creates a Client from the Cloud Foundry environment
+func BuildWithError() (*Client, error) {
+    return buildFromEnvironment(LoadEnvironment)
+}
+
+// ConfigFromEnv returns the Config that BuildWithError would use, so that it
+// can be adjusted before calling New
+func ConfigFromEnv() (Config, error) {
+    env, err := LoadEnvironment()
+    if err != nil {
+        return Config{}, err
+    }
 
+    return configFromEnvironment(env), nil
+}
+
+// BuildFromEnv creates a Client from the given variables instead of the
+// process environment
+func BuildFromEnv(vars map[string]string) (*Client, error) {
+    return buildFromEnvironment(func() (environment, error) {
+        return LoadEnvironmentFrom(vars)
+    })
+}
+
+// buildFromEnvironment creates a Client from the environment that load
+// returns, or returns the error load returns
+func buildFromEnvironment(load func() (environment, error)) (*Client, error) {
+    env, err := load()
+    if err != nil {
+        return nil, err
+    }
+
+    return New(configFromEnvironment(env)), nil
+}
+
+func configFromEnvironment(env environment) Config {
     cfg := Config{
         CloudControllerUrl: env.CloudControllerApi,
         SpaceGuid:          env.VcapApplication.SpaceID,
-        HttpClient:         httpClient,
+        OauthUrl:           env.OauthUrl,
+        TLSConfig:          env.tlsConfig,
+        HttpTimeout:        env.HttpTimeout,
+        RateLimit:          env.RateLimit,
+        RateLimitBurst:     env.RateLimitBurst,
+
+        Proxy:     env.proxy,
+        CapiProxy: env.capiProxy,
+        UaaProxy:  env.uaaProxy,
+
+        CircuitBreakerThreshold: env.BreakerThreshold,
+        CircuitBreakerCooldown:  env.BreakerCooldown,
     }
 
-    credentials, ok := getUserProvidedCredentials(env.VcapServices.UserProvided)
+    credentials, ok := getCredentials(env.VcapServices, env.CredentialsService)
     if ok {
-        cfg.Username = credentials["username"]
-        cfg.Password = credentials["password"]
+        cfg.Username = credentials.Username
+        cfg.Password = credentials.Password
+        cfg.Client = credentials.Client
+        cfg.ClientSecret = credentials.ClientSecret
     }
 
-    return New(cfg)
+    return cfg
 }
 
 func New(cfg Config) *Client {
-    tokenEndpoint := strings.Replace(cfg.CloudControllerUrl, "api", "login", 1)
-    oauth := NewTokenCache(OauthConfig{
-        HttpClient: cfg.HttpClient,
-        OauthUrl:   tokenEndpoint,
-        Username:   cfg.Username,
-        Password:   cfg.Password,
-    })
-    capi := internal.NewCapiClient(internal.NewCapiDoer(cfg.HttpClient, cfg.CloudControllerUrl, oauth.Token))
+    uaaHttpClient := cfg.HttpClient
+    if cfg.HttpClient == nil {
+        cfg.HttpClient = buildHttpClient(cfg.TLSConfig, cfg.HttpTimeout, firstProxy(cfg.CapiProxy, cfg.Proxy))
+        uaaHttpClient = buildHttpClient(cfg.TLSConfig, cfg.HttpTimeout, firstProxy(cfg.UaaProxy, cfg.Proxy))
+    }
+
+    oauthCfg := OauthConfig{
+        HttpClient:   uaaHttpClient,
+        OauthUrl:     cfg.OauthUrl,
+        Username:     cfg.Username,
+        Password:     cfg.Password,
+        Client:       cfg.Client,
+        ClientSecret: cfg.ClientSecret,
+        RefreshToken: cfg.RefreshToken,
+        AccessToken:  cfg.AccessToken,
+
+        CircuitBreakerThreshold: cfg.CircuitBreakerThreshold,
+        CircuitBreakerCooldown:  cfg.CircuitBreakerCooldown,
+        OnCircuitStateChange:    cfg.OnCircuitStateChange,
+
+        Logger:  cfg.Logger,
+        Metrics: cfg.Metrics,
+    }
+    if cfg.OauthUrl == "" {
+        oauthCfg.OauthUrlGetter = internal.NewUaaDiscoverer(cfg.HttpClient, cfg.CloudControllerUrl).Url
+    }
+    oauth := NewTokenCache(oauthCfg)
+
+    doerOpts := []internal.CapiDoerOption{
+        internal.WithTokenInvalidator(oauth.Invalidate),
+        internal.WithMiddleware(cfg.Middleware...),
+        internal.WithLogger(cfg.Logger),
+        internal.WithMetrics(cfg.Metrics),
+        internal.WithTracerProvider(cfg.TracerProvider),
+        internal.WithPropagator(cfg.Propagator),
+        internal.WithResponseObserver(cfg.OnResponse),
+        internal.WithWarningsHandler(cfg.OnWarnings),
+        internal.WithDryRun(cfg.DryRun),
+        internal.WithDryRunObserver(cfg.OnDryRun),
+    }
+    if cfg.RateLimit > 0 {
+        doerOpts = append(doerOpts, internal.WithRateLimiter(internal.NewRateLimiter(cfg.RateLimit, cfg.RateLimitBurst)))
+    }
+    if cfg.CircuitBreakerThreshold > 0 {
+        doerOpts = append(doerOpts, internal.WithCircuitBreaker(internal.NewCircuitBreaker(
+            "capi",
+            cfg.CircuitBreakerThreshold,
+            cfg.CircuitBreakerCooldown,
+            cfg.OnCircuitStateChange,
+            internal.WithProbe(internal.HttpProbe(cfg.HttpClient, func() (string, error) {
+                return cfg.CloudControllerUrl + "/", nil
+            })),
+        )))
+    }
+
+    capi := internal.NewCapiClient(internal.NewCapiDoer(
+        cfg.HttpClient,
+        cfg.CloudControllerUrl,
+        oauth.TokenContext,
+        doerOpts...,
+    ))
+
+    appGuidCache := internal.NewAppGuidCache(
+        capi.AppsContext,
+        cfg.SpaceGuid,
+        internal.WithAppGuidCacheLogger(cfg.Logger),
+        internal.WithAppGuidCacheMetrics(cfg.Metrics),
+        internal.WithAppGuidCacheTracerProvider(cfg.TracerProvider),
+    )
 
     return &Client{
         CloudControllerUrl: cfg.CloudControllerUrl,
         SpaceGuid:          cfg.SpaceGuid,
         Oauth:              oauth,
         Capi:               capi,
-        AppGuidCache:       internal.NewAppGuidCache(capi.Apps, cfg.SpaceGuid),
+        AppGuidCache:       appGuidCache,
+        tracer:             internal.Tracer(cfg.TracerProvider),
+        bulkConcurrency:    cfg.BulkConcurrency,
     }
 }
 
-func buildHttpClient(env environment) *http.Client {
+func buildHttpClient(tlsConfig *tls.Config, timeout time.Duration, proxy *url.URL) *http.Client {
+    proxyFunc := http.ProxyFromEnvironment
+    if proxy != nil {
+        proxyFunc = http.ProxyURL(proxy)
+    }
+
     return &http.Client{
         Transport: &http.Transport{
-            TLSClientConfig: &tls.Config{
-                InsecureSkipVerify: env.SkipSslValidation,
-            },
+            Proxy:           proxyFunc,
+            TLSClientConfig: tlsConfig,
         },
-        Timeout: env.HttpTimeout,
+        Timeout: timeout,
     }
 }
 
+func firstProxy(proxies ...*url.URL) *url.URL {
+    for _, p := range proxies {
+        if p != nil {
+            return p
+        }
+    }
+
+    return nil
+}
+
+// Root returns the CAPI root document with the links to the other platform
+// components (uaa, login, log cache, ...)
+func (c *Client) Root() (models.Root, error) {
+    return c.RootContext(context.Background())
+}
+
+// RootContext is Root with a context that cancels the request and parents its
+// span
+func (c *Client) RootContext(ctx context.Context) (root models.Root, err error) {
+    ctx, span := c.startSpan(ctx, "Root")
+    defer func() { internal.EndSpan(span, err) }()
+
+    return c.capi().RootContext(ctx)
+}
+
+// Info returns the CAPI /v3/info metadata
+func (c *Client) Info() (models.Info, error) {
+    return c.InfoContext(context.Background())
+}
+
+// InfoContext is Info with a context
+func (c *Client) InfoContext(ctx context.Context) (info models.Info, err error) {
+    ctx, span := c.startSpan(ctx, "Info")
+    defer func() { internal.EndSpan(span, err) }()
+
+    return c.capi().InfoContext(ctx)
+}
+
 func (c *Client) Scale(appName string, instanceTarget uint) error {
-    return c.AppGuidCache.TryWithRefresh(appName, func(appGuid string) error {
-        return c.Capi.Scale(appGuid, defaultProcessType, instanceTarget)
+    return c.ScaleContext(context.Background(), appName, instanceTarget)
+}
+
+// ScaleContext is Scale with a context
+func (c *Client) ScaleContext(ctx context.Context, appName string, instanceTarget uint, opts ...models.HeaderOption) (err error) {
+    err = validateInstances(instanceTarget)
+    if err != nil {
+        return err
+    }
+
+    ctx, span := c.startSpan(ctx, "Scale", attribute.String("cf.app.name", appName), attribute.Int("cf.process.instances", int(instanceTarget)))
+    defer func() { internal.EndSpan(span, err) }()
+
+    return c.tryWithRefresh(ctx, appName, func(appGuid string) error {
+        return c.capi().ScaleContext(ctx, appGuid, defaultProcessType, instanceTarget, opts...)
     })
 }
 
+func validateInstances(instanceTarget uint) error {
+    if instanceTarget > maxCapiInt {
+        return fmt.Errorf("instance count %d is above the maximum of %d", instanceTarget, maxCapiInt)
+    }
+    return nil
+}
+
 func (c *Client) Process(appName, processType string) (models.Process, error) {
-    var proc models.Process
-    var err error
-    err = c.AppGuidCache.TryWithRefresh(appName, func(appGuid string) error {
-        proc, err = c.Capi.Process(appGuid, processType)
+    return c.ProcessContext(context.Background(), appName, processType)
+}
+
+// ProcessContext is Process with a context
+func (c *Client) ProcessContext(ctx context.Context, appName, processType string, opts ...models.HeaderOption) (proc models.Process, err error) {
+    ctx, span := c.startSpan(ctx, "Process", attribute.String("cf.app.name", appName), attribute.String("cf.process.type", processType))
+    defer func() { internal.EndSpan(span, err) }()
+
+    err = c.tryWithRefresh(ctx, appName, func(appGuid string) error {
+        proc, err = c.capi().ProcessContext(ctx, appGuid, processType, opts...)
         return err
     })
     return proc, err
 }
 
+// ProcessStats returns the state and usage of every instance of the process
+func (c *Client) ProcessStats(appName, processType string, opts ...models.HeaderOption) ([]models.ProcessStats, error) {
+    return c.ProcessStatsContext(context.Background(), appName, processType, opts...)
+}
+
+// ProcessStatsContext is ProcessStats with a context
+func (c *Client) ProcessStatsContext(ctx context.Context, appName, processType string, opts ...models.HeaderOption) (stats []models.ProcessStats, err error) {
+    ctx, span := c.startSpan(ctx, "ProcessStats", attribute.String("cf.app.name", appName), attribute.String("cf.process.type", processType))
+    defer func() { internal.EndSpan(span, err) }()
+
+    err = c.tryWithRefresh(ctx, appName, func(appGuid string) error {
+        stats, err = c.capi().ProcessStatsContext(ctx, appGuid, processType, opts...)
+        return err
+    })
+    return stats, err
+}
+
 func (c *Client) CreateTask(appName, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
+    return c.CreateTaskContext(context.Background(), appName, command, cfg, opts...)
+}
+
+// CreateTaskContext is CreateTask with a context
+func (c *Client) CreateTaskContext(ctx context.Context, appName, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (task models.Task, err error) {
+    if command == "" {
+        return models.Task{}, fmt.Errorf("task command is required")
+    }
+    if cfg.MemoryInMB > maxCapiInt {
+        return models.Task{}, fmt.Errorf("task memory of %d MB is above the maximum of %d MB", cfg.MemoryInMB, maxCapiInt)
+    }
+    if cfg.DiskInMB > maxCapiInt {
+        return models.Task{}, fmt.Errorf("task disk of %d MB is above the maximum of %d MB", cfg.DiskInMB, maxCapiInt)
+    }
     if cfg.Name == "" {
         cfg.Name = command
     }
 
-    var task models.Task
-    var err error
-    err = c.AppGuidCache.TryWithRefresh(appName, func(appGuid string) error {
-        task, err = c.Capi.CreateTask(appGuid, command, cfg, opts...)
+    ctx, span := c.startSpan(ctx, "CreateTask", attribute.String("cf.app.name", appName), attribute.String("cf.task.name", cfg.Name))
+    defer func() { internal.EndSpan(span, err) }()
+
+    err = c.tryWithRefresh(ctx, appName, func(appGuid string) error {
+        task, err = c.capi().CreateTaskContext(ctx, appGuid, command, cfg, opts...)
         return err
     })
     return task, err
 }
 
 func (c *Client) Stop(appName string) error {
-    return c.AppGuidCache.TryWithRefresh(appName, func(appGuid string) error {
-        return c.Capi.Stop(appGuid)
+    return c.StopContext(context.Background(), appName)
+}
+
+// StopContext is Stop with a context
+func (c *Client) StopContext(ctx context.Context, appName string, opts ...models.HeaderOption) (err error) {
+    ctx, span := c.startSpan(ctx, "Stop", attribute.String("cf.app.name", appName))
+    defer func() { internal.EndSpan(span, err) }()
+
+    return c.tryWithRefresh(ctx, appName, func(appGuid string) error {
+        return c.capi().StopContext(ctx, appGuid, opts...)
+    })
+}
+
+func (c *Client) Start(appName string, opts ...models.HeaderOption) error {
+    return c.StartContext(context.Background(), appName, opts...)
+}
+
+// StartContext is Start with a context
+func (c *Client) StartContext(ctx context.Context, appName string, opts ...models.HeaderOption) (err error) {
+    ctx, span := c.startSpan(ctx, "Start", attribute.String("cf.app.name", appName))
+    defer func() { internal.EndSpan(span, err) }()
+
+    return c.tryWithRefresh(ctx, appName, func(appGuid string) error {
+        return c.capi().StartContext(ctx, appGuid, opts...)
     })
 }
+
+// Apps lists the apps in the space
+func (c *Client) Apps() ([]models.App, error) {
+    return c.AppsContext(context.Background())
+}
+
+// AppsContext is Apps with a context
+func (c *Client) AppsContext(ctx context.Context) (apps []models.App, err error) {
+    ctx, span := c.startSpan(ctx, "Apps")
+    defer func() { internal.EndSpan(span, err) }()
+
+    return c.capi().AppsContext(ctx, map[string]string{
+        "space_guids": c.SpaceGuid,
+    })
+}
+
+// Tasks lists the tasks of the app, optionally filtered by CAPI query
+// parameters such as names or states
+func (c *Client) Tasks(appName string, query map[string]string) ([]models.Task, error) {
+    return c.TasksContext(context.Background(), appName, query)
+}
+
+// TasksContext is Tasks with a context
+func (c *Client) TasksContext(ctx context.Context, appName string, query map[string]string) (tasks []models.Task, err error) {
+    ctx, span := c.startSpan(ctx, "Tasks", attribute.String("cf.app.name", appName))
+    defer func() { internal.EndSpan(span, err) }()
+
+    err = c.tryWithRefresh(ctx, appName, func(appGuid string) error {
+        tasks, err = c.capi().TasksContext(ctx, appGuid, query)
+        return err
+    })
+    return tasks, err
+}
+
+// DeleteApp deletes the app and returns the location of the job to pass to
+// WaitForJob
+func (c *Client) DeleteApp(appName string, opts ...models.HeaderOption) (string, error) {
+    return c.DeleteAppContext(context.Background(), appName, opts...)
+}
+
+// DeleteAppContext is DeleteApp with a context
+func (c *Client) DeleteAppContext(ctx context.Context, appName string, opts ...models.HeaderOption) (job string, err error) {
+    ctx, span := c.startSpan(ctx, "DeleteApp", attribute.String("cf.app.name", appName))
+    defer func() { internal.EndSpan(span, err) }()
+
+    err = c.tryWithRefresh(ctx, appName, func(appGuid string) error {
+        job, err = c.capi().DeleteAppContext(ctx, appGuid, opts...)
+        return err
+    })
+    return job, err
+}
+
+// WaitForJob polls the job every pollInterval until it completes or fails.
+// The job is either a location returned by an asynchronous operation or a job
+// guid. It returns a *JobFailedError if the job fails and gives up after
+// timeout unless timeout is zero.
+func (c *Client) WaitForJob(job string, pollInterval, timeout time.Duration) (models.Job, error) {
+    return c.WaitForJobContext(context.Background(), job, pollInterval, timeout)
+}
+
+// WaitForJobContext is WaitForJob with a context. It also gives up when ctx is
+// done.
+func (c *Client) WaitForJobContext(ctx context.Context, job string, pollInterval, timeout time.Duration) (j models.Job, err error) {
+    ctx, span := c.startSpan(ctx, "WaitForJob")
+    defer func() { internal.EndSpan(span, err) }()
+
+    if pollInterval <= 0 {
+        pollInterval = defaultJobPollInterval
+    }
+    if timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, timeout)
+        defer cancel()
+    }
+
+    j, err = c.capi().WaitForJobContext(ctx, job, pollInterval)
+    span.SetAttributes(attribute.String("cf.job.guid", j.Guid), attribute.String("cf.job.state", j.State))
+    return j, err
+}
+
+// startSpan starts the span of a Client operation as a child of the span in
+// ctx, if any
+func (c *Client) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+    tracer := c.tracer
+    if tracer == nil {
+        tracer = internal.Tracer(nil)
+    }
+
+    return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// capi returns the Capi with context support, adapting one that has none
+func (c *Client) capi() CapiContext {
+    if capi, ok := c.Capi.(CapiContext); ok {
+        return capi
+    }
+    return capiWithoutContext{c.Capi}
+}
+
+func (c *Client) tryWithRefresh(ctx context.Context, appName string, f func(appGuid string) error) error {
+    if cache, ok := c.AppGuidCache.(AppGuidCacheContext); ok {
+        return cache.TryWithRefreshContext(ctx, appName, f)
+    }
+    return c.AppGuidCache.TryWithRefresh(appName, f)
+}
+
+// Claims decodes the claims of the token currently used to talk to CAPI
+func (c *Client) Claims() (models.Claims, error) {
+    token, err := c.Oauth.Token()
+    if err != nil {
+        return models.Claims{}, err
+    }
+
+    return internal.DecodeClaims(token)
+}
+
+// RequireScopes returns an error if the token is missing any of the scopes
+func (c *Client) RequireScopes(scopes ...string) error {
+    claims, err := c.Claims()
+    if err != nil {
+        return err
+    }
+
+    var missing []string
+    for _, s := range scopes {
+        if !claims.HasScope(s) {
+            missing = append(missing, s)
+        }
+    }
+
+    if len(missing) > 0 {
+        return fmt.Errorf("token is missing required scopes: %s", strings.Join(missing, ", "))
+    }
+
+    return nil
+}
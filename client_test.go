@@ -1,8 +1,11 @@
 package client_test
 
 import (
+    "context"
+    "encoding/base64"
     "errors"
     "net/http"
+    "time"
 
     "github.com/pivotal-cf/app-automator-cf-client"
     "github.com/pivotal-cf/app-automator-cf-client/models"
@@ -27,6 +30,31 @@ var _ = Describe("Client", func() {
             Expect(cache.called).To(BeTrue())
         })
 
+        It("passes the context of ScaleContext to the cache and Capi", func() {
+            capi := &mockCapi{}
+            cache := &mockAppGuidCache{}
+            c := client.Client{Capi: capi, AppGuidCache: cache}
+
+            ctx := context.WithValue(context.Background(), contextKey{}, "lemons")
+            Expect(c.ScaleContext(ctx, "app-name", 1)).To(Succeed())
+            Expect(cache.ctx.Value(contextKey{})).To(Equal("lemons"))
+            Expect(capi.ctx.Value(contextKey{})).To(Equal("lemons"))
+        })
+
+        It("supports a Capi and AppGuidCache without context methods", func() {
+            capi := &mockCapi{}
+            cache := &mockAppGuidCache{}
+            c := client.Client{
+                Capi:         capiWithoutContext{capi},
+                AppGuidCache: cacheWithoutContext{cache},
+            }
+
+            ctx := context.WithValue(context.Background(), contextKey{}, "lemons")
+            Expect(c.ScaleContext(ctx, "app-name", 1)).To(Succeed())
+            Expect(cache.called).To(BeTrue())
+            Expect(capi.ctx.Value(contextKey{})).To(BeNil())
+        })
+
         DescribeTable("errors", func(modify func(*mockCapi, *mockAppGuidCache)) {
             capi := &mockCapi{
                 apps: []models.App{{Guid: "app-guid"}},
@@ -92,6 +120,35 @@ var _ = Describe("Client", func() {
         )
     })
 
+    Describe("ProcessStats()", func() {
+        It("returns the stats of the process", func() {
+            cache := &mockAppGuidCache{}
+            c := client.Client{
+                Oauth: &mockOauth{},
+                Capi: &mockCapi{
+                    stats: []models.ProcessStats{{Index: 0, State: "RUNNING"}},
+                },
+                AppGuidCache: cache,
+            }
+
+            stats, err := c.ProcessStats("app-name", "web")
+            Expect(err).ToNot(HaveOccurred())
+            Expect(stats).To(ConsistOf(models.ProcessStats{Index: 0, State: "RUNNING"}))
+            Expect(cache.called).To(BeTrue())
+        })
+
+        It("returns an error if capi returns an error", func() {
+            c := client.Client{
+                Oauth:        &mockOauth{},
+                Capi:         &mockCapi{statsErr: errors.New("expected")},
+                AppGuidCache: &mockAppGuidCache{},
+            }
+
+            _, err := c.ProcessStats("app-name", "web")
+            Expect(err).To(HaveOccurred())
+        })
+    })
+
     Describe("CreateTask()", func() {
         It("uses TryWithRefresh", func() {
             cache := &mockAppGuidCache{}
@@ -211,17 +268,271 @@ var _ = Describe("Client", func() {
             }),
         )
     })
+
+    Describe("Start()", func() {
+        It("starts the app", func() {
+            cache := &mockAppGuidCache{}
+            c := client.Client{
+                Oauth:        &mockOauth{},
+                Capi:         &mockCapi{},
+                AppGuidCache: cache,
+            }
+            Expect(c.Start("app-name")).To(Succeed())
+            Expect(cache.called).To(BeTrue())
+        })
+
+        DescribeTable("errors", func(modify func(*mockCapi, *mockAppGuidCache)) {
+            capi := &mockCapi{}
+            cache := &mockAppGuidCache{}
+            modify(capi, cache)
+
+            c := client.Client{
+                Oauth:        &mockOauth{},
+                Capi:         capi,
+                AppGuidCache: cache,
+            }
+
+            Expect(c.Start("lemons")).ToNot(Succeed())
+        },
+            Entry("TryWithRefresh returns an error", func(capi *mockCapi, cache *mockAppGuidCache) {
+                cache.tryErr = errors.New("expected")
+            }),
+            Entry("start returns an error", func(capi *mockCapi, cache *mockAppGuidCache) {
+                capi.startErr = errors.New("expected")
+            }),
+        )
+    })
+
+    Describe("Apps()", func() {
+        It("lists the apps in the space", func() {
+            capi := &mockCapi{
+                apps: []models.App{{Guid: "app-guid", Name: "app-name"}},
+            }
+            c := client.Client{
+                Oauth:     &mockOauth{},
+                Capi:      capi,
+                SpaceGuid: "space-guid",
+            }
+
+            apps, err := c.Apps()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(apps).To(ConsistOf(models.App{Guid: "app-guid", Name: "app-name"}))
+            Expect(capi.appsQuery).To(Equal(map[string]string{"space_guids": "space-guid"}))
+        })
+
+        It("returns an error if capi returns an error", func() {
+            c := client.Client{
+                Oauth: &mockOauth{},
+                Capi:  &mockCapi{appsErr: errors.New("expected")},
+            }
+
+            _, err := c.Apps()
+            Expect(err).To(HaveOccurred())
+        })
+    })
+
+    Describe("Tasks()", func() {
+        It("lists the tasks of the app", func() {
+            capi := &mockCapi{
+                tasks: []models.Task{{Guid: "task-guid", State: "RUNNING"}},
+            }
+            cache := &mockAppGuidCache{}
+            c := client.Client{
+                Oauth:        &mockOauth{},
+                Capi:         capi,
+                AppGuidCache: cache,
+            }
+
+            tasks, err := c.Tasks("app-name", map[string]string{"states": "RUNNING"})
+            Expect(err).ToNot(HaveOccurred())
+            Expect(tasks).To(ConsistOf(models.Task{Guid: "task-guid", State: "RUNNING"}))
+            Expect(capi.tasksQuery).To(Equal(map[string]string{"states": "RUNNING"}))
+            Expect(cache.called).To(BeTrue())
+        })
+
+        It("returns an error if capi returns an error", func() {
+            c := client.Client{
+                Oauth:        &mockOauth{},
+                Capi:         &mockCapi{tasksErr: errors.New("expected")},
+                AppGuidCache: &mockAppGuidCache{},
+            }
+
+            _, err := c.Tasks("app-name", nil)
+            Expect(err).To(HaveOccurred())
+        })
+    })
+
+    Describe("Root()", func() {
+        It("gets the root document", func() {
+            root := models.Root{Links: models.RootLinks{
+                LogCache: models.Link{Href: "https://log-cache.example.com"},
+            }}
+            c := client.Client{Capi: &mockCapi{root: root}}
+
+            Expect(c.Root()).To(Equal(root))
+        })
+
+        It("returns an error if capi does", func() {
+            c := client.Client{Capi: &mockCapi{infoErr: errors.New("expected")}}
+
+            _, err := c.Root()
+            Expect(err).To(HaveOccurred())
+        })
+    })
+
+    Describe("Info()", func() {
+        It("gets the info", func() {
+            c := client.Client{Capi: &mockCapi{info: models.Info{Build: "3.100.0"}}}
+
+            Expect(c.Info()).To(Equal(models.Info{Build: "3.100.0"}))
+        })
+
+        It("returns an error if capi does", func() {
+            c := client.Client{Capi: &mockCapi{infoErr: errors.New("expected")}}
+
+            _, err := c.Info()
+            Expect(err).To(HaveOccurred())
+        })
+    })
+
+    Describe("a Capi with only the original methods", func() {
+        It("returns ErrNotSupported for calls outside of Capi", func() {
+            c := client.Client{Capi: capiWithoutContext{&mockCapi{}}, AppGuidCache: &mockAppGuidCache{}}
+
+            _, err := c.Root()
+            Expect(err).To(MatchError(client.ErrNotSupported))
+            Expect(c.Start("app-name")).To(MatchError(client.ErrNotSupported))
+            _, err = c.DeleteApp("app-name")
+            Expect(err).To(MatchError(client.ErrNotSupported))
+        })
+
+        It("uses CapiExtended if it is implemented", func() {
+            capi := &mockCapi{info: models.Info{Build: "3.100.0"}}
+            c := client.Client{Capi: extendedCapiWithoutContext{capi, capi}}
+
+            Expect(c.Info()).To(Equal(models.Info{Build: "3.100.0"}))
+        })
+
+        It("is implemented by the CAPI client with every optional interface", func() {
+            c := client.New(client.Config{CloudControllerUrl: "https://api.example.com"})
+
+            _, ok := c.Capi.(client.CapiExtended)
+            Expect(ok).To(BeTrue())
+            _, ok = c.Capi.(client.CapiContext)
+            Expect(ok).To(BeTrue())
+        })
+    })
+
+    Describe("RequireScopes()", func() {
+        var jwt = "bearer header." + base64.RawURLEncoding.EncodeToString([]byte(
+            `{"scope": ["cloud_controller.read", "cloud_controller.write"], "user_name": "admin"}`,
+        )) + ".signature"
+
+        It("succeeds if the token has all the scopes", func() {
+            c := client.Client{Oauth: &mockOauth{token: jwt}}
+
+            Expect(c.RequireScopes("cloud_controller.read", "cloud_controller.write")).To(Succeed())
+
+            claims, err := c.Claims()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(claims.UserName).To(Equal("admin"))
+        })
+
+        It("returns an error listing the missing scopes", func() {
+            c := client.Client{Oauth: &mockOauth{token: jwt}}
+
+            err := c.RequireScopes("cloud_controller.write", "cloud_controller.admin", "uaa.user")
+            Expect(err).To(MatchError(ContainSubstring("cloud_controller.admin, uaa.user")))
+        })
+
+        DescribeTable("errors", func(oauth *mockOauth) {
+            c := client.Client{Oauth: oauth}
+            Expect(c.RequireScopes("cloud_controller.write")).ToNot(Succeed())
+        },
+            Entry("getting the token fails", &mockOauth{token: jwt, err: errors.New("expected")}),
+            Entry("the token is not a JWT", &mockOauth{token: "bearer lemons"}),
+        )
+    })
+
+    Describe("CreateTask() validation", func() {
+        It("requires a command", func() {
+            cache := &mockAppGuidCache{}
+            c := client.Client{
+                Oauth:        &mockOauth{},
+                Capi:         &mockCapi{},
+                AppGuidCache: cache,
+            }
+
+            _, err := c.CreateTask("app-name", "", models.TaskConfig{})
+            Expect(err).To(MatchError("task command is required"))
+            Expect(cache.called).To(BeFalse())
+        })
+    })
+
+    Describe("DeleteApp()", func() {
+        It("returns the job location", func() {
+            cache := &mockAppGuidCache{}
+            c := client.Client{
+                Oauth:        &mockOauth{},
+                Capi:         &mockCapi{jobLocation: "https://api.example.com/v3/jobs/job-guid"},
+                AppGuidCache: cache,
+            }
+
+            Expect(c.DeleteApp("app-name")).To(Equal("https://api.example.com/v3/jobs/job-guid"))
+            Expect(cache.called).To(BeTrue())
+        })
+
+        It("returns an error if the delete fails", func() {
+            c := client.Client{
+                Oauth:        &mockOauth{},
+                Capi:         &mockCapi{deleteErr: errors.New("expected")},
+                AppGuidCache: &mockAppGuidCache{},
+            }
+
+            _, err := c.DeleteApp("app-name")
+            Expect(err).To(HaveOccurred())
+        })
+    })
+
+    Describe("WaitForJob()", func() {
+        It("polls every second without a deadline by default", func() {
+            capi := &mockCapi{job: models.Job{State: models.JobComplete}}
+            c := client.Client{Capi: capi}
+
+            Expect(c.WaitForJob("job-guid", 0, 0)).To(Equal(models.Job{State: models.JobComplete}))
+            Expect(capi.pollInterval).To(Equal(time.Second))
+            Expect(capi.jobHasDeadline).To(BeFalse())
+        })
+
+        It("uses the given poll interval and timeout", func() {
+            capi := &mockCapi{jobErr: errors.New("expected")}
+            c := client.Client{Capi: capi}
+
+            _, err := c.WaitForJob("job-guid", time.Millisecond, time.Minute)
+            Expect(err).To(HaveOccurred())
+            Expect(capi.pollInterval).To(Equal(time.Millisecond))
+            Expect(capi.jobHasDeadline).To(BeTrue())
+        })
+    })
 })
 
 type mockOauth struct {
-    err error
+    token string
+    err   error
 }
 
 func (o *mockOauth) Token() (string, error) {
+    if o.token != "" {
+        return o.token, o.err
+    }
     return "bearer token", o.err
 }
 
 type mockCapi struct {
+    root    models.Root
+    info    models.Info
+    infoErr error
+
     apps    []models.App
     appsErr error
 
@@ -233,21 +544,52 @@ type mockCapi struct {
     taskErr  error
 
     taskCfg models.TaskConfig
+
+    appsQuery  map[string]string
+    stats      []models.ProcessStats
+    statsErr   error
+    startErr   error
+    tasks      []models.Task
+    tasksErr   error
+    tasksQuery map[string]string
+
+    jobLocation    string
+    deleteErr      error
+    job            models.Job
+    jobErr         error
+    pollInterval   time.Duration
+    jobHasDeadline bool
+
+    ctx context.Context
 }
 
-func (c *mockCapi) Apps(query map[string]string) ([]models.App, error) {
+func (c *mockCapi) RootContext(ctx context.Context) (models.Root, error) {
+    return c.root, c.infoErr
+}
+
+func (c *mockCapi) InfoContext(ctx context.Context) (models.Info, error) {
+    return c.info, c.infoErr
+}
+
+func (c *mockCapi) AppsContext(ctx context.Context, query map[string]string) ([]models.App, error) {
+    c.appsQuery = query
     return c.apps, c.appsErr
 }
 
-func (c *mockCapi) Process(appGuid, processType string) (models.Process, error) {
+func (c *mockCapi) ProcessContext(ctx context.Context, appGuid, processType string, opts ...models.HeaderOption) (models.Process, error) {
     return c.process, c.processErr
 }
 
-func (c *mockCapi) Scale(appGuid, processType string, instanceCount uint) error {
+func (c *mockCapi) ProcessStatsContext(ctx context.Context, appGuid, processType string, opts ...models.HeaderOption) ([]models.ProcessStats, error) {
+    return c.stats, c.statsErr
+}
+
+func (c *mockCapi) ScaleContext(ctx context.Context, appGuid, processType string, instanceCount uint, opts ...models.HeaderOption) error {
+    c.ctx = ctx
     return c.scaleErr
 }
 
-func (c *mockCapi) CreateTask(appGuid, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
+func (c *mockCapi) CreateTaskContext(ctx context.Context, appGuid, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
     for _, o := range opts {
         o(&http.Header{})
     }
@@ -255,17 +597,116 @@ func (c *mockCapi) CreateTask(appGuid, command string, cfg models.TaskConfig, op
     return models.Task{Guid: "task-guid"}, c.taskErr
 }
 
-func (c *mockCapi) Stop(appGuid string) error {
+func (c *mockCapi) StopContext(ctx context.Context, appGuid string, opts ...models.HeaderOption) error {
     return c.stopErr
 }
 
+func (c *mockCapi) StartContext(ctx context.Context, appGuid string, opts ...models.HeaderOption) error {
+    return c.startErr
+}
+
+func (c *mockCapi) TasksContext(ctx context.Context, appGuid string, query map[string]string) ([]models.Task, error) {
+    c.tasksQuery = query
+    return c.tasks, c.tasksErr
+}
+
+func (c *mockCapi) DeleteAppContext(ctx context.Context, appGuid string, opts ...models.HeaderOption) (string, error) {
+    return c.jobLocation, c.deleteErr
+}
+
+func (c *mockCapi) JobContext(ctx context.Context, location string) (models.Job, error) {
+    return c.job, c.jobErr
+}
+
+func (c *mockCapi) WaitForJobContext(ctx context.Context, location string, pollInterval time.Duration) (models.Job, error) {
+    c.pollInterval = pollInterval
+    _, hasDeadline := ctx.Deadline()
+    c.jobHasDeadline = hasDeadline
+    return c.job, c.jobErr
+}
+
+func (c *mockCapi) Root() (models.Root, error) {
+    return c.RootContext(context.Background())
+}
+
+func (c *mockCapi) Info() (models.Info, error) {
+    return c.InfoContext(context.Background())
+}
+
+func (c *mockCapi) Apps(query map[string]string) ([]models.App, error) {
+    return c.AppsContext(context.Background(), query)
+}
+
+func (c *mockCapi) Process(appGuid, processType string) (models.Process, error) {
+    return c.ProcessContext(context.Background(), appGuid, processType)
+}
+
+func (c *mockCapi) ProcessStats(appGuid, processType string) ([]models.ProcessStats, error) {
+    return c.ProcessStatsContext(context.Background(), appGuid, processType)
+}
+
+func (c *mockCapi) Scale(appGuid, processType string, instanceCount uint) error {
+    return c.ScaleContext(context.Background(), appGuid, processType, instanceCount)
+}
+
+func (c *mockCapi) CreateTask(appGuid, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
+    return c.CreateTaskContext(context.Background(), appGuid, command, cfg, opts...)
+}
+
+func (c *mockCapi) Stop(appGuid string) error {
+    return c.StopContext(context.Background(), appGuid)
+}
+
+func (c *mockCapi) Start(appGuid string) error {
+    return c.StartContext(context.Background(), appGuid)
+}
+
+func (c *mockCapi) Tasks(appGuid string, query map[string]string) ([]models.Task, error) {
+    return c.TasksContext(context.Background(), appGuid, query)
+}
+
+func (c *mockCapi) DeleteApp(appGuid string) (string, error) {
+    return c.DeleteAppContext(context.Background(), appGuid)
+}
+
+func (c *mockCapi) Job(location string) (models.Job, error) {
+    return c.JobContext(context.Background(), location)
+}
+
+func (c *mockCapi) WaitForJob(location string, pollInterval time.Duration) (models.Job, error) {
+    return c.WaitForJobContext(context.Background(), location, pollInterval)
+}
+
+type contextKey struct{}
+
+// capiWithoutContext and cacheWithoutContext hide the context methods, like
+// implementations written before they existed
+type capiWithoutContext struct {
+    client.Capi
+}
+
+type extendedCapiWithoutContext struct {
+    client.Capi
+    client.CapiExtended
+}
+
+type cacheWithoutContext struct {
+    client.AppGuidCache
+}
+
 type mockAppGuidCache struct {
     called bool
     tryErr error
+    ctx    context.Context
 }
 
 func (c *mockAppGuidCache) TryWithRefresh(appName string, f func(appGuid string) error) error {
+    return c.TryWithRefreshContext(context.Background(), appName, f)
+}
+
+func (c *mockAppGuidCache) TryWithRefreshContext(ctx context.Context, appName string, f func(appGuid string) error) error {
     c.called = true
+    c.ctx = ctx
     err := f("app-guid")
     if c.tryErr != nil {
         return c.tryErr
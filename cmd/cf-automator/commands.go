@@ -0,0 +1,205 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "strconv"
+    "strings"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+)
+
+// command runs a subcommand with the arguments that follow its name. It
+// returns errUsage if the arguments are malformed.
+type command func(c *client.Client, args []string, out *printer) error
+
+var commands = map[string]command{
+    "apps":    appsCommand,
+    "process": processCommand,
+    "scale":   scaleCommand,
+    "start":   startCommand,
+    "stop":    stopCommand,
+    "task":    taskCommand,
+}
+
+type appResult struct {
+    App       string `json:"app"`
+    State     string `json:"state,omitempty"`
+    Instances *uint  `json:"instances,omitempty"`
+}
+
+func appsCommand(c *client.Client, args []string, out *printer) error {
+    if len(args) != 0 {
+        return errUsage
+    }
+
+    apps, err := c.Apps()
+    if err != nil {
+        return err
+    }
+    if apps == nil {
+        apps = []models.App{}
+    }
+
+    return out.print(apps, func(w io.Writer) {
+        fmt.Fprintln(w, "NAME\tSTATE\tGUID")
+        for _, a := range apps {
+            fmt.Fprintf(w, "%s\t%s\t%s\n", a.Name, a.State, a.Guid)
+        }
+    })
+}
+
+func processCommand(c *client.Client, args []string, out *printer) error {
+    if len(args) < 1 || len(args) > 2 {
+        return errUsage
+    }
+    app := args[0]
+    processType := "web"
+    if len(args) == 2 {
+        processType = args[1]
+    }
+
+    proc, err := c.Process(app, processType)
+    if err != nil {
+        return err
+    }
+
+    result := struct {
+        App       string `json:"app"`
+        Type      string `json:"type"`
+        Instances int    `json:"instances"`
+    }{app, processType, proc.Instances}
+
+    return out.print(result, func(w io.Writer) {
+        fmt.Fprintf(w, "%s %s: %d instances\n", app, processType, proc.Instances)
+    })
+}
+
+func scaleCommand(c *client.Client, args []string, out *printer) error {
+    if len(args) != 2 {
+        return errUsage
+    }
+    app := args[0]
+
+    instances, err := strconv.ParseUint(args[1], 10, 32)
+    if err != nil {
+        return fmt.Errorf("invalid instance count %q", args[1])
+    }
+    n := uint(instances)
+
+    err = c.Scale(app, n)
+    if err != nil {
+        return err
+    }
+
+    return out.print(appResult{App: app, Instances: &n}, func(w io.Writer) {
+        fmt.Fprintf(w, "scaled %s to %d instances\n", app, n)
+    })
+}
+
+func startCommand(c *client.Client, args []string, out *printer) error {
+    if len(args) != 1 {
+        return errUsage
+    }
+    app := args[0]
+
+    err := c.Start(app)
+    if err != nil {
+        return err
+    }
+
+    return out.print(appResult{App: app, State: "STARTED"}, func(w io.Writer) {
+        fmt.Fprintf(w, "started %s\n", app)
+    })
+}
+
+func stopCommand(c *client.Client, args []string, out *printer) error {
+    if len(args) != 1 {
+        return errUsage
+    }
+    app := args[0]
+
+    err := c.Stop(app)
+    if err != nil {
+        return err
+    }
+
+    return out.print(appResult{App: app, State: "STOPPED"}, func(w io.Writer) {
+        fmt.Fprintf(w, "stopped %s\n", app)
+    })
+}
+
+func taskCommand(c *client.Client, args []string, out *printer) error {
+    if len(args) == 0 {
+        return errUsage
+    }
+
+    switch args[0] {
+    case "run":
+        return taskRunCommand(c, args[1:], out)
+    case "list":
+        return taskListCommand(c, args[1:], out)
+    }
+
+    return errUsage
+}
+
+func taskRunCommand(c *client.Client, args []string, out *printer) error {
+    var cfg models.TaskConfig
+    flags := newFlagSet("task run")
+    flags.StringVar(&cfg.Name, "name", "", "task name")
+    flags.UintVar(&cfg.MemoryInMB, "memory", 0, "memory limit in MB")
+    flags.UintVar(&cfg.DiskInMB, "disk", 0, "disk limit in MB")
+    if flags.Parse(args) != nil || flags.NArg() < 2 {
+        return errUsage
+    }
+    app := flags.Arg(0)
+
+    task, err := c.CreateTask(app, strings.Join(flags.Args()[1:], " "), cfg)
+    if err != nil {
+        return err
+    }
+
+    return out.print(task, func(w io.Writer) {
+        fmt.Fprintf(w, "started task %s on %s\n", task.Guid, app)
+    })
+}
+
+func taskListCommand(c *client.Client, args []string, out *printer) error {
+    flags := newFlagSet("task list")
+    state := flags.String("state", "", "only list tasks in this state, e.g. RUNNING")
+    if flags.Parse(args) != nil || flags.NArg() != 1 {
+        return errUsage
+    }
+
+    query := map[string]string{}
+    if *state != "" {
+        query["states"] = strings.ToUpper(*state)
+    }
+
+    tasks, err := c.Tasks(flags.Arg(0), query)
+    if err != nil {
+        return err
+    }
+    if tasks == nil {
+        tasks = []models.Task{}
+    }
+
+    return out.print(tasks, func(w io.Writer) {
+        fmt.Fprintln(w, "ID\tNAME\tSTATE\tCOMMAND")
+        for _, t := range tasks {
+            fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", t.SequenceID, t.Name, t.State, t.Command)
+        }
+    })
+}
+
+// newFlagSet returns a flag set for a subcommand. Its errors are reported
+// through errUsage, so it prints nothing itself.
+func newFlagSet(name string) *flag.FlagSet {
+    flags := flag.NewFlagSet(name, flag.ContinueOnError)
+    flags.SetOutput(ioutil.Discard)
+    return flags
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+    "crypto/tls"
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+)
+
+const defaultTimeout = 15 * time.Second
+
+// loadConfig builds the client config from the flags if --api is set, from
+// the VCAP variables when running on Cloud Foundry, and from the cf CLI's
+// config otherwise. Flags that are set override the VCAP and cf CLI values.
+func loadConfig(opts options) (client.Config, error) {
+    cfg, err := baseConfig(opts)
+    if err != nil {
+        return client.Config{}, err
+    }
+
+    applyCredentials(&cfg, opts)
+    if opts.skipSslValidation {
+        cfg.TLSConfig = skipSslValidation(cfg.TLSConfig)
+    }
+
+    if opts.space != "" {
+        cfg.SpaceGuid = opts.space
+    }
+    if opts.oauthUrl != "" {
+        cfg.OauthUrl = opts.oauthUrl
+    }
+    if opts.timeout > 0 {
+        cfg.HttpTimeout = opts.timeout
+    }
+    cfg.DryRun = opts.dryRun
+
+    if cfg.SpaceGuid == "" {
+        return client.Config{}, fmt.Errorf("no space given, set --space or CF_SPACE_GUID")
+    }
+
+    return cfg, nil
+}
+
+func baseConfig(opts options) (client.Config, error) {
+    if opts.api != "" {
+        tlsConfig, err := client.TLSOptions{}.TLSConfig()
+        if err != nil {
+            return client.Config{}, err
+        }
+
+        return client.Config{
+            CloudControllerUrl: opts.api,
+            TLSConfig:          tlsConfig,
+            HttpTimeout:        defaultTimeout,
+        }, nil
+    }
+
+    if _, ok := os.LookupEnv("VCAP_APPLICATION"); ok {
+        return client.ConfigFromEnv()
+    }
+
+    cfCfg, err := client.LoadCfConfig()
+    if err != nil {
+        return client.Config{}, fmt.Errorf("no foundation configured, set --api or run 'cf login': %s", err)
+    }
+
+    return client.ConfigFromCfConfig(cfCfg)
+}
+
+// applyCredentials replaces the credentials of cfg with the user or client
+// given by the flags. The tokens of the cf CLI are dropped as they would be
+// used instead.
+func applyCredentials(cfg *client.Config, opts options) {
+    if opts.username == "" && opts.client == "" {
+        return
+    }
+
+    cfg.AccessToken = ""
+    cfg.RefreshToken = ""
+    cfg.Username = opts.username
+    cfg.Password = opts.password
+    if opts.client != "" {
+        cfg.Client = opts.client
+        cfg.ClientSecret = opts.clientSecret
+    }
+}
+
+func skipSslValidation(cfg *tls.Config) *tls.Config {
+    if cfg == nil {
+        return &tls.Config{InsecureSkipVerify: true}
+    }
+
+    cfg = cfg.Clone()
+    cfg.InsecureSkipVerify = true
+    return cfg
+}
@@ -0,0 +1,139 @@
+// Command cf-automator scales, starts, stops and runs tasks on the apps of a
+// Cloud Foundry space.
+//
+//    cf-automator [flags] <command> [args]
+//
+// The foundation is taken from the flags, or their CF_* environment
+// variables, if --api is set. Otherwise the VCAP variables read by
+// client.LoadEnv are used when running on Cloud Foundry, and the cf CLI's
+// config when they are absent. The credential, space, UAA, TLS and timeout
+// flags override the VCAP and cf CLI values in every mode. Prefer
+// CF_PASSWORD and CF_CLIENT_SECRET to their flags, which other users can see
+// in the process list.
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+)
+
+type options struct {
+    api               string
+    space             string
+    username          string
+    password          string
+    client            string
+    clientSecret      string
+    oauthUrl          string
+    skipSslValidation bool
+    timeout           time.Duration
+    json              bool
+    dryRun            bool
+}
+
+const usage = `Usage: cf-automator [flags] <command> [args]
+
+Commands:
+  apps                                   list the apps in the space
+  process <app> [type]                   show the instances of a process, web by default
+  scale <app> <instances>                scale the web process
+  start <app>                            start an app
+  stop <app>                             stop an app
+  task run [-name n] [-memory mb] [-disk mb] <app> <command>
+                                         run a task
+  task list [-state s] <app>             list the tasks of an app
+
+The foundation is set by --api, by the VCAP variables on Cloud Foundry or by
+the cf CLI's config, in that order. The other flags apply in every case.
+
+Flags:
+`
+
+// errUsage is returned for malformed command lines, which exit with 2
+var errUsage = errors.New("usage")
+
+func main() {
+    os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+    var opts options
+    flags := flag.NewFlagSet("cf-automator", flag.ContinueOnError)
+    flags.SetOutput(stderr)
+    flags.Usage = func() {
+        fmt.Fprint(stderr, usage)
+        flags.PrintDefaults()
+    }
+
+    flags.StringVar(&opts.api, "api", os.Getenv("CF_API"), "Cloud Controller url (CF_API)")
+    flags.StringVar(&opts.space, "space", os.Getenv("CF_SPACE_GUID"), "guid of the space (CF_SPACE_GUID)")
+    flags.StringVar(&opts.username, "username", os.Getenv("CF_USERNAME"), "UAA username (CF_USERNAME)")
+    flags.StringVar(&opts.password, "password", "", "UAA password, visible to other users as a flag, prefer CF_PASSWORD")
+    flags.StringVar(&opts.client, "client", os.Getenv("CF_CLIENT"), "UAA client (CF_CLIENT)")
+    flags.StringVar(&opts.clientSecret, "client-secret", "", "UAA client secret, visible to other users as a flag, prefer CF_CLIENT_SECRET")
+    flags.StringVar(&opts.oauthUrl, "uaa-url", os.Getenv("CF_UAA_URL"), "UAA url, discovered from the Cloud Controller if empty (CF_UAA_URL)")
+    flags.BoolVar(&opts.skipSslValidation, "skip-ssl-validation", os.Getenv("CF_SKIP_SSL_VALIDATION") == "true", "skip TLS certificate validation (CF_SKIP_SSL_VALIDATION)")
+    flags.DurationVar(&opts.timeout, "timeout", 0, "HTTP timeout, 15s unless set by the environment")
+    flags.BoolVar(&opts.json, "json", false, "print JSON instead of text")
+    flags.BoolVar(&opts.dryRun, "dry-run", false, "print mutating requests instead of sending them")
+
+    err := flags.Parse(args)
+    if err == flag.ErrHelp {
+        return 0
+    }
+    if err != nil {
+        return 2
+    }
+
+    // the secrets are not the flags' defaults, which the usage would print
+    if opts.password == "" {
+        opts.password = os.Getenv("CF_PASSWORD")
+    }
+    if opts.clientSecret == "" {
+        opts.clientSecret = os.Getenv("CF_CLIENT_SECRET")
+    }
+
+    if flags.NArg() == 0 {
+        flags.Usage()
+        return 2
+    }
+
+    cmd, ok := commands[flags.Arg(0)]
+    if !ok {
+        fmt.Fprintf(stderr, "cf-automator: unknown command %q\n", flags.Arg(0))
+        flags.Usage()
+        return 2
+    }
+
+    cfg, err := loadConfig(opts)
+    if err != nil {
+        fmt.Fprintf(stderr, "cf-automator: %s\n", err)
+        return 1
+    }
+
+    out := newPrinter(stdout, opts.json)
+    err = cmd(client.New(cfg), flags.Args()[1:], out)
+
+    // in dry run mode the request that was not sent replaces the output of
+    // the command, which would report a change that did not happen
+    var dryRun *client.DryRunError
+    if errors.As(err, &dryRun) {
+        err = out.dryRun(dryRun.Request)
+    }
+    if err == errUsage {
+        flags.Usage()
+        return 2
+    }
+    if err != nil {
+        fmt.Fprintf(stderr, "cf-automator: %s\n", err)
+        return 1
+    }
+
+    return 0
+}
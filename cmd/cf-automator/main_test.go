@@ -0,0 +1,211 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+
+    "github.com/pivotal-cf/app-automator-cf-client/cftest"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("cf-automator", func() {
+    var (
+        server         *cftest.Server
+        lemons         cftest.App
+        stdout, stderr *bytes.Buffer
+    )
+
+    BeforeEach(func() {
+        server = cftest.NewServer()
+        lemons = server.AddApp(cftest.App{Name: "lemons"})
+        server.AddApp(cftest.App{Name: "limes", State: "STOPPED"})
+        server.AddApp(cftest.App{Name: "oranges", SpaceGuid: "other-space"})
+
+        stdout = &bytes.Buffer{}
+        stderr = &bytes.Buffer{}
+    })
+
+    AfterEach(func() {
+        server.Close()
+    })
+
+    automator := func(args ...string) int {
+        flags := []string{
+            "--api", server.URL,
+            "--space", cftest.SpaceGuid,
+            "--username", cftest.Username,
+            "--password", cftest.Password,
+        }
+        return run(append(flags, args...), stdout, stderr)
+    }
+
+    It("lists the apps in the space", func() {
+        Expect(automator("apps")).To(Equal(0))
+
+        Expect(stdout.String()).To(ContainSubstring("lemons  STARTED  " + lemons.Guid))
+        Expect(stdout.String()).To(ContainSubstring("limes   STOPPED"))
+        Expect(stdout.String()).ToNot(ContainSubstring("oranges"))
+    })
+
+    It("prints JSON with --json", func() {
+        Expect(automator("--json", "apps")).To(Equal(0))
+
+        var apps []map[string]string
+        Expect(json.Unmarshal(stdout.Bytes(), &apps)).To(Succeed())
+        Expect(apps).To(ContainElement(HaveKeyWithValue("name", "lemons")))
+        Expect(apps).To(HaveLen(2))
+    })
+
+    It("scales an app and shows its process", func() {
+        Expect(automator("scale", "lemons", "3")).To(Equal(0))
+        Expect(stdout.String()).To(Equal("scaled lemons to 3 instances\n"))
+
+        stdout.Reset()
+        Expect(automator("--json", "process", "lemons", "web")).To(Equal(0))
+        Expect(stdout.String()).To(MatchJSON(`{"app": "lemons", "type": "web", "instances": 3}`))
+    })
+
+    It("starts and stops apps", func() {
+        Expect(automator("stop", "lemons")).To(Equal(0))
+        app, _ := server.App("lemons")
+        Expect(app.State).To(Equal("STOPPED"))
+
+        Expect(automator("--json", "start", "lemons")).To(Equal(0))
+        app, _ = server.App("lemons")
+        Expect(app.State).To(Equal("STARTED"))
+        Expect(stdout.String()).To(ContainSubstring(`"state": "STARTED"`))
+    })
+
+    It("runs and lists tasks", func() {
+        Expect(automator("task", "run", "-name", "migrate", "-memory", "256", "lemons", "rake", "db:migrate")).To(Equal(0))
+
+        tasks := server.Tasks(lemons.Guid)
+        Expect(tasks).To(HaveLen(1))
+        Expect(tasks[0].Name).To(Equal("migrate"))
+        Expect(tasks[0].Command).To(Equal("rake db:migrate"))
+        Expect(tasks[0].MemoryInMB).To(BeEquivalentTo(256))
+
+        server.AddTask(cftest.Task{AppGuid: lemons.Guid, Name: "backup", State: "SUCCEEDED"})
+
+        stdout.Reset()
+        Expect(automator("task", "list", "-state", "running", "lemons")).To(Equal(0))
+        Expect(stdout.String()).To(ContainSubstring("migrate"))
+        Expect(stdout.String()).ToNot(ContainSubstring("backup"))
+    })
+
+    It("prints mutating requests instead of sending them with --dry-run", func() {
+        Expect(automator("--dry-run", "--json", "scale", "lemons", "5")).To(Equal(0))
+
+        Expect(stdout.String()).To(ContainSubstring(`"dry_run": true`))
+        Expect(stdout.String()).To(ContainSubstring(`"method": "POST"`))
+        for _, r := range server.Requests() {
+            Expect(r.Path).ToNot(HaveSuffix("/actions/scale"))
+        }
+        p, _ := server.Process(lemons.Guid, "web")
+        Expect(p.Instances).To(Equal(1))
+    })
+
+    It("prints the output of read-only commands with --dry-run", func() {
+        Expect(automator("--dry-run", "apps")).To(Equal(0))
+        Expect(stdout.String()).To(ContainSubstring("lemons"))
+        Expect(stdout.String()).ToNot(ContainSubstring("would send"))
+    })
+
+    It("fails when CAPI returns an error", func() {
+        Expect(automator("scale", "mangoes", "2")).To(Equal(1))
+        Expect(stderr.String()).To(ContainSubstring("cf-automator:"))
+    })
+
+    DescribeTable("usage errors",
+        func(args ...string) {
+            Expect(automator(args...)).To(Equal(2))
+            Expect(stderr.String()).To(ContainSubstring("Usage: cf-automator"))
+        },
+        Entry("no command"),
+        Entry("unknown command", "lemons"),
+        Entry("missing instances", "scale", "lemons"),
+        Entry("unknown task subcommand", "task", "cancel", "lemons"),
+        Entry("task without command", "task", "run", "lemons"),
+        Entry("process with extra arguments", "process", "lemons", "web", "worker"),
+    )
+
+    Describe("secrets in the environment", func() {
+        var oldPassword, oldClientSecret string
+
+        BeforeEach(func() {
+            oldPassword = os.Getenv("CF_PASSWORD")
+            oldClientSecret = os.Getenv("CF_CLIENT_SECRET")
+            os.Setenv("CF_PASSWORD", cftest.Password)
+            os.Setenv("CF_CLIENT_SECRET", "s3cr3t")
+        })
+
+        AfterEach(func() {
+            os.Setenv("CF_PASSWORD", oldPassword)
+            os.Setenv("CF_CLIENT_SECRET", oldClientSecret)
+        })
+
+        It("does not print them in the usage", func() {
+            Expect(run([]string{"bogus"}, stdout, stderr)).To(Equal(2))
+            Expect(stderr.String()).To(ContainSubstring("Usage: cf-automator"))
+            Expect(stderr.String()).ToNot(ContainSubstring(cftest.Password))
+            Expect(stderr.String()).ToNot(ContainSubstring("s3cr3t"))
+        })
+
+        It("uses them when the flags are not set", func() {
+            args := []string{"--api", server.URL, "--space", cftest.SpaceGuid, "--username", cftest.Username, "apps"}
+            Expect(run(args, stdout, stderr)).To(Equal(0), stderr.String())
+            Expect(stdout.String()).To(ContainSubstring("lemons"))
+        })
+    })
+
+    It("requires a space", func() {
+        code := run([]string{"--api", server.URL, "--space", "", "apps"}, stdout, stderr)
+        Expect(code).To(Equal(1))
+        Expect(stderr.String()).To(ContainSubstring("no space given"))
+    })
+
+    Describe("without --api", func() {
+        var oldHome string
+
+        BeforeEach(func() {
+            home, err := ioutil.TempDir("", "cf-home")
+            Expect(err).ToNot(HaveOccurred())
+            Expect(os.MkdirAll(filepath.Join(home, ".cf"), 0700)).To(Succeed())
+
+            cfCfg, err := json.Marshal(map[string]interface{}{
+                "Target":       server.URL,
+                "RefreshToken": "expired-refresh-token",
+                "SpaceFields":  map[string]string{"GUID": cftest.SpaceGuid},
+            })
+            Expect(err).ToNot(HaveOccurred())
+            Expect(ioutil.WriteFile(filepath.Join(home, ".cf", "config.json"), cfCfg, 0600)).To(Succeed())
+
+            oldHome = os.Getenv("CF_HOME")
+            os.Setenv("CF_HOME", home)
+        })
+
+        AfterEach(func() {
+            os.RemoveAll(os.Getenv("CF_HOME"))
+            os.Setenv("CF_HOME", oldHome)
+        })
+
+        It("uses the credential flags instead of the cf CLI's tokens", func() {
+            args := []string{"--username", cftest.Username, "--password", cftest.Password, "apps"}
+            Expect(run(args, stdout, stderr)).To(Equal(0), stderr.String())
+            Expect(stdout.String()).To(ContainSubstring("lemons"))
+        })
+
+        It("applies --skip-ssl-validation", func() {
+            cfg, err := loadConfig(options{skipSslValidation: true})
+            Expect(err).ToNot(HaveOccurred())
+            Expect(cfg.TLSConfig.InsecureSkipVerify).To(BeTrue())
+            Expect(cfg.RefreshToken).To(Equal("expired-refresh-token"))
+        })
+    })
+})
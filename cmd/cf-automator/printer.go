@@ -0,0 +1,49 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "text/tabwriter"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+)
+
+// printer writes command results either as indented JSON or as text aligned
+// in columns
+type printer struct {
+    w    io.Writer
+    json bool
+}
+
+func newPrinter(w io.Writer, json bool) *printer {
+    return &printer{w: w, json: json}
+}
+
+func (p *printer) print(v interface{}, text func(w io.Writer)) error {
+    if p.json {
+        enc := json.NewEncoder(p.w)
+        enc.SetIndent("", "  ")
+        return enc.Encode(v)
+    }
+
+    tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+    text(tw)
+    return tw.Flush()
+}
+
+func (p *printer) dryRun(r client.DryRunRequest) error {
+    result := struct {
+        DryRun bool   `json:"dry_run"`
+        Method string `json:"method"`
+        URL    string `json:"url"`
+        Body   string `json:"body,omitempty"`
+    }{true, r.Method, r.URL, r.Body}
+
+    return p.print(result, func(w io.Writer) {
+        fmt.Fprintf(w, "would send %s %s\n", r.Method, r.URL)
+        if r.Body != "" {
+            fmt.Fprintln(w, r.Body)
+        }
+    })
+}
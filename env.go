@@ -1,8 +1,16 @@
 package client
 
 import (
+    "crypto/tls"
     "encoding/json"
+    "fmt"
     "log"
+    "net/url"
+    "os"
+    "reflect"
+    "sort"
+    "strings"
+    "sync"
     "time"
 
     "code.cloudfoundry.org/go-envstruct"
@@ -10,10 +18,32 @@ import (
 
 type environment struct {
     CloudControllerApi string          `env:"API_URL"`
+    CredentialsService string          `env:"CREDENTIALS_SERVICE"`
+    OauthUrl           string          `env:"UAA_URL"`
     HttpTimeout        time.Duration   `env:"HTTP_TIMEOUT"`
+    ProxyUrl           string          `env:"PROXY_URL"`
+    CapiProxyUrl       string          `env:"CAPI_PROXY_URL"`
+    UaaProxyUrl        string          `env:"UAA_PROXY_URL"`
+    RateLimit          float64         `env:"RATE_LIMIT"`
+    RateLimitBurst     int             `env:"RATE_LIMIT_BURST"`
+    BreakerThreshold   int             `env:"CIRCUIT_BREAKER_THRESHOLD"`
+    BreakerCooldown    time.Duration   `env:"CIRCUIT_BREAKER_COOLDOWN"`
     SkipSslValidation  bool            `env:"SKIP_SSL_VALIDATION"`
+    CACert             string          `env:"CA_CERT"`
+    ClientCert         string          `env:"CLIENT_CERT"`
+    ClientKey          string          `env:"CLIENT_KEY"`
+    MinTLSVersion      string          `env:"MIN_TLS_VERSION"`
+    InstanceCert       string          `env:"CF_INSTANCE_CERT"`
+    InstanceKey        string          `env:"CF_INSTANCE_KEY"`
     VcapApplication    VcapApplication `env:"VCAP_APPLICATION, required"`
     VcapServices       VcapServices    `env:"VCAP_SERVICES, required"`
+
+    // tlsConfig and the proxies are built from their variables while
+    // loading, so that invalid ones are reported along with the others
+    tlsConfig *tls.Config
+    proxy     *url.URL
+    capiProxy *url.URL
+    uaaProxy  *url.URL
 }
 
 // VcapApplication is information provided by the Cloud Foundry runtime
@@ -27,52 +57,314 @@ func (v *VcapApplication) UnmarshalEnv(data string) error {
     return json.Unmarshal([]byte(data), v)
 }
 
-type userProvided struct {
-    InstanceName string            `json:"instance_name"`;
-    Credentials  map[string]string `json:"credentials"`
+// VcapService is a single service binding in VCAP_SERVICES
+type VcapService struct {
+    Name         string                 `json:"name"`
+    InstanceName string                 `json:"instance_name"`
+    Label        string                 `json:"label"`
+    Tags         []string               `json:"tags"`
+    Credentials  map[string]interface{} `json:"credentials"`
 }
 
 // VcapServices is information provided by the Cloud Foundry runtime
 type VcapServices struct {
-    Credhub []struct {
-        Credentials map[string]string `json:"credentials"`
-    } `json:"credhub"`
-    UserProvided []userProvided `json:"user-provided"`
+    Credhub      []VcapService `json:"credhub"`
+    UserProvided []VcapService `json:"user-provided"`
+
+    // Services holds every binding keyed by service label
+    Services map[string][]VcapService `json:"-"`
 }
 
 // UnmarshalEnv decodes a VcapServices for envstruct.Load
 func (v *VcapServices) UnmarshalEnv(data string) error {
-    if data == "" {
-        return nil
+    err := json.Unmarshal([]byte(data), &v.Services)
+    if err != nil {
+        return err
     }
 
-    return json.Unmarshal([]byte(data), v)
+    v.Credhub = v.Services["credhub"]
+    v.UserProvided = v.Services["user-provided"]
+    return nil
 }
 
-// LoadEnv instantiates an Environment via envstruct
+// LoadEnv instantiates an Environment via envstruct and exits if it is invalid
 func LoadEnv() environment {
-    env := environment{
-        HttpTimeout: 15 * time.Second,
-    }
-
-    err := envstruct.Load(&env)
+    env, err := LoadEnvironment()
     if err != nil {
         log.Fatalf("unable to load environment: %s", err)
     }
 
+    return env
+}
+
+// LoadEnvironment instantiates an Environment from the process environment
+func LoadEnvironment() (environment, error) {
+    envMu.Lock()
+    defer envMu.Unlock()
+
+    return loadEnvironment()
+}
+
+// LoadEnvironmentFrom instantiates an Environment from the given variables
+// instead of the process environment
+func LoadEnvironmentFrom(vars map[string]string) (environment, error) {
+    envMu.Lock()
+    defer envMu.Unlock()
+
+    restore := swapEnv(vars)
+    defer restore()
+    return loadEnvironment()
+}
+
+// envMu serializes loading, as envstruct only reads the process environment
+// and LoadEnvironmentFrom swaps its variables into it while it loads
+var envMu sync.Mutex
+
+// EnvironmentError lists every variable that is missing or could not be
+// parsed, including TLS certificates and keys that could not be loaded and
+// proxy urls without a supported scheme or host
+type EnvironmentError struct {
+    Missing   []string
+    Malformed []string
+}
+
+func (e *EnvironmentError) Error() string {
+    var problems []string
+    if len(e.Missing) > 0 {
+        problems = append(problems, "missing required variables: "+strings.Join(e.Missing, ", "))
+    }
+    if len(e.Malformed) > 0 {
+        problems = append(problems, "malformed variables: "+strings.Join(e.Malformed, "; "))
+    }
+
+    return strings.Join(problems, "; ")
+}
+
+func (e *EnvironmentError) malformed(name string, err error) {
+    e.Malformed = append(e.Malformed, fmt.Sprintf("%s: %s", name, err))
+}
+
+func loadEnvironment() (environment, error) {
+    env := environment{
+        HttpTimeout:        defaultHttpTimeout,
+        CredentialsService: "pvtl-app-automator-credentials",
+    }
+
+    envErr := &EnvironmentError{}
+    loadEnvFields(&env, envErr)
+
     if env.CloudControllerApi == "" {
         env.CloudControllerApi = env.VcapApplication.CfApi
     }
 
-    return env
+    clientCertVars := "CLIENT_CERT and CLIENT_KEY"
+    if env.ClientCert == "" && env.ClientKey == "" {
+        env.ClientCert = env.InstanceCert
+        env.ClientKey = env.InstanceKey
+        clientCertVars = "CF_INSTANCE_CERT and CF_INSTANCE_KEY"
+    }
+    env.tlsConfig = loadTLSConfig(env, clientCertVars, envErr)
+    env.proxy = loadProxyURL("PROXY_URL", env.ProxyUrl, envErr)
+    env.capiProxy = loadProxyURL("CAPI_PROXY_URL", env.CapiProxyUrl, envErr)
+    env.uaaProxy = loadProxyURL("UAA_PROXY_URL", env.UaaProxyUrl, envErr)
+
+    if len(envErr.Missing) > 0 || len(envErr.Malformed) > 0 {
+        return environment{}, envErr
+    }
+
+    return env, nil
+}
+
+// loadEnvFields loads the tagged fields of env one at a time with envstruct,
+// so that every missing or malformed variable is reported instead of only
+// the first
+func loadEnvFields(env *environment, envErr *EnvironmentError) {
+    value := reflect.ValueOf(env).Elem()
+    for i := 0; i < value.NumField(); i++ {
+        field := value.Type().Field(i)
+        tag := field.Tag.Get("env")
+        if tag == "" {
+            continue
+        }
+
+        name := envName(tag)
+        if os.Getenv(name) == "" {
+            if strings.Contains(tag, "required") {
+                envErr.Missing = append(envErr.Missing, name)
+            }
+            continue
+        }
+
+        single := reflect.New(reflect.StructOf([]reflect.StructField{field}))
+        err := envstruct.Load(single.Interface())
+        if err != nil {
+            envErr.malformed(name, err)
+            continue
+        }
+        value.Field(i).Set(single.Elem().Field(0))
+    }
+}
+
+// swapEnv sets the variables of environment to the given ones, unsetting
+// those that are not given, and returns a func that restores them
+func swapEnv(vars map[string]string) func() {
+    t := reflect.TypeOf(environment{})
+    previous := map[string]*string{}
+    for i := 0; i < t.NumField(); i++ {
+        tag := t.Field(i).Tag.Get("env")
+        if tag == "" {
+            continue
+        }
+
+        name := envName(tag)
+        if old, ok := os.LookupEnv(name); ok {
+            previous[name] = &old
+        } else {
+            previous[name] = nil
+        }
+
+        if value, ok := vars[name]; ok {
+            os.Setenv(name, value)
+        } else {
+            os.Unsetenv(name)
+        }
+    }
+
+    return func() {
+        for name, old := range previous {
+            if old == nil {
+                os.Unsetenv(name)
+                continue
+            }
+            os.Setenv(name, *old)
+        }
+    }
+}
+
+func envName(tag string) string {
+    return strings.TrimSpace(strings.Split(tag, ",")[0])
+}
+
+// loadTLSConfig builds the TLS configuration, adding the variables that are
+// invalid to envErr
+func loadTLSConfig(env environment, clientCertVars string, envErr *EnvironmentError) *tls.Config {
+    minVersion, err := parseTLSVersion(env.MinTLSVersion)
+    if err != nil {
+        envErr.malformed("MIN_TLS_VERSION", err)
+    }
+
+    cfg, err := TLSOptions{
+        CACert:            env.CACert,
+        ClientCert:        env.ClientCert,
+        ClientKey:         env.ClientKey,
+        MinVersion:        minVersion,
+        SkipSslValidation: env.SkipSslValidation,
+    }.TLSConfig()
+    if err != nil {
+        var vars []string
+        if env.CACert != "" {
+            vars = append(vars, "CA_CERT")
+        }
+        if env.ClientCert != "" || env.ClientKey != "" {
+            vars = append(vars, clientCertVars)
+        }
+        envErr.malformed(strings.Join(vars, ", "), err)
+    }
+
+    return cfg
+}
+
+// loadProxyURL parses the proxy url in the named variable, adding it to envErr
+// if it is invalid
+func loadProxyURL(name, value string, envErr *EnvironmentError) *url.URL {
+    if value == "" {
+        return nil
+    }
+
+    proxy, err := parseProxyURL(value)
+    if err != nil {
+        envErr.malformed(name, err)
+        return nil
+    }
+
+    return proxy
 }
 
-func getUserProvidedCredentials(userProvided []userProvided) (map[string]string, bool) {
-    for _, service := range userProvided {
-        if service.InstanceName == "pvtl-app-automator-credentials" {
-            return service.Credentials, true
+// parseProxyURL requires a scheme that http.Transport supports for proxies and
+// a host, so that e.g. proxy:3128 is rejected instead of failing every request
+func parseProxyURL(value string) (*url.URL, error) {
+    proxy, err := url.Parse(value)
+    if err != nil {
+        return nil, err
+    }
+
+    switch proxy.Scheme {
+    case "http", "https", "socks5":
+    default:
+        return nil, fmt.Errorf("unsupported proxy scheme '%s', expected http, https or socks5", proxy.Scheme)
+    }
+    if proxy.Host == "" {
+        return nil, fmt.Errorf("proxy url '%s' has no host", value)
+    }
+
+    return proxy, nil
+}
+
+type credentials struct {
+    Username string
+    Password string
+
+    Client       string
+    ClientSecret string
+}
+
+// getCredentials finds the binding whose name, label or tags match the given
+// service. User-provided services are checked before CredHub bindings, which
+// are checked before any other binding.
+func getCredentials(services VcapServices, service string) (credentials, bool) {
+    var candidates []VcapService
+    candidates = append(candidates, services.UserProvided...)
+    candidates = append(candidates, services.Credhub...)
+    var labels []string
+    for label := range services.Services {
+        if label != "user-provided" && label != "credhub" {
+            labels = append(labels, label)
         }
     }
+    sort.Strings(labels)
+    for _, label := range labels {
+        candidates = append(candidates, services.Services[label]...)
+    }
+
+    for _, s := range candidates {
+        if s.matches(service) {
+            return credentials{
+                Username:     stringCredential(s.Credentials, "username"),
+                Password:     stringCredential(s.Credentials, "password"),
+                Client:       stringCredential(s.Credentials, "client_id"),
+                ClientSecret: stringCredential(s.Credentials, "client_secret"),
+            }, true
+        }
+    }
+
+    return credentials{}, false
+}
+
+func (s VcapService) matches(service string) bool {
+    if s.InstanceName == service || s.Name == service || s.Label == service {
+        return true
+    }
+
+    for _, t := range s.Tags {
+        if t == service {
+            return true
+        }
+    }
+
+    return false
+}
 
-    return nil, false
+func stringCredential(credentials map[string]interface{}, key string) string {
+    value, _ := credentials[key].(string)
+    return value
 }
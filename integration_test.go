@@ -1,17 +1,29 @@
 package client_test
 
 import (
+    "bytes"
+    "context"
     "crypto/tls"
+    "errors"
     "fmt"
     "io/ioutil"
+    "log/slog"
+    "math"
     "net/http"
     "net/http/httptest"
+    "net/http/httputil"
     "net/url"
     "strings"
+    "sync"
     "time"
 
     "github.com/pivotal-cf/app-automator-cf-client"
+    "github.com/pivotal-cf/app-automator-cf-client/internal/mocks"
     "github.com/pivotal-cf/app-automator-cf-client/models"
+    "go.opentelemetry.io/otel/codes"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+    "go.opentelemetry.io/otel/trace"
 
     "github.com/gorilla/mux"
     . "github.com/onsi/ginkgo"
@@ -31,17 +43,468 @@ type integrationTestContext struct {
     skipSslValidation bool
 
     oauthCalled    int
+    oauthForm      url.Values
+    rootCalled     int
     getAppsQuery   url.Values
     getProcessVars map[string]string
     scaleVars      map[string]string
     scaleBody      string
+    scaleHeaders   http.Header
+    jobPolls       int
 
     createTaskVars map[string]string
     createTaskBody string
     requestDelay   time.Duration
+    expectedToken  string
+    tokenExpiresIn int
 }
 
 var _ = Describe("Client Integration", func() {
+    Describe("New()", func() {
+        It("discovers the token endpoint from the CAPI root", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            c := client.New(tc.cfg)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+            Expect(c.Scale("lemons", 3)).To(Succeed())
+
+            Expect(tc.rootCalled).To(Equal(1))
+            Expect(tc.oauthCalled).ToNot(BeZero())
+        })
+
+        It("uses the configured OauthUrl", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            tc.cfg.OauthUrl = tc.server.URL
+            c := client.New(tc.cfg)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(tc.rootCalled).To(Equal(0))
+            Expect(tc.oauthCalled).ToNot(BeZero())
+        })
+    })
+
+    Describe("middleware", func() {
+        It("sees every CAPI request", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            var audit []string
+            tc.cfg.Middleware = []models.Middleware{
+                func(next models.RoundTripFunc) models.RoundTripFunc {
+                    return func(req *http.Request) (*http.Response, error) {
+                        req.Header.Set("X-Correlation-Id", "correlation-id")
+                        resp, err := next(req)
+                        Expect(err).ToNot(HaveOccurred())
+                        audit = append(audit, fmt.Sprintf("%s %s %d", req.Method, req.URL.Path, resp.StatusCode))
+                        return resp, err
+                    }
+                },
+            }
+            c := client.New(tc.cfg)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(audit).To(Equal([]string{
+                "GET /v3/apps 200",
+                "POST /v3/apps/app-guid/processes/web/actions/scale 201",
+            }))
+            Expect(tc.scaleHeaders).To(HaveKeyWithValue("X-Correlation-Id", []string{"correlation-id"}))
+        })
+    })
+
+    Describe("logging", func() {
+        It("logs CAPI and UAA requests without credentials", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            buf := &bytes.Buffer{}
+            tc.cfg.Logger = slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+            c := client.New(tc.cfg)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(buf.String()).To(And(
+                ContainSubstring(`msg="uaa request" component=uaa method=POST path=/oauth/token`),
+                ContainSubstring(`msg="capi request" component=capi method=GET path=/v3/apps`),
+                ContainSubstring(`msg="capi request" component=capi method=POST path=/v3/apps/app-guid/processes/web/actions/scale`),
+                ContainSubstring(`msg="token refreshed"`),
+                ContainSubstring(`msg="app guid cache refreshed"`),
+            ))
+            Expect(buf.String()).ToNot(ContainSubstring(password))
+            Expect(buf.String()).ToNot(ContainSubstring("this-is-my-token"))
+        })
+    })
+
+    Describe("metrics", func() {
+        It("records CAPI requests, token fetches and cache lookups", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            tc.tokenExpiresIn = 3600
+
+            metrics := &mocks.Metrics{}
+            tc.cfg.Metrics = metrics
+            c := client.New(tc.cfg)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(metrics.CapiRequests).To(ContainElements(
+                "GET /v3/apps 200",
+                "POST /v3/apps/app-guid/processes/web/actions/scale 201",
+            ))
+            Expect(metrics.TokenFetches).ToNot(BeEmpty())
+            Expect(metrics.TokenExpiry).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+            Expect(metrics.CacheLookups).To(Equal([]bool{false}))
+        })
+    })
+
+    Describe("request ids", func() {
+        It("sends the given request id and reports the one CAPI returns", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            var responses []models.ResponseMetadata
+            tc.cfg.OnResponse = func(md models.ResponseMetadata) {
+                responses = append(responses, md)
+            }
+            c := client.New(tc.cfg)
+            Expect(c.ScaleContext(context.Background(), "lemons", 2, models.WithRequestID("scale-lemons"))).To(Succeed())
+
+            Expect(responses).ToNot(BeEmpty())
+            scale := responses[len(responses)-1]
+            Expect(scale.Path).To(Equal("/v3/apps/app-guid/processes/web/actions/scale"))
+            Expect(scale.RequestID).To(Equal("scale-lemons::cc"))
+        })
+
+        It("fills the metadata of a single call", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            c := client.New(tc.cfg)
+            var md models.ResponseMetadata
+            ctx := models.WithResponseMetadata(context.Background(), &md)
+            Expect(c.ScaleContext(ctx, "lemons", 2, models.WithRequestID("scale-lemons"))).To(Succeed())
+
+            Expect(md.Path).To(Equal("/v3/apps/app-guid/processes/web/actions/scale"))
+            Expect(md.RequestID).To(Equal("scale-lemons::cc"))
+        })
+
+        It("returns the request id with CAPI errors", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            c := client.New(tc.cfg)
+            err := c.StopContext(context.Background(), "lemons", models.WithRequestID("stop-lemons"))
+
+            capiErr, ok := err.(*client.CapiError)
+            Expect(ok).To(BeTrue())
+            Expect(capiErr.ResponseCode).To(Equal(http.StatusNotFound))
+            Expect(capiErr.RequestID).To(Equal("stop-lemons::cc"))
+        })
+    })
+
+    Describe("dry run", func() {
+        It("resolves the app guid and reports the scale request without sending it", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            var observed []client.DryRunRequest
+            tc.cfg.DryRun = true
+            tc.cfg.OnDryRun = func(r client.DryRunRequest) {
+                observed = append(observed, r)
+            }
+            recorder := tracetest.NewSpanRecorder()
+            tc.cfg.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+            c := client.New(tc.cfg)
+
+            var dryRun *client.DryRunError
+            Expect(errors.As(c.Scale("lemons", 2), &dryRun)).To(BeTrue())
+            Expect(dryRun.Request.Method).To(Equal(http.MethodPost))
+            Expect(dryRun.Request.URL).To(Equal(tc.server.URL + "/v3/apps/app-guid/processes/web/actions/scale"))
+            Expect(dryRun.Request.Body).To(MatchJSON(`{"instances": 2}`))
+            Expect(observed).To(Equal([]client.DryRunRequest{dryRun.Request}))
+
+            Expect(tc.getAppsQuery).ToNot(BeNil())
+            Expect(tc.scaleVars).To(BeNil())
+
+            for _, span := range recorder.Ended() {
+                Expect(span.Status().Code).ToNot(Equal(codes.Error))
+            }
+        })
+
+        It("returns the request of each call", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            tc.cfg.DryRun = true
+            c := client.New(tc.cfg)
+
+            var dryRun *client.DryRunError
+            _, err := c.CreateTask("lemons", "rake db:migrate", models.TaskConfig{})
+            Expect(errors.As(err, &dryRun)).To(BeTrue())
+            Expect(dryRun.Request.URL).To(HaveSuffix("/v3/apps/app-guid/tasks"))
+
+            Expect(errors.As(c.Stop("lemons"), &dryRun)).To(BeTrue())
+            Expect(dryRun.Request.URL).To(HaveSuffix("/v3/apps/app-guid/actions/stop"))
+        })
+
+        It("validates inputs before anything is sent", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            tc.cfg.DryRun = true
+            c := client.New(tc.cfg)
+            Expect(c.Scale("lemons", math.MaxInt32+1)).To(MatchError(ContainSubstring("above the maximum")))
+            _, err := c.CreateTask("lemons", "rake db:migrate", models.TaskConfig{MemoryInMB: math.MaxInt32 + 1})
+            Expect(err).To(MatchError(ContainSubstring("above the maximum")))
+            Expect(tc.getAppsQuery).To(BeNil())
+        })
+    })
+
+    Describe("warnings", func() {
+        It("reports the warnings CAPI returns", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            var warnings []string
+            tc.cfg.OnWarnings = func(md models.ResponseMetadata) {
+                warnings = append(warnings, md.Warnings...)
+            }
+            c := client.New(tc.cfg)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(warnings).To(Equal([]string{"Instance count is close to the quota"}))
+        })
+    })
+
+    Describe("tracing", func() {
+        It("records a span for the operation with child spans for each step", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            recorder := tracetest.NewSpanRecorder()
+            provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+            tc.cfg.TracerProvider = provider
+            c := client.New(tc.cfg)
+
+            ctx, caller := provider.Tracer("test").Start(context.Background(), "caller")
+            Expect(c.ScaleContext(ctx, "lemons", 2)).To(Succeed())
+            caller.End()
+
+            spans := recorder.Ended()
+            Expect(len(spans)).To(BeNumerically(">", 2))
+            Expect(spans[len(spans)-1].Name()).To(Equal("caller"))
+            operation := spans[len(spans)-2]
+            Expect(operation.Name()).To(Equal("Scale"))
+            Expect(operation.Parent().SpanID()).To(Equal(caller.SpanContext().SpanID()))
+
+            children := map[string]trace.SpanID{}
+            for _, s := range spans[:len(spans)-2] {
+                Expect(s.SpanContext().TraceID()).To(Equal(caller.SpanContext().TraceID()))
+                children[s.Name()] = s.Parent().SpanID()
+            }
+            Expect(children).To(HaveKeyWithValue("app guid lookup", operation.SpanContext().SpanID()))
+            Expect(children).To(HaveKeyWithValue("POST /v3/apps/app-guid/processes/web/actions/scale", operation.SpanContext().SpanID()))
+            Expect(children).To(HaveKey("GET /v3/apps"))
+            Expect(children).To(HaveKey("uaa token"))
+        })
+
+        It("starts a new trace for operations without a context", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            recorder := tracetest.NewSpanRecorder()
+            tc.cfg.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+            c := client.New(tc.cfg)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            spans := recorder.Ended()
+            operation := spans[len(spans)-1]
+            Expect(operation.Name()).To(Equal("Scale"))
+            Expect(operation.Parent().IsValid()).To(BeFalse())
+        })
+
+        It("cancels the requests of an operation with its context", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            c := client.New(tc.cfg)
+            ctx, cancel := context.WithCancel(context.Background())
+            cancel()
+
+            err := c.ScaleContext(ctx, "lemons", 2)
+            Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+        })
+    })
+
+    Describe("rate limit", func() {
+        It("stops waiting for the limiter when the context is done", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            tc.cfg.RateLimit = 0.001
+            tc.cfg.RateLimitBurst = 1
+            c := client.New(tc.cfg)
+            _, err := c.Apps()
+            Expect(err).ToNot(HaveOccurred())
+
+            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+            defer cancel()
+
+            _, err = c.AppsContext(ctx)
+            Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+        })
+    })
+
+    Describe("circuit breaker", func() {
+        It("fails fast with ErrCircuitOpen and reports state changes", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            // keep the token cached so only CAPI requests fail once the server is gone
+            tc.tokenExpiresIn = 3600
+
+            var changes []string
+            tc.cfg.CircuitBreakerThreshold = 1
+            tc.cfg.CircuitBreakerCooldown = time.Hour
+            tc.cfg.OnCircuitStateChange = func(name string, from, to client.CircuitState) {
+                changes = append(changes, fmt.Sprintf("%s: %s -> %s", name, from, to))
+            }
+            c := client.New(tc.cfg)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            tc.server.Close()
+            Expect(c.Scale("lemons", 2)).ToNot(Succeed())
+            Expect(c.Scale("lemons", 2)).To(MatchError(client.ErrCircuitOpen))
+
+            Expect(changes).To(ContainElement("capi: closed -> open"))
+        })
+    })
+
+    Describe("proxies", func() {
+        It("sends CAPI and UAA requests through their proxies", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            var capiPaths, uaaPaths []string
+            capiProxy := newRecordingProxy(&capiPaths)
+            defer capiProxy.Close()
+            uaaProxy := newRecordingProxy(&uaaPaths)
+            defer uaaProxy.Close()
+
+            tc.cfg.HttpClient = nil
+            tc.cfg.CapiProxy, _ = url.Parse(capiProxy.URL)
+            tc.cfg.UaaProxy, _ = url.Parse(uaaProxy.URL)
+
+            c := client.New(tc.cfg)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(capiPaths).To(ContainElement("/v3/apps"))
+            Expect(capiPaths).ToNot(ContainElement("/oauth/token"))
+            Expect(uaaPaths).ToNot(BeEmpty())
+            Expect(uaaPaths).To(HaveEach("/oauth/token"))
+        })
+
+        It("uses Proxy for both if no specific proxy is set", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            var paths []string
+            proxy := newRecordingProxy(&paths)
+            defer proxy.Close()
+
+            tc.cfg.HttpClient = nil
+            tc.cfg.Proxy, _ = url.Parse(proxy.URL)
+
+            c := client.New(tc.cfg)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(paths).To(ContainElement("/v3/apps"))
+            Expect(paths).To(ContainElement("/oauth/token"))
+        })
+
+        It("returns an error if a proxy url from the environment is invalid", func() {
+            _, err := client.BuildFromEnv(map[string]string{
+                "VCAP_APPLICATION": `{"cf_api": "https://api.example.com"}`,
+                "VCAP_SERVICES":    `{}`,
+                "UAA_PROXY_URL":    "://lemons",
+            })
+            Expect(err).To(MatchError(ContainSubstring("UAA_PROXY_URL")))
+        })
+    })
+
+    Describe("Build()", func() {
+        var buildFromEnv = func(tc *integrationTestContext, vcapServices string) *client.Client {
+            c, err := client.BuildFromEnv(map[string]string{
+                "VCAP_APPLICATION":    fmt.Sprintf(`{"space_id": "space-guid", "cf_api": "%s"}`, tc.server.URL),
+                "VCAP_SERVICES":       vcapServices,
+                "CREDENTIALS_SERVICE": "automator-creds",
+            })
+            Expect(err).ToNot(HaveOccurred())
+            return c
+        }
+
+        It("uses user credentials from a user-provided service", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            c := buildFromEnv(tc, `{"user-provided": [{
+                "instance_name": "automator-creds",
+                "credentials": {"username": "admin", "password": "supersecret"}
+            }]}`)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(tc.oauthForm.Get("grant_type")).To(Equal("password"))
+            Expect(tc.oauthForm.Get("username")).To(Equal("admin"))
+            Expect(tc.oauthForm.Get("password")).To(Equal("supersecret"))
+        })
+
+        It("uses client credentials from a CredHub binding", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            c := buildFromEnv(tc, `{"credhub": [{
+                "name": "automator-creds",
+                "credentials": {"client_id": "automator", "client_secret": "secret", "port": 443}
+            }]}`)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(tc.oauthForm.Get("grant_type")).To(Equal("client_credentials"))
+            Expect(tc.oauthForm.Get("client_id")).To(Equal("automator"))
+            Expect(tc.oauthForm.Get("client_secret")).To(Equal("secret"))
+        })
+
+        It("returns an error if the TLS configuration is invalid", func() {
+            _, err := client.BuildFromEnv(map[string]string{
+                "VCAP_APPLICATION": `{"space_id": "space-guid", "cf_api": "https://api.example.com"}`,
+                "VCAP_SERVICES":    `{}`,
+                "CA_CERT":          "/does/not/exist",
+            })
+            Expect(err).To(MatchError(ContainSubstring("CA_CERT: unable to read CA cert")))
+        })
+
+        It("finds credentials by label or tag", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            c := buildFromEnv(tc, `{
+                "user-provided": [{
+                    "instance_name": "something-else",
+                    "credentials": {"username": "wrong", "password": "wrong"}
+                }],
+                "p-identity": [{
+                    "name": "sso",
+                    "label": "p-identity",
+                    "tags": ["automator-creds"],
+                    "credentials": {"client_id": "tagged", "client_secret": "secret"}
+                }]
+            }`)
+            Expect(c.Scale("lemons", 2)).To(Succeed())
+
+            Expect(tc.oauthForm.Get("client_id")).To(Equal("tagged"))
+        })
+    })
+
     Describe("Scale()", func() {
         It("gets app information", func() {
             tc, teardown := setup()
@@ -72,6 +535,24 @@ var _ = Describe("Client Integration", func() {
         })
     })
 
+    Describe("DeleteApp()", func() {
+        It("deletes the app and waits for the job", func() {
+            tc, teardown := setup()
+            defer teardown()
+
+            c := client.New(tc.cfg)
+            location, err := c.DeleteApp("lemons")
+            Expect(err).ToNot(HaveOccurred())
+            Expect(location).To(HaveSuffix("/v3/jobs/job-guid"))
+
+            job, err := c.WaitForJob(location, time.Millisecond, time.Second)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(job.Guid).To(Equal("job-guid"))
+            Expect(job.State).To(Equal(models.JobComplete))
+            Expect(tc.jobPolls).To(Equal(3))
+        })
+    })
+
     Describe("Process()", func() {
         It("gets app information", func() {
             tc, teardown := setup()
@@ -184,27 +665,79 @@ func setupWithTimeout(timeout time.Duration) (*integrationTestContext, func()) {
     }
 }
 
+func newRecordingProxy(paths *[]string) *httptest.Server {
+    var mu sync.Mutex
+    proxy := &httputil.ReverseProxy{
+        Director: func(req *http.Request) {
+            mu.Lock()
+            *paths = append(*paths, req.URL.Path)
+            mu.Unlock()
+        },
+    }
+    return httptest.NewServer(proxy)
+}
+
 func setupUaa(tc *integrationTestContext, router *mux.Router) {
     router.HandleFunc("/oauth/token", func(w http.ResponseWriter, req *http.Request) {
         tc.oauthCalled++
 
+        Expect(req.ParseForm()).To(Succeed())
+        tc.oauthForm = req.PostForm
+
         w.Header().Set("Content-Type", "application/json")
 
         tokenPieces := strings.Split(token, " ")
+        if tc.tokenExpiresIn > 0 {
+            w.Write([]byte(fmt.Sprintf(`{"access_token": "%s", "token_type": "%s", "expires_in": %d}`, tokenPieces[1], tokenPieces[0], tc.tokenExpiresIn)))
+            return
+        }
         w.Write([]byte(fmt.Sprintf(`{"access_token": "%s", "token_type": "%s"}`, tokenPieces[1], tokenPieces[0])))
     }).Methods(http.MethodPost)
 }
 
 func setupCc(tc *integrationTestContext, router *mux.Router) {
+    router.Use(echoRequestID)
+    router.NotFoundHandler = echoRequestID(http.NotFoundHandler())
+    router.HandleFunc("/", handleRoot(tc)).Methods(http.MethodGet)
     router.HandleFunc("/v3/apps", handleListApps(tc)).Methods(http.MethodGet)
     router.HandleFunc("/v3/apps/{appGuid}/processes/{processType}", handleGetProcess(tc)).Methods(http.MethodGet)
     router.HandleFunc("/v3/apps/{appGuid}/processes/{processType}/actions/scale", handleScale(tc)).Methods(http.MethodPost)
     router.HandleFunc("/v3/apps/{appGuid}/tasks", handleTask(tc)).Methods(http.MethodPost)
+    router.HandleFunc("/v3/apps/{appGuid}", handleDeleteApp(tc)).Methods(http.MethodDelete)
+    router.HandleFunc("/v3/jobs/{jobGuid}", handleJob(tc)).Methods(http.MethodGet)
+}
+
+// echoRequestID appends an id to the request id like Cloud Controller does
+func echoRequestID(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        id := req.Header.Get("X-Vcap-Request-Id")
+        if id == "" {
+            id = "router"
+        }
+        w.Header().Set("X-Vcap-Request-Id", id+"::cc")
+        next.ServeHTTP(w, req)
+    })
+}
+
+func (tc *integrationTestContext) authorization() string {
+    if tc.expectedToken != "" {
+        return tc.expectedToken
+    }
+    return token
+}
+
+func handleRoot(tc *integrationTestContext) http.HandlerFunc {
+    return func(w http.ResponseWriter, req *http.Request) {
+        tc.rootCalled++
+
+        login := "http://" + req.Host
+        w.Write([]byte(fmt.Sprintf(`{"links": {"login": {"href": "%s"}, "uaa": {"href": "%s"}}}`, login, login)))
+    }
 }
 
 func handleListApps(tc *integrationTestContext) http.HandlerFunc {
     return func(w http.ResponseWriter, req *http.Request) {
-        Expect(req.Header).To(HaveKeyWithValue("Authorization", []string{token}))
+        Expect(req.Header).To(HaveKeyWithValue("Authorization", []string{tc.authorization()}))
 
         time.Sleep(tc.requestDelay)
 
@@ -215,7 +748,7 @@ func handleListApps(tc *integrationTestContext) http.HandlerFunc {
 
 func handleGetProcess(tc *integrationTestContext) http.HandlerFunc {
     return func(w http.ResponseWriter, req *http.Request) {
-        Expect(req.Header).To(HaveKeyWithValue("Authorization", []string{token}))
+        Expect(req.Header).To(HaveKeyWithValue("Authorization", []string{tc.authorization()}))
 
         time.Sleep(tc.requestDelay)
 
@@ -226,23 +759,47 @@ func handleGetProcess(tc *integrationTestContext) http.HandlerFunc {
 
 func handleScale(tc *integrationTestContext) http.HandlerFunc {
     return func(w http.ResponseWriter, req *http.Request) {
-        Expect(req.Header).To(HaveKeyWithValue("Authorization", []string{token}))
+        Expect(req.Header).To(HaveKeyWithValue("Authorization", []string{tc.authorization()}))
 
         time.Sleep(tc.requestDelay)
 
         tc.scaleVars = mux.Vars(req)
+        tc.scaleHeaders = req.Header
 
         body, err := ioutil.ReadAll(req.Body)
         Expect(err).ToNot(HaveOccurred())
         tc.scaleBody = string(body)
 
+        w.Header().Set("X-Cf-Warnings", url.QueryEscape("Instance count is close to the quota"))
         w.WriteHeader(http.StatusCreated)
     }
 }
 
+func handleDeleteApp(tc *integrationTestContext) http.HandlerFunc {
+    return func(w http.ResponseWriter, req *http.Request) {
+        Expect(req.Header).To(HaveKeyWithValue("Authorization", []string{tc.authorization()}))
+
+        w.Header().Set("Location", "http://"+req.Host+"/v3/jobs/job-guid")
+        w.WriteHeader(http.StatusAccepted)
+    }
+}
+
+func handleJob(tc *integrationTestContext) http.HandlerFunc {
+    return func(w http.ResponseWriter, req *http.Request) {
+        Expect(req.Header).To(HaveKeyWithValue("Authorization", []string{tc.authorization()}))
+
+        tc.jobPolls++
+        state := models.JobProcessing
+        if tc.jobPolls > 2 {
+            state = models.JobComplete
+        }
+        w.Write([]byte(fmt.Sprintf(`{"guid": "%s", "operation": "app.delete", "state": "%s"}`, mux.Vars(req)["jobGuid"], state)))
+    }
+}
+
 func handleTask(tc *integrationTestContext) http.HandlerFunc {
     return func(w http.ResponseWriter, req *http.Request) {
-        Expect(req.Header).To(HaveKeyWithValue("Authorization", []string{token}))
+        Expect(req.Header).To(HaveKeyWithValue("Authorization", []string{tc.authorization()}))
 
         time.Sleep(tc.requestDelay)
 
@@ -1,41 +1,85 @@
 package internal
 
 import (
+    "context"
     "fmt"
+    "log/slog"
     "net/http"
     "sync"
 
     "github.com/pivotal-cf/app-automator-cf-client/models"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
 )
 
-type appGetter func(query map[string]string) ([]models.App, error)
+type appGetter func(ctx context.Context, query map[string]string) ([]models.App, error)
 
 type AppGuidCache struct {
     get       appGetter
     spaceGuid string
+    logger    *slog.Logger
+    metrics   Metrics
+    tracer    trace.Tracer
 
     cache map[string]string
     mu    sync.RWMutex
 }
 
-func NewAppGuidCache(appGetter appGetter, spaceGuid string) *AppGuidCache {
-    return &AppGuidCache{
+type AppGuidCacheOption func(*AppGuidCache)
+
+// WithAppGuidCacheLogger logs refreshes and invalidations at debug level
+func WithAppGuidCacheLogger(logger *slog.Logger) AppGuidCacheOption {
+    return func(c *AppGuidCache) {
+        c.logger = logger
+    }
+}
+
+// WithAppGuidCacheMetrics records hits, misses and refreshes
+func WithAppGuidCacheMetrics(m Metrics) AppGuidCacheOption {
+    return func(c *AppGuidCache) {
+        c.metrics = m
+    }
+}
+
+// WithAppGuidCacheTracerProvider records a span for every lookup
+func WithAppGuidCacheTracerProvider(tp trace.TracerProvider) AppGuidCacheOption {
+    return func(c *AppGuidCache) {
+        c.tracer = Tracer(tp)
+    }
+}
+
+func NewAppGuidCache(appGetter appGetter, spaceGuid string, opts ...AppGuidCacheOption) *AppGuidCache {
+    c := &AppGuidCache{
         get:       appGetter,
         spaceGuid: spaceGuid,
 
         cache: make(map[string]string),
     }
+    for _, o := range opts {
+        o(c)
+    }
+    c.logger = loggerOrDiscard(c.logger)
+    c.metrics = metricsOrNoop(c.metrics)
+    if c.tracer == nil {
+        c.tracer = Tracer(nil)
+    }
+    return c
 }
 
-func (c *AppGuidCache) Get(name string) (string, error) {
+func (c *AppGuidCache) Get(ctx context.Context, name string) (guid string, err error) {
+    ctx, span := c.tracer.Start(ctx, "app guid lookup", trace.WithAttributes(attribute.String("cf.app.name", name)))
+    defer func() { EndSpan(span, err) }()
+
     c.mu.RLock()
     guid, ok := c.cache[name]
     c.mu.RUnlock()
+    c.metrics.AppGuidCacheLookup(ok)
+    span.SetAttributes(attribute.Bool("cache.hit", ok))
     if ok {
         return guid, nil
     }
 
-    err := c.refresh()
+    err = c.refresh(ctx)
     if err != nil {
         return "", err
     }
@@ -50,10 +94,50 @@ func (c *AppGuidCache) Get(name string) (string, error) {
     return "", fmt.Errorf("app '%s' not found", name)
 }
 
-func (c *AppGuidCache) refresh() error {
-    apps, err := c.get(map[string]string{
+// GetMany returns the guids of the named apps that exist, refreshing the
+// cache once if any of them is not cached
+func (c *AppGuidCache) GetMany(ctx context.Context, names []string) (guids map[string]string, err error) {
+    ctx, span := c.tracer.Start(ctx, "app guid lookup", trace.WithAttributes(attribute.StringSlice("cf.app.names", names)))
+    defer func() { EndSpan(span, err) }()
+
+    guids = c.cached(names)
+    hit := true
+    for _, name := range names {
+        _, ok := guids[name]
+        c.metrics.AppGuidCacheLookup(ok)
+        hit = hit && ok
+    }
+    span.SetAttributes(attribute.Bool("cache.hit", hit))
+    if hit {
+        return guids, nil
+    }
+
+    err = c.refresh(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    return c.cached(names), nil
+}
+
+func (c *AppGuidCache) cached(names []string) map[string]string {
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+
+    guids := make(map[string]string, len(names))
+    for _, name := range names {
+        if guid, ok := c.cache[name]; ok {
+            guids[name] = guid
+        }
+    }
+    return guids
+}
+
+func (c *AppGuidCache) refresh(ctx context.Context) error {
+    apps, err := c.get(ctx, map[string]string{
         "space_guids": c.spaceGuid,
     })
+    c.metrics.AppGuidCacheRefresh(err)
     if err != nil {
         return err
     }
@@ -67,6 +151,7 @@ func (c *AppGuidCache) refresh() error {
     c.cache = newMap
     c.mu.Unlock()
 
+    c.logger.Debug("app guid cache refreshed", slog.String("space_guid", c.spaceGuid), slog.Int("apps", len(newMap)))
     return nil
 }
 
@@ -74,14 +159,20 @@ func (c *AppGuidCache) Invalidate() {
     c.mu.Lock()
     c.cache = map[string]string{}
     c.mu.Unlock()
+
+    c.logger.Debug("app guid cache invalidated", slog.String("space_guid", c.spaceGuid))
 }
 
 func (c *AppGuidCache) TryWithRefresh(appName string, f func(appGuid string) error) error {
-    err := c.try(appName, f)
+    return c.TryWithRefreshContext(context.Background(), appName, f)
+}
+
+func (c *AppGuidCache) TryWithRefreshContext(ctx context.Context, appName string, f func(appGuid string) error) error {
+    err := c.try(ctx, appName, f)
     if err != nil {
         if isNotFound(err) {
             c.Invalidate()
-            return c.try(appName, f)
+            return c.try(ctx, appName, f)
         }
 
         return err
@@ -94,8 +185,8 @@ func isNotFound(err error) bool {
     return ok && capiErr != nil && capiErr.ResponseCode == http.StatusNotFound
 }
 
-func (c *AppGuidCache) try(appName string, f func(appGuid string) error) error {
-    guid, err := c.Get(appName)
+func (c *AppGuidCache) try(ctx context.Context, appName string, f func(appGuid string) error) error {
+    guid, err := c.Get(ctx, appName)
     if err != nil {
         return err
     }
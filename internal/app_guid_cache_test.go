@@ -1,11 +1,19 @@
 package internal_test
 
 import (
+    "context"
+    "bytes"
     "errors"
+    "log/slog"
     "net/http"
 
     "github.com/pivotal-cf/app-automator-cf-client/internal"
+    "github.com/pivotal-cf/app-automator-cf-client/internal/mocks"
     "github.com/pivotal-cf/app-automator-cf-client/models"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
 
     . "github.com/onsi/ginkgo"
     . "github.com/onsi/gomega"
@@ -16,14 +24,14 @@ var _ = Describe("Capi", func() {
         It("fills cache if not present", func() {
             var appsRefreshed bool
             c := internal.NewAppGuidCache(
-                func(query map[string]string) ([]models.App, error) {
+                func(ctx context.Context, query map[string]string) ([]models.App, error) {
                     appsRefreshed = true
-                    return validGuids(query)
+                    return validGuids(ctx, query)
                 },
                 "space-guid",
             )
 
-            guid, err := c.Get("lemons")
+            guid, err := c.Get(context.Background(), "lemons")
             Expect(err).ToNot(HaveOccurred())
             Expect(guid).To(Equal("lemons-guid"))
             Expect(appsRefreshed).To(BeTrue())
@@ -32,22 +40,22 @@ var _ = Describe("Capi", func() {
         It("gets guid from cache if present", func() {
             var appsRefreshed int
             c := internal.NewAppGuidCache(
-                func(query map[string]string) ([]models.App, error) {
+                func(ctx context.Context, query map[string]string) ([]models.App, error) {
                     appsRefreshed++
-                    return validGuids(query)
+                    return validGuids(ctx, query)
                 },
                 "space-guid",
             )
 
-            guid, err := c.Get("lemons")
+            guid, err := c.Get(context.Background(), "lemons")
             Expect(err).ToNot(HaveOccurred())
             Expect(guid).To(Equal("lemons-guid"))
 
-            guid, err = c.Get("lemons")
+            guid, err = c.Get(context.Background(), "lemons")
             Expect(err).ToNot(HaveOccurred())
             Expect(guid).To(Equal("lemons-guid"))
 
-            guid, err = c.Get("limes")
+            guid, err = c.Get(context.Background(), "limes")
             Expect(err).ToNot(HaveOccurred())
             Expect(guid).To(Equal("limes-guid"))
 
@@ -57,20 +65,20 @@ var _ = Describe("Capi", func() {
         It("handles concurrent reads", func() {
             c := internal.NewAppGuidCache(validGuids, "space-guid")
             for i := 0; i < 50; i++ {
-                go func() { c.Get("lemons") }()
+                go func() { c.Get(context.Background(), "lemons") }()
             }
         })
 
         It("returns an error if the app isn't found", func() {
             c := internal.NewAppGuidCache(validGuids, "space-guid")
 
-            _, err := c.Get("grapefruit")
+            _, err := c.Get(context.Background(), "grapefruit")
             Expect(err).To(HaveOccurred())
         })
 
         It("returns an error if getting apps fails", func() {
             c := internal.NewAppGuidCache(
-                func(query map[string]string) ([]models.App, error) {
+                func(ctx context.Context, query map[string]string) ([]models.App, error) {
                     return []models.App{
                         {Name: "lemons", Guid: "lemons-guid"},
                     }, errors.New("expected")
@@ -78,39 +86,127 @@ var _ = Describe("Capi", func() {
                 "space-guid",
             )
 
-            _, err := c.Get("lemons")
+            _, err := c.Get(context.Background(), "lemons")
             Expect(err).To(HaveOccurred())
         })
     })
 
+    Describe("GetMany()", func() {
+        It("refreshes the cache once for the apps that are not cached", func() {
+            var appsRefreshed int
+            c := internal.NewAppGuidCache(
+                func(ctx context.Context, query map[string]string) ([]models.App, error) {
+                    appsRefreshed++
+                    return validGuids(ctx, query)
+                },
+                "space-guid",
+            )
+
+            guids, err := c.GetMany(context.Background(), []string{"lemons", "limes", "grapefruit"})
+            Expect(err).ToNot(HaveOccurred())
+            Expect(guids).To(Equal(map[string]string{"lemons": "lemons-guid", "limes": "limes-guid"}))
+            Expect(appsRefreshed).To(Equal(1))
+
+            guids, err = c.GetMany(context.Background(), []string{"lemons", "limes"})
+            Expect(err).ToNot(HaveOccurred())
+            Expect(guids).To(HaveLen(2))
+            Expect(appsRefreshed).To(Equal(1))
+
+            guid, err := c.Get(context.Background(), "limes")
+            Expect(err).ToNot(HaveOccurred())
+            Expect(guid).To(Equal("limes-guid"))
+            Expect(appsRefreshed).To(Equal(1))
+        })
+
+        It("returns an error if getting apps fails", func() {
+            c := internal.NewAppGuidCache(
+                func(ctx context.Context, query map[string]string) ([]models.App, error) {
+                    return nil, errors.New("expected")
+                },
+                "space-guid",
+            )
+
+            _, err := c.GetMany(context.Background(), []string{"lemons"})
+            Expect(err).To(MatchError("expected"))
+        })
+    })
+
     Describe("Invalidate()", func() {
         It("clears the cache", func() {
             var appsRefreshed int
             c := internal.NewAppGuidCache(
-                func(query map[string]string) ([]models.App, error) {
+                func(ctx context.Context, query map[string]string) ([]models.App, error) {
                     appsRefreshed++
-                    return validGuids(query)
+                    return validGuids(ctx, query)
                 },
                 "space-guid",
             )
 
-            guid, err := c.Get("lemons")
+            guid, err := c.Get(context.Background(), "lemons")
             Expect(err).ToNot(HaveOccurred())
             Expect(guid).To(Equal("lemons-guid"))
 
             c.Invalidate()
 
-            guid, err = c.Get("lemons")
+            guid, err = c.Get(context.Background(), "lemons")
             Expect(err).ToNot(HaveOccurred())
             Expect(guid).To(Equal("lemons-guid"))
 
             Expect(appsRefreshed).To(Equal(2))
         })
 
+        It("logs refreshes and invalidations at debug level", func() {
+            buf := &bytes.Buffer{}
+            logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+            c := internal.NewAppGuidCache(validGuids, "space-guid", internal.WithAppGuidCacheLogger(logger))
+
+            _, err := c.Get(context.Background(), "lemons")
+            Expect(err).ToNot(HaveOccurred())
+            c.Invalidate()
+
+            Expect(buf.String()).To(And(
+                ContainSubstring(`level=DEBUG msg="app guid cache refreshed" space_guid=space-guid apps=2`),
+                ContainSubstring(`level=DEBUG msg="app guid cache invalidated" space_guid=space-guid`),
+            ))
+        })
+
+        It("records hits, misses and refreshes", func() {
+            metrics := &mocks.Metrics{}
+            c := internal.NewAppGuidCache(validGuids, "space-guid", internal.WithAppGuidCacheMetrics(metrics))
+
+            _, err := c.Get(context.Background(), "lemons")
+            Expect(err).ToNot(HaveOccurred())
+            _, err = c.Get(context.Background(), "limes")
+            Expect(err).ToNot(HaveOccurred())
+
+            Expect(metrics.CacheLookups).To(Equal([]bool{false, true}))
+            Expect(metrics.CacheRefreshes).To(Equal([]error{nil}))
+        })
+
+        It("records a span for every lookup", func() {
+            recorder := tracetest.NewSpanRecorder()
+            provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+            c := internal.NewAppGuidCache(validGuids, "space-guid", internal.WithAppGuidCacheTracerProvider(provider))
+
+            _, err := c.Get(context.Background(), "lemons")
+            Expect(err).ToNot(HaveOccurred())
+            _, err = c.Get(context.Background(), "grapefruit")
+            Expect(err).To(HaveOccurred())
+
+            spans := recorder.Ended()
+            Expect(spans).To(HaveLen(2))
+            Expect(spans[0].Name()).To(Equal("app guid lookup"))
+            Expect(spans[0].Attributes()).To(ConsistOf(
+                attribute.String("cf.app.name", "lemons"),
+                attribute.Bool("cache.hit", false),
+            ))
+            Expect(spans[1].Status().Code).To(Equal(codes.Error))
+        })
+
         It("handles concurrent reads and invalidations", func() {
             c := internal.NewAppGuidCache(validGuids, "space-guid")
             for i := 0; i < 50; i++ {
-                go func() { c.Get("lemons") }()
+                go func() { c.Get(context.Background(), "lemons") }()
             }
             for i := 0; i < 50; i++ {
                 go func() { c.Invalidate() }()
@@ -163,7 +259,7 @@ var _ = Describe("Capi", func() {
 
         It("returns an error if app guids can't be fetched", func() {
             c := internal.NewAppGuidCache(
-                func(query map[string]string) ([]models.App, error) {
+                func(ctx context.Context, query map[string]string) ([]models.App, error) {
                     return []models.App{
                         {Name: "lemons", Guid: "lemons-guid"},
                     }, errors.New("expected")
@@ -179,7 +275,7 @@ var _ = Describe("Capi", func() {
     })
 })
 
-var validGuids = func(query map[string]string) ([]models.App, error) {
+var validGuids = func(ctx context.Context, query map[string]string) ([]models.App, error) {
     Expect(query).To(HaveKeyWithValue("space_guids", "space-guid"))
 
     return []models.App{
@@ -188,9 +284,9 @@ var validGuids = func(query map[string]string) ([]models.App, error) {
     }, nil
 }
 
-func validGuidAfterRefresh() func(query map[string]string) ([]models.App, error) {
+func validGuidAfterRefresh() func(ctx context.Context, query map[string]string) ([]models.App, error) {
     cacheCallCount := 0
-    return func(query map[string]string) ([]models.App, error) {
+    return func(ctx context.Context, query map[string]string) ([]models.App, error) {
         cacheCallCount++
         if cacheCallCount == 1 {
             return []models.App{
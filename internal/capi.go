@@ -1,6 +1,7 @@
 package internal
 
 import (
+    "context"
     "encoding/json"
     "fmt"
     "net/http"
@@ -10,8 +11,9 @@ import (
 )
 
 type capiRequestor interface {
-    Do(method, path string, body string, v interface{}, opts ...models.HeaderOption) error
-    GetPagedResources(path string, v Accumulator, opts ...models.HeaderOption) error
+    Do(ctx context.Context, method, path string, body string, v interface{}, opts ...models.HeaderOption) error
+    DoJob(ctx context.Context, method, path string, body string, opts ...models.HeaderOption) (string, error)
+    GetPagedResources(ctx context.Context, path string, v Accumulator, opts ...models.HeaderOption) error
 }
 
 type CapiClient struct {
@@ -24,9 +26,21 @@ func NewCapiClient(requestor capiRequestor) *CapiClient {
     }
 }
 
-func (c *CapiClient) Apps(query map[string]string) ([]models.App, error) {
+func (c *CapiClient) RootContext(ctx context.Context) (models.Root, error) {
+    var r models.Root
+    err := c.get(ctx, "/", &r)
+    return r, err
+}
+
+func (c *CapiClient) InfoContext(ctx context.Context) (models.Info, error) {
+    var i models.Info
+    err := c.get(ctx, "/v3/info", &i)
+    return i, err
+}
+
+func (c *CapiClient) AppsContext(ctx context.Context, query map[string]string) ([]models.App, error) {
     var apps []models.App
-    err := c.requestor.GetPagedResources("/v3/apps?"+buildQuery(query), func(messages json.RawMessage) error {
+    err := c.requestor.GetPagedResources(ctx, "/v3/apps?"+buildQuery(query), func(messages json.RawMessage) error {
         var page []models.App
 
         err := json.Unmarshal(messages, &page)
@@ -47,24 +61,32 @@ func buildQuery(values map[string]string) string {
     return query.Encode()
 }
 
-func (c *CapiClient) Process(appGuid, processType string) (models.Process, error) {
+func (c *CapiClient) ProcessContext(ctx context.Context, appGuid, processType string, opts ...models.HeaderOption) (models.Process, error) {
     var p models.Process
-    err := c.get(fmt.Sprintf("/v3/apps/%s/processes/%s", appGuid, processType), &p)
+    err := c.get(ctx, fmt.Sprintf("/v3/apps/%s/processes/%s", appGuid, processType), &p, opts...)
     return p, err
 }
 
-func (c *CapiClient) Scale(appGuid, processType string, instanceCount uint) error {
+func (c *CapiClient) ProcessStatsContext(ctx context.Context, appGuid, processType string, opts ...models.HeaderOption) ([]models.ProcessStats, error) {
+    var stats struct {
+        Resources []models.ProcessStats `json:"resources"`
+    }
+    err := c.get(ctx, fmt.Sprintf("/v3/apps/%s/processes/%s/stats", appGuid, processType), &stats, opts...)
+    return stats.Resources, err
+}
+
+func (c *CapiClient) ScaleContext(ctx context.Context, appGuid, processType string, instanceCount uint, opts ...models.HeaderOption) error {
     path := fmt.Sprintf("/v3/apps/%s/processes/%s/actions/scale", appGuid, processType)
     body := fmt.Sprintf(`{"instances": %d}`, instanceCount)
 
-    return c.requestor.Do(http.MethodPost, path, body, nil)
+    return c.requestor.Do(ctx, http.MethodPost, path, body, nil, opts...)
 }
 
-func (c *CapiClient) get(path string, v interface{}) error {
-    return c.requestor.Do(http.MethodGet, path, "", v)
+func (c *CapiClient) get(ctx context.Context, path string, v interface{}, opts ...models.HeaderOption) error {
+    return c.requestor.Do(ctx, http.MethodGet, path, "", v, opts...)
 }
 
-func (c *CapiClient) CreateTask(appGuid, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
+func (c *CapiClient) CreateTaskContext(ctx context.Context, appGuid, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
     path := fmt.Sprintf("/v3/apps/%s/tasks", appGuid)
 
     taskRequest := struct {
@@ -81,11 +103,86 @@ func (c *CapiClient) CreateTask(appGuid, command string, cfg models.TaskConfig,
     }
 
     var task models.Task
-    err = c.requestor.Do(http.MethodPost, path, string(body), &task, opts...)
+    err = c.requestor.Do(ctx, http.MethodPost, path, string(body), &task, opts...)
     return task, err
 }
 
-func (c *CapiClient) Stop(appGuid string) error {
+func (c *CapiClient) StopContext(ctx context.Context, appGuid string, opts ...models.HeaderOption) error {
     path := fmt.Sprintf("/v3/apps/%s/actions/stop", appGuid)
-    return c.requestor.Do(http.MethodPost, path, "", nil)
+    return c.requestor.Do(ctx, http.MethodPost, path, "", nil, opts...)
+}
+
+func (c *CapiClient) StartContext(ctx context.Context, appGuid string, opts ...models.HeaderOption) error {
+    path := fmt.Sprintf("/v3/apps/%s/actions/start", appGuid)
+    return c.requestor.Do(ctx, http.MethodPost, path, "", nil, opts...)
+}
+
+func (c *CapiClient) TasksContext(ctx context.Context, appGuid string, query map[string]string) ([]models.Task, error) {
+    var tasks []models.Task
+    path := fmt.Sprintf("/v3/apps/%s/tasks?%s", appGuid, buildQuery(query))
+    err := c.requestor.GetPagedResources(ctx, path, func(messages json.RawMessage) error {
+        var page []models.Task
+
+        err := json.Unmarshal(messages, &page)
+        if err != nil {
+            return err
+        }
+        tasks = append(tasks, page...)
+        return nil
+    })
+    return tasks, err
+}
+
+// DeleteAppContext deletes the app and returns the location of the deletion job
+func (c *CapiClient) DeleteAppContext(ctx context.Context, appGuid string, opts ...models.HeaderOption) (string, error) {
+    path := fmt.Sprintf("/v3/apps/%s", appGuid)
+    return c.requestor.DoJob(ctx, http.MethodDelete, path, "", opts...)
+}
+
+// The methods without a context use context.Background(), for callers of the
+// client.Capi and client.CapiExtended interfaces
+
+func (c *CapiClient) Root() (models.Root, error) {
+    return c.RootContext(context.Background())
+}
+
+func (c *CapiClient) Info() (models.Info, error) {
+    return c.InfoContext(context.Background())
+}
+
+func (c *CapiClient) Apps(query map[string]string) ([]models.App, error) {
+    return c.AppsContext(context.Background(), query)
+}
+
+func (c *CapiClient) Process(appGuid, processType string) (models.Process, error) {
+    return c.ProcessContext(context.Background(), appGuid, processType)
+}
+
+func (c *CapiClient) ProcessStats(appGuid, processType string) ([]models.ProcessStats, error) {
+    return c.ProcessStatsContext(context.Background(), appGuid, processType)
+}
+
+func (c *CapiClient) Scale(appGuid, processType string, instanceCount uint) error {
+    return c.ScaleContext(context.Background(), appGuid, processType, instanceCount)
+}
+
+func (c *CapiClient) CreateTask(appGuid, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
+    return c.CreateTaskContext(context.Background(), appGuid, command, cfg, opts...)
+}
+
+func (c *CapiClient) Stop(appGuid string) error {
+    return c.StopContext(context.Background(), appGuid)
+}
+
+func (c *CapiClient) Start(appGuid string) error {
+    return c.StartContext(context.Background(), appGuid)
+}
+
+func (c *CapiClient) Tasks(appGuid string, query map[string]string) ([]models.Task, error) {
+    return c.TasksContext(context.Background(), appGuid, query)
+}
+
+// DeleteApp deletes the app and returns the location of the deletion job
+func (c *CapiClient) DeleteApp(appGuid string) (string, error) {
+    return c.DeleteAppContext(context.Background(), appGuid)
 }
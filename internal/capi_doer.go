@@ -1,60 +1,366 @@
 package internal
 
 import (
+    "context"
     "encoding/json"
     "fmt"
     "github.com/pivotal-cf/app-automator-cf-client/models"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/trace"
     "io"
-    "io/ioutil"
+    "log/slog"
     "net/http"
+    neturl "net/url"
     "strings"
+    "time"
 )
 
-type tokenGetter func() (string, error)
+type tokenGetter func(ctx context.Context) (string, error)
 
 type CapiDoer struct {
-    httpClient httpClient
-    capiUrl    string
-    getToken   tokenGetter
+    httpClient      httpClient
+    capiUrl         string
+    getToken        tokenGetter
+    invalidateToken func()
+    rateLimiter     *RateLimiter
+    breaker         *CircuitBreaker
+    middleware      []models.Middleware
+    roundTrip       models.RoundTripFunc
+    logger          *slog.Logger
+    metrics         Metrics
+    tracer          trace.Tracer
+    propagator      propagation.TextMapPropagator
+    onResponse      func(models.ResponseMetadata)
+    onWarnings      func(models.ResponseMetadata)
+    dryRun          bool
+    onDryRun        func(models.DryRunRequest)
 }
 
-func NewCapiDoer(httpClient httpClient, capiUrl string, tokenGetter tokenGetter) *CapiDoer {
-    return &CapiDoer{
+type CapiDoerOption func(*CapiDoer)
+
+// WithTokenInvalidator is called when CAPI rejects a token so that the
+// request can be retried once with a freshly fetched token
+func WithTokenInvalidator(invalidate func()) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.invalidateToken = invalidate
+    }
+}
+
+// WithRateLimiter makes every request wait for the limiter
+func WithRateLimiter(l *RateLimiter) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.rateLimiter = l
+    }
+}
+
+// WithCircuitBreaker fails requests fast while CAPI is unhealthy. Errors and
+// 5xx responses count as failures.
+func WithCircuitBreaker(b *CircuitBreaker) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.breaker = b
+    }
+}
+
+// WithMiddleware wraps every request in the given middleware. The first
+// middleware is the outermost one.
+func WithMiddleware(middleware ...models.Middleware) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.middleware = append(c.middleware, middleware...)
+    }
+}
+
+// WithLogger logs every request
+func WithLogger(logger *slog.Logger) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.logger = logger
+    }
+}
+
+// WithMetrics records the method, path template, status and duration of
+// every request
+func WithMetrics(m Metrics) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.metrics = m
+    }
+}
+
+// WithTracerProvider records a span for every request and for getting its
+// token
+func WithTracerProvider(tp trace.TracerProvider) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.tracer = Tracer(tp)
+    }
+}
+
+// WithPropagator injects the trace context into every request. W3C trace
+// context is used by default.
+func WithPropagator(p propagation.TextMapPropagator) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.propagator = p
+    }
+}
+
+// WithResponseObserver is called with the request id, headers and duration of
+// every successful request
+func WithResponseObserver(observe func(models.ResponseMetadata)) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.onResponse = observe
+    }
+}
+
+// WithWarningsHandler is called with every response, successful or not, that
+// carries X-Cf-Warnings
+func WithWarningsHandler(handle func(models.ResponseMetadata)) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.onWarnings = handle
+    }
+}
+
+// WithDryRun skips POST, PUT, PATCH and DELETE requests and returns a
+// *models.DryRunError with the request instead. GET requests are still sent.
+func WithDryRun(dryRun bool) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.dryRun = dryRun
+    }
+}
+
+// WithDryRunObserver is called with every request that is skipped in dry run
+// mode
+func WithDryRunObserver(observe func(models.DryRunRequest)) CapiDoerOption {
+    return func(c *CapiDoer) {
+        c.onDryRun = observe
+    }
+}
+
+func NewCapiDoer(httpClient httpClient, capiUrl string, tokenGetter tokenGetter, opts ...CapiDoerOption) *CapiDoer {
+    c := &CapiDoer{
         httpClient: httpClient,
         capiUrl:    capiUrl,
         getToken:   tokenGetter,
     }
+    for _, o := range opts {
+        o(c)
+    }
+    c.logger = loggerOrDiscard(c.logger)
+    c.metrics = metricsOrNoop(c.metrics)
+    c.propagator = propagatorOrDefault(c.propagator)
+    if c.tracer == nil {
+        c.tracer = Tracer(nil)
+    }
+
+    c.roundTrip = c.send
+    for i := len(c.middleware) - 1; i >= 0; i-- {
+        c.roundTrip = c.middleware[i](c.roundTrip)
+    }
+
+    return c
 }
 
-func (c *CapiDoer) Do(method, path, body string, v interface{}, opts ...models.HeaderOption) error {
-    return c.doUrl(method, c.capiUrl+path, body, v, opts...)
+func (c *CapiDoer) Do(ctx context.Context, method, path, body string, v interface{}, opts ...models.HeaderOption) error {
+    _, err := c.doUrl(ctx, method, c.capiUrl+path, body, v, opts...)
+    return err
 }
 
-func (c *CapiDoer) doUrl(method, url, body string, v interface{}, opts ...models.HeaderOption) error {
-    req, err := c.buildReq(method, url, body, opts...)
+// DoJob sends a request that CAPI completes asynchronously and returns the
+// location of the job to poll. The location is empty if CAPI completed the
+// request right away.
+func (c *CapiDoer) DoJob(ctx context.Context, method, path, body string, opts ...models.HeaderOption) (string, error) {
+    md, err := c.doUrl(ctx, method, c.capiUrl+path, body, nil, opts...)
+    return md.JobLocation, err
+}
+
+func (c *CapiDoer) doUrl(ctx context.Context, method, url, body string, v interface{}, opts ...models.HeaderOption) (models.ResponseMetadata, error) {
+    md, err := c.try(ctx, method, url, body, v, 0, opts...)
+    if isUnauthorized(err) && c.invalidateToken != nil && !hasAuthorization(opts) {
+        c.invalidateToken()
+        md, err = c.try(ctx, method, url, body, v, 1, opts...)
+    }
+
+    if target := models.ResponseMetadataFrom(ctx); target != nil && err == nil {
+        *target = md
+    }
+
+    return md, err
+}
+
+func (c *CapiDoer) try(ctx context.Context, method, url, body string, v interface{}, retries int, opts ...models.HeaderOption) (md models.ResponseMetadata, err error) {
+    req, err := c.buildReq(ctx, method, url, body, opts...)
     if err != nil {
-        return err
+        return md, err
     }
 
-    resp, err := c.httpClient.Do(req)
+    if c.dryRun && isMutating(method) {
+        c.logger.Info("capi dry run", slog.String("method", method), slog.String("path", req.URL.Path))
+        dryRun := newDryRunRequest(req, body)
+        if c.onDryRun != nil {
+            c.onDryRun(dryRun)
+        }
+        return md, &models.DryRunError{Request: dryRun}
+    }
+
+    ctx, span := c.startRequestSpan(req, retries)
+    defer func() { EndSpan(span, err) }()
+    req = req.WithContext(ctx)
+    c.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+    if c.rateLimiter != nil {
+        err = c.rateLimiter.Wait(req.Context())
+        if err != nil {
+            return md, err
+        }
+    }
+
+    start := time.Now()
+    resp, err := c.exchange(req)
+    logRequest(c.logger, "capi", req, resp, err, start, retries)
+    c.recordRequest(req, resp, err, start)
     if err != nil {
-        return err
+        return md, err
     }
+    duration := time.Since(start)
+    span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
     defer resp.Body.Close()
 
+    if c.rateLimiter != nil {
+        c.rateLimiter.Observe(resp.Header)
+    }
+
+    requestID := resp.Header.Get(models.RequestIDHeader)
+    md = models.ResponseMetadata{
+        Method:     method,
+        Path:       req.URL.Path,
+        StatusCode: resp.StatusCode,
+        RequestID:  requestID,
+        Header:     resp.Header,
+        Duration:   duration,
+        Warnings:   parseWarnings(resp.Header),
+    }
+    if len(md.Warnings) > 0 && c.onWarnings != nil {
+        c.onWarnings(md)
+    }
+
     if code := resp.StatusCode; code > 299 || code < 200 {
-        return &CapiError{
+        return models.ResponseMetadata{}, &CapiError{
             ResponseCode: resp.StatusCode,
-            message:              fmt.Sprintf("CAPI request (%s %s) returned unexpected status (%d): %s",
-                method, url, code, decodeCapiErr(resp.Body)),
+            RequestID:    requestID,
+            Header:       resp.Header,
+            Duration:     duration,
+            Warnings:     md.Warnings,
+            message: fmt.Sprintf("CAPI request (%s %s) returned unexpected status (%d): %s%s",
+                method, url, code, decodeCapiErr(resp.Body), formatRequestID(requestID)),
         }
     }
 
     if v != nil {
-        return json.NewDecoder(resp.Body).Decode(v)
+        err = json.NewDecoder(resp.Body).Decode(v)
+        if err != nil {
+            return models.ResponseMetadata{}, err
+        }
     }
 
-    return nil
+    if resp.StatusCode == http.StatusAccepted {
+        md.JobLocation = resp.Header.Get("Location")
+    }
+
+    if c.onResponse != nil {
+        c.onResponse(md)
+    }
+
+    return md, nil
+}
+
+func formatRequestID(requestID string) string {
+    if requestID == "" {
+        return ""
+    }
+    return fmt.Sprintf(" [request id: %s]", requestID)
+}
+
+// send is the innermost round trip, so that the circuit breaker only counts
+// the outcome of the request itself and not the errors of the middleware
+func (c *CapiDoer) send(req *http.Request) (*http.Response, error) {
+    if c.breaker == nil {
+        return c.httpClient.Do(req)
+    }
+
+    generation, err := c.breaker.Allow()
+    if err != nil {
+        return nil, err
+    }
+
+    resp, err := c.httpClient.Do(req)
+    c.breaker.Done(generation, req, resp, err)
+    return resp, err
+}
+
+// exchange runs the request through the middleware and the http client. A
+// middleware that returns neither a response nor an error gets an error
+// instead of a nil response.
+func (c *CapiDoer) exchange(req *http.Request) (*http.Response, error) {
+    resp, err := c.roundTrip(req)
+    if resp == nil && err == nil {
+        return nil, fmt.Errorf("no response or error returned for %s %s", req.Method, req.URL.Path)
+    }
+    return resp, err
+}
+
+func (c *CapiDoer) startRequestSpan(req *http.Request, retries int) (context.Context, trace.Span) {
+    attrs := []attribute.KeyValue{
+        attribute.String("http.request.method", req.Method),
+        attribute.String("server.address", req.URL.Hostname()),
+        attribute.String("url.path", req.URL.Path),
+    }
+    if retries > 0 {
+        attrs = append(attrs, attribute.Int("http.request.resend_count", retries))
+    }
+
+    return c.tracer.Start(req.Context(), req.Method+" "+pathTemplate(req.URL.Path),
+        trace.WithSpanKind(trace.SpanKindClient),
+        trace.WithAttributes(attrs...),
+    )
+}
+
+func (c *CapiDoer) recordRequest(req *http.Request, resp *http.Response, err error, start time.Time) {
+    status := 0
+    if err == nil && resp != nil {
+        status = resp.StatusCode
+    }
+
+    c.metrics.CapiRequest(req.Method, pathTemplate(req.URL.Path), status, time.Since(start))
+}
+
+// parseWarnings decodes the comma separated, url encoded X-Cf-Warnings
+func parseWarnings(header http.Header) []string {
+    var warnings []string
+    for _, value := range header.Values("X-Cf-Warnings") {
+        for _, w := range strings.Split(value, ",") {
+            decoded, err := neturl.QueryUnescape(strings.TrimSpace(w))
+            if err != nil {
+                decoded = strings.TrimSpace(w)
+            }
+            if decoded != "" {
+                warnings = append(warnings, decoded)
+            }
+        }
+    }
+
+    return warnings
+}
+
+func isUnauthorized(err error) bool {
+    capiErr, ok := err.(*CapiError)
+    return ok && capiErr != nil && capiErr.ResponseCode == http.StatusUnauthorized
+}
+
+func hasAuthorization(opts []models.HeaderOption) bool {
+    header := http.Header{}
+    for _, o := range opts {
+        o(&header)
+    }
+
+    _, ok := header["Authorization"]
+    return ok
 }
 
 func decodeCapiErr(body io.Reader) error {
@@ -70,8 +376,8 @@ func decodeCapiErr(body io.Reader) error {
     return fmt.Errorf("%s (%s)", capiErr.Title, capiErr.Detail)
 }
 
-func (c *CapiDoer) buildReq(method string, url string, body string, opts ...models.HeaderOption) (*http.Request, error) {
-    req, err := http.NewRequest(method, url, ioutil.NopCloser(strings.NewReader(body)))
+func (c *CapiDoer) buildReq(ctx context.Context, method string, url string, body string, opts ...models.HeaderOption) (*http.Request, error) {
+    req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
     if err != nil {
         return nil, err
     }
@@ -82,7 +388,7 @@ func (c *CapiDoer) buildReq(method string, url string, body string, opts ...mode
     }
 
     if _, ok := req.Header["Authorization"]; !ok {
-        token, err := c.getToken()
+        token, err := c.token(ctx)
         if err != nil {
             return nil, err
         }
@@ -93,6 +399,13 @@ func (c *CapiDoer) buildReq(method string, url string, body string, opts ...mode
     return req, err
 }
 
+func (c *CapiDoer) token(ctx context.Context) (token string, err error) {
+    ctx, span := c.tracer.Start(ctx, "uaa token")
+    defer func() { EndSpan(span, err) }()
+
+    return c.getToken(ctx)
+}
+
 type paginatedResp struct {
     Resources  json.RawMessage `json:"resources"`
     Pagination pagination      `json:"pagination"`
@@ -106,11 +419,11 @@ type pagination struct {
 
 type Accumulator func(json.RawMessage) error
 
-func (c *CapiDoer) GetPagedResources(path string, a Accumulator, opts ...models.HeaderOption) error {
+func (c *CapiDoer) GetPagedResources(ctx context.Context, path string, a Accumulator, opts ...models.HeaderOption) error {
     var err error
     url := c.capiUrl + path
     for url != "" {
-        url, err = c.getPage(url, a, opts...)
+        url, err = c.getPage(ctx, url, a, opts...)
         if err != nil {
             return err
         }
@@ -119,9 +432,9 @@ func (c *CapiDoer) GetPagedResources(path string, a Accumulator, opts ...models.
     return nil
 }
 
-func (c *CapiDoer) getPage(url string, a Accumulator, opts ...models.HeaderOption) (string, error) {
+func (c *CapiDoer) getPage(ctx context.Context, url string, a Accumulator, opts ...models.HeaderOption) (string, error) {
     var page = &paginatedResp{}
-    capiError := c.doUrl(http.MethodGet, url, "", page, opts...)
+    _, capiError := c.doUrl(ctx, http.MethodGet, url, "", page, opts...)
     if capiError != nil {
         return "", capiError
     }
@@ -140,6 +453,14 @@ func (c *CapiDoer) getPage(url string, a Accumulator, opts ...models.HeaderOptio
 
 type CapiError struct {
     ResponseCode int
+
+    // RequestID is the X-Vcap-Request-Id to look for in the Cloud
+    // Controller logs
+    RequestID string
+    Header    http.Header
+    Duration  time.Duration
+    Warnings  []string
+
     message string
 }
 
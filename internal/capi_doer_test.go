@@ -1,13 +1,28 @@
 package internal_test
 
 import (
+    "bytes"
+    "context"
     "encoding/json"
     "errors"
+    "fmt"
     "github.com/onsi/gomega/types"
+    "io/ioutil"
+    "log/slog"
     "net/http"
+    "strconv"
+    "strings"
+    "time"
 
     "github.com/pivotal-cf/app-automator-cf-client/internal"
     "github.com/pivotal-cf/app-automator-cf-client/internal/mocks"
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/propagation"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+    "go.opentelemetry.io/otel/trace"
 
     . "github.com/onsi/ginkgo"
     . "github.com/onsi/ginkgo/extensions/table"
@@ -20,6 +35,7 @@ var _ = Describe("CapiDoer", func() {
         httpClient  *mocks.HttpClient
         getTokenCalls int
         getTokenErr error
+        invalidateCalls int
     }
 
     var setup = func(respBodies ...string) (*internal.CapiDoer, *testContext) {
@@ -30,10 +46,12 @@ var _ = Describe("CapiDoer", func() {
         tc := &testContext{
             httpClient: httpClient,
         }
-        client := internal.NewCapiDoer(tc.httpClient, "https://example.com", func() (string, error) {
+        client := internal.NewCapiDoer(tc.httpClient, "https://example.com", func(context.Context) (string, error) {
             tc.getTokenCalls++
             return "bearer lemons", tc.getTokenErr
-        })
+        }, internal.WithTokenInvalidator(func() {
+            tc.invalidateCalls++
+        }))
 
         return client, tc
     }
@@ -42,7 +60,7 @@ var _ = Describe("CapiDoer", func() {
         It("does the request", func() {
             client, tc := setup(`{"body": 1}`)
 
-            err := client.Do(http.MethodGet, "/v2/lemons", "I want lemons", nil)
+            err := client.Do(context.Background(), http.MethodGet, "/v2/lemons", "I want lemons", nil)
             Expect(err).ToNot(HaveOccurred())
 
             Expect(tc.httpClient.Reqs).To(Receive(Equal(mocks.HttpRequest{
@@ -59,7 +77,7 @@ var _ = Describe("CapiDoer", func() {
         It("applies header options", func() {
             client, tc := setup(`{"body": 1}`)
 
-            err := client.Do(http.MethodGet, "/v2/lemons", "I want lemons", nil, func(header *http.Header) {
+            err := client.Do(context.Background(), http.MethodGet, "/v2/lemons", "I want lemons", nil, func(header *http.Header) {
                 header.Add("Limes", "grapefruit")
             })
             Expect(err).ToNot(HaveOccurred())
@@ -72,7 +90,7 @@ var _ = Describe("CapiDoer", func() {
         It("does not get auth token if provided in header options", func() {
             client, tc := setup(`{"body": 1}`)
 
-            err := client.Do(http.MethodGet, "/v2/lemons", "I want lemons", nil, func(header *http.Header) {
+            err := client.Do(context.Background(), http.MethodGet, "/v2/lemons", "I want lemons", nil, func(header *http.Header) {
                 header.Add("Authorization", "grapefruit")
             })
             Expect(err).ToNot(HaveOccurred())
@@ -83,10 +101,443 @@ var _ = Describe("CapiDoer", func() {
             Expect(req.Headers).To(HaveKeyWithValue("Authorization", []string{"grapefruit"}))
         })
 
+        It("invalidates the token and retries once on 401", func() {
+            client, tc := setup(`{"body": 1}`, `{"body": 2}`)
+            tc.httpClient.Statuses <- http.StatusUnauthorized
+
+            resp := &struct {
+                Body int `json:"body"`
+            }{}
+            err := client.Do(context.Background(), http.MethodGet, "/v2/lemons", "I want lemons", resp)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(resp.Body).To(Equal(2))
+
+            Expect(tc.invalidateCalls).To(Equal(1))
+            Expect(tc.getTokenCalls).To(Equal(2))
+            Expect(tc.httpClient.Reqs).To(HaveLen(2))
+        })
+
+        It("returns the error if the retry is also unauthorized", func() {
+            client, tc := setup(`{"body": 1}`, `{"body": 2}`)
+            tc.httpClient.Status = http.StatusUnauthorized
+
+            err := client.Do(context.Background(), http.MethodGet, "/v2/lemons", "I want lemons", nil)
+            Expect(err).To(HaveOccurred())
+
+            capiErr, _ := err.(*internal.CapiError)
+            Expect(capiErr.ResponseCode).To(Equal(http.StatusUnauthorized))
+            Expect(tc.invalidateCalls).To(Equal(1))
+            Expect(tc.httpClient.Reqs).To(HaveLen(2))
+        })
+
+        It("returns the request id, headers and duration of failed requests", func() {
+            client, tc := setup(`{"errors": [{"title": "CF-ResourceNotFound", "detail": "App not found"}]}`)
+            tc.httpClient.Status = http.StatusNotFound
+            tc.httpClient.Header = http.Header{
+                "X-Vcap-Request-Id": {"my-id::cc-id"},
+                "X-Runtime":         {"0.05"},
+            }
+
+            err := client.Do(context.Background(), http.MethodGet, "/v3/apps/lemons", "", nil, models.WithRequestID("my-id"))
+            Expect(err).To(MatchError(ContainSubstring("[request id: my-id::cc-id]")))
+
+            capiErr, ok := err.(*internal.CapiError)
+            Expect(ok).To(BeTrue())
+            Expect(capiErr.RequestID).To(Equal("my-id::cc-id"))
+            Expect(capiErr.Header).To(HaveKeyWithValue("X-Runtime", []string{"0.05"}))
+            Expect(capiErr.Duration).To(BeNumerically(">", 0))
+
+            var req mocks.HttpRequest
+            Expect(tc.httpClient.Reqs).To(Receive(&req))
+            Expect(req.Headers.Get("X-Vcap-Request-Id")).To(Equal("my-id"))
+        })
+
+        It("reports the metadata of successful requests", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Header = http.Header{"X-Vcap-Request-Id": {"cc-id"}}
+            var responses []models.ResponseMetadata
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithResponseObserver(func(md models.ResponseMetadata) {
+                responses = append(responses, md)
+            }))
+
+            Expect(client.Do(context.Background(), http.MethodPost, "/v3/apps/lemons/actions/stop", "", nil)).To(Succeed())
+            httpClient.Status = http.StatusBadGateway
+            Expect(client.Do(context.Background(), http.MethodPost, "/v3/apps/lemons/actions/stop", "", nil)).ToNot(Succeed())
+
+            Expect(responses).To(HaveLen(1))
+            Expect(responses[0]).To(MatchFields(IgnoreExtras, Fields{
+                "Method":     Equal(http.MethodPost),
+                "Path":       Equal("/v3/apps/lemons/actions/stop"),
+                "StatusCode": Equal(http.StatusOK),
+                "RequestID":  Equal("cc-id"),
+                "Header":     HaveKey("X-Vcap-Request-Id"),
+                "Duration":   BeNumerically(">", 0),
+            }))
+        })
+
+        It("fills the metadata of a single call", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Header = http.Header{"X-Vcap-Request-Id": {"cc-id"}}
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            })
+
+            var md models.ResponseMetadata
+            Expect(client.Do(models.WithResponseMetadata(context.Background(), &md), http.MethodPost, "/v3/apps/lemons/actions/stop", "", nil)).To(Succeed())
+            Expect(md.Path).To(Equal("/v3/apps/lemons/actions/stop"))
+            Expect(md.RequestID).To(Equal("cc-id"))
+            Expect(md.Duration).To(BeNumerically(">", 0))
+
+            By("leaving it unchanged if the request fails")
+            httpClient.Status = http.StatusBadGateway
+            failed := models.ResponseMetadata{RequestID: "unchanged"}
+            Expect(client.Do(models.WithResponseMetadata(context.Background(), &failed), http.MethodPost, "/v3/apps/lemons/actions/stop", "", nil)).ToNot(Succeed())
+            Expect(failed.RequestID).To(Equal("unchanged"))
+        })
+
+        It("does not retry on 401 if the auth token was provided in header options", func() {
+            client, tc := setup(`{"body": 1}`)
+            tc.httpClient.Status = http.StatusUnauthorized
+
+            err := client.Do(context.Background(), http.MethodGet, "/v2/lemons", "I want lemons", nil, func(header *http.Header) {
+                header.Add("Authorization", "grapefruit")
+            })
+            Expect(err).To(HaveOccurred())
+            Expect(tc.invalidateCalls).To(Equal(0))
+            Expect(tc.httpClient.Reqs).To(HaveLen(1))
+        })
+
+        It("waits for the rate limiter and observes its headers", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Header = http.Header{
+                "X-Ratelimit-Remaining": {"0"},
+                "X-Ratelimit-Reset":     {strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)},
+            }
+            limiter := internal.NewRateLimiter(0, 1)
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithRateLimiter(limiter))
+
+            Expect(client.Do(context.Background(), http.MethodGet, "/v2/lemons", "", nil)).To(Succeed())
+
+            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+            defer cancel()
+            Expect(limiter.Wait(ctx)).To(MatchError(context.DeadlineExceeded))
+        })
+
+        It("fails fast once the circuit breaker opens", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Status = http.StatusBadGateway
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithCircuitBreaker(internal.NewCircuitBreaker("capi", 2, time.Hour, nil)))
+
+            Expect(client.Do(context.Background(), http.MethodGet, "/v2/lemons", "", nil)).ToNot(Succeed())
+            Expect(client.Do(context.Background(), http.MethodGet, "/v2/lemons", "", nil)).ToNot(Succeed())
+            Expect(client.Do(context.Background(), http.MethodGet, "/v2/lemons", "", nil)).To(MatchError(internal.ErrCircuitOpen))
+
+            Expect(httpClient.Reqs).To(HaveLen(2))
+        })
+
+        It("does not count client errors as circuit breaker failures", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Status = http.StatusUnprocessableEntity
+            breaker := internal.NewCircuitBreaker("capi", 1, time.Hour, nil)
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithCircuitBreaker(breaker))
+
+            Expect(client.Do(context.Background(), http.MethodGet, "/v2/lemons", "", nil)).ToNot(Succeed())
+            Expect(breaker.State()).To(Equal(internal.CircuitClosed))
+        })
+
+        It("does not count cancelled requests or middleware errors as circuit breaker failures", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Err = context.Canceled
+            breaker := internal.NewCircuitBreaker("capi", 1, time.Hour, nil)
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithCircuitBreaker(breaker), internal.WithMiddleware(func(next models.RoundTripFunc) models.RoundTripFunc {
+                return func(req *http.Request) (*http.Response, error) {
+                    if req.Method == http.MethodPost {
+                        return nil, errors.New("injected fault")
+                    }
+                    return next(req)
+                }
+            }))
+
+            ctx, cancel := context.WithCancel(context.Background())
+            cancel()
+            Expect(client.Do(ctx, http.MethodGet, "/v2/lemons", "", nil)).To(MatchError(ContainSubstring("canceled")))
+            Expect(client.Do(context.Background(), http.MethodPost, "/v2/lemons", "", nil)).To(MatchError("injected fault"))
+            Expect(breaker.State()).To(Equal(internal.CircuitClosed))
+        })
+
+        It("runs the request through the middleware in order", func() {
+            httpClient := mocks.NewHttpClient()
+            var calls []string
+            var record = func(name string) models.Middleware {
+                return func(next models.RoundTripFunc) models.RoundTripFunc {
+                    return func(req *http.Request) (*http.Response, error) {
+                        calls = append(calls, name+" "+req.Method+" "+req.URL.Path)
+                        req.Header.Add("Correlation-Id", name)
+                        resp, err := next(req)
+                        calls = append(calls, fmt.Sprintf("%s %d", name, resp.StatusCode))
+                        return resp, err
+                    }
+                }
+            }
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithMiddleware(record("outer"), record("inner")))
+
+            Expect(client.Do(context.Background(), http.MethodPost, "/v2/lemons", "I want lemons", nil)).To(Succeed())
+
+            Expect(calls).To(Equal([]string{
+                "outer POST /v2/lemons",
+                "inner POST /v2/lemons",
+                "inner 200",
+                "outer 200",
+            }))
+
+            var req mocks.HttpRequest
+            Expect(httpClient.Reqs).To(Receive(&req))
+            Expect(req.Body).To(Equal("I want lemons"))
+            Expect(req.Headers).To(HaveKeyWithValue("Correlation-Id", []string{"outer", "inner"}))
+        })
+
+        It("lets middleware read the body and answer the request", func() {
+            httpClient := mocks.NewHttpClient()
+            var seenBody string
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithMiddleware(func(next models.RoundTripFunc) models.RoundTripFunc {
+                return func(req *http.Request) (*http.Response, error) {
+                    body, err := req.GetBody()
+                    Expect(err).ToNot(HaveOccurred())
+                    b, _ := ioutil.ReadAll(body)
+                    seenBody = string(b)
+                    return nil, errors.New("injected fault")
+                }
+            }))
+
+            err := client.Do(context.Background(), http.MethodPost, "/v2/lemons", "I want lemons", nil)
+            Expect(err).To(MatchError("injected fault"))
+            Expect(seenBody).To(Equal("I want lemons"))
+            Expect(httpClient.Reqs).To(BeEmpty())
+        })
+
+        It("returns an error if the middleware returns no response and no error", func() {
+            httpClient := mocks.NewHttpClient()
+            breaker := internal.NewCircuitBreaker("capi", 1, time.Hour, nil)
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithCircuitBreaker(breaker), internal.WithMiddleware(func(next models.RoundTripFunc) models.RoundTripFunc {
+                return func(req *http.Request) (*http.Response, error) {
+                    return nil, nil
+                }
+            }))
+
+            err := client.Do(context.Background(), http.MethodGet, "/v2/lemons", "", nil)
+            Expect(err).To(MatchError("no response or error returned for GET /v2/lemons"))
+            Expect(breaker.State()).To(Equal(internal.CircuitClosed))
+            Expect(httpClient.Reqs).To(BeEmpty())
+        })
+
+        It("logs the request without the authorization header", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Header = http.Header{"X-Vcap-Request-Id": {"request-id"}}
+            httpClient.Statuses <- http.StatusUnauthorized
+
+            buf := &bytes.Buffer{}
+            logger := slog.New(slog.NewJSONHandler(buf, nil))
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer secret-token", nil
+            }, internal.WithLogger(logger), internal.WithTokenInvalidator(func() {}))
+
+            Expect(client.Do(context.Background(), http.MethodGet, "/v2/lemons?q=secret-query", "", nil)).To(Succeed())
+
+            lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+            Expect(lines).To(HaveLen(2))
+
+            var entry map[string]interface{}
+            Expect(json.Unmarshal([]byte(lines[1]), &entry)).To(Succeed())
+            Expect(entry).To(And(
+                HaveKeyWithValue("component", "capi"),
+                HaveKeyWithValue("method", "GET"),
+                HaveKeyWithValue("path", "/v2/lemons"),
+                HaveKeyWithValue("status", BeNumerically("==", 200)),
+                HaveKeyWithValue("retries", BeNumerically("==", 1)),
+                HaveKeyWithValue("request_id", "request-id"),
+                HaveKey("duration"),
+            ))
+            Expect(buf.String()).ToNot(ContainSubstring("secret"))
+        })
+
+        It("records spans for the token and the request and propagates the trace context", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Statuses <- http.StatusUnauthorized
+            recorder := tracetest.NewSpanRecorder()
+            provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithTracerProvider(provider), internal.WithTokenInvalidator(func() {}))
+
+            ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+            Expect(client.Do(ctx, http.MethodGet, "/v3/apps/8d1c0ad0-6b8a-4a1e-9d2b-0a6d2b1c9f3e", "", nil)).To(Succeed())
+            parent.End()
+
+            spans := recorder.Ended()
+            var names []string
+            for _, span := range spans[:4] {
+                Expect(span.Parent().SpanID()).To(Equal(parent.SpanContext().SpanID()))
+            }
+            for _, span := range spans {
+                names = append(names, span.Name())
+            }
+            Expect(names).To(Equal([]string{
+                "uaa token", "GET /v3/apps/:guid",
+                "uaa token", "GET /v3/apps/:guid",
+                "parent",
+            }))
+
+            Expect(spans[1].Status().Code).To(Equal(codes.Error))
+            Expect(spans[3].Status().Code).To(Equal(codes.Unset))
+            Expect(spans[3].SpanKind()).To(Equal(trace.SpanKindClient))
+            Expect(spans[3].Attributes()).To(ContainElements(
+                attribute.String("http.request.method", "GET"),
+                attribute.String("server.address", "example.com"),
+                attribute.String("url.path", "/v3/apps/8d1c0ad0-6b8a-4a1e-9d2b-0a6d2b1c9f3e"),
+                attribute.Int("http.response.status_code", 200),
+                attribute.Int("http.request.resend_count", 1),
+            ))
+
+            var req mocks.HttpRequest
+            Expect(httpClient.Reqs).To(Receive())
+            Expect(httpClient.Reqs).To(Receive(&req))
+            traceparent := fmt.Sprintf("00-%s-%s-01", spans[3].SpanContext().TraceID(), spans[3].SpanContext().SpanID())
+            Expect(req.Headers.Get("Traceparent")).To(Equal(traceparent))
+        })
+
+        It("uses the given propagator", func() {
+            httpClient := mocks.NewHttpClient()
+            provider := sdktrace.NewTracerProvider()
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithTracerProvider(provider), internal.WithPropagator(propagation.Baggage{}))
+
+            Expect(client.Do(context.Background(), http.MethodGet, "/v2/lemons", "", nil)).To(Succeed())
+
+            var req mocks.HttpRequest
+            Expect(httpClient.Reqs).To(Receive(&req))
+            Expect(req.Headers).ToNot(HaveKey("Traceparent"))
+        })
+
+        It("reports the warnings of successful and failed requests", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Header = http.Header{"X-Cf-Warnings": {
+                "Memory%20quota%20is%2090%25%20used,Deprecated%2C%20use%20v3",
+                "another",
+            }}
+            var warned []models.ResponseMetadata
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithWarningsHandler(func(md models.ResponseMetadata) {
+                warned = append(warned, md)
+            }))
+
+            Expect(client.Do(context.Background(), http.MethodPost, "/v3/apps/lemons/actions/stop", "", nil)).To(Succeed())
+            httpClient.Status = http.StatusUnprocessableEntity
+            err := client.Do(context.Background(), http.MethodPost, "/v3/apps/lemons/actions/stop", "", nil)
+
+            expected := []string{"Memory quota is 90% used", "Deprecated, use v3", "another"}
+            Expect(warned).To(HaveLen(2))
+            Expect(warned[0].Warnings).To(Equal(expected))
+            Expect(warned[0].Path).To(Equal("/v3/apps/lemons/actions/stop"))
+            Expect(warned[1].StatusCode).To(Equal(http.StatusUnprocessableEntity))
+
+            capiErr, ok := err.(*internal.CapiError)
+            Expect(ok).To(BeTrue())
+            Expect(capiErr.Warnings).To(Equal(expected))
+        })
+
+        It("does not report responses without warnings", func() {
+            called := false
+            client := internal.NewCapiDoer(mocks.NewHttpClient(), "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithWarningsHandler(func(models.ResponseMetadata) {
+                called = true
+            }))
+
+            Expect(client.Do(context.Background(), http.MethodGet, "/v2/lemons", "", nil)).To(Succeed())
+            Expect(called).To(BeFalse())
+        })
+
+        It("reports the request instead of sending it in dry run mode", func() {
+            httpClient := mocks.NewHttpClient()
+            var dryRuns []models.DryRunRequest
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithDryRun(true), internal.WithDryRunObserver(func(r models.DryRunRequest) {
+                dryRuns = append(dryRuns, r)
+            }))
+
+            err := client.Do(context.Background(), http.MethodPost, "/v3/apps/lemons/processes/web/actions/scale", `{"instances": 3}`, nil, models.WithRequestID("my-id"))
+            var dryRunErr *models.DryRunError
+            Expect(errors.As(err, &dryRunErr)).To(BeTrue())
+            Expect(err).To(MatchError(`dry run: would send POST https://example.com/v3/apps/lemons/processes/web/actions/scale with {"instances": 3}`))
+
+            dryRun := dryRunErr.Request
+            Expect(dryRuns).To(Equal([]models.DryRunRequest{dryRun}))
+            Expect(dryRun.String()).To(Equal(`POST https://example.com/v3/apps/lemons/processes/web/actions/scale with {"instances": 3}`))
+            Expect(dryRun.Method).To(Equal(http.MethodPost))
+            Expect(dryRun.Body).To(Equal(`{"instances": 3}`))
+            Expect(dryRun.Header.Get("X-Vcap-Request-Id")).To(Equal("my-id"))
+            Expect(dryRun.Header).ToNot(HaveKey("Authorization"))
+            Expect(httpClient.Reqs).To(BeEmpty())
+
+            Expect(client.Do(context.Background(), http.MethodGet, "/v3/apps", "", nil)).To(Succeed())
+            Expect(httpClient.Reqs).To(HaveLen(1))
+        })
+
+        It("returns the job location of accepted requests", func() {
+            client, tc := setup(``, ``)
+            tc.httpClient.Header = http.Header{"Location": {"https://example.com/v3/jobs/job-guid"}}
+            tc.httpClient.Statuses <- http.StatusAccepted
+
+            location, err := client.DoJob(context.Background(), http.MethodDelete, "/v3/apps/lemons", "")
+            Expect(err).ToNot(HaveOccurred())
+            Expect(location).To(Equal("https://example.com/v3/jobs/job-guid"))
+
+            location, err = client.DoJob(context.Background(), http.MethodDelete, "/v3/apps/lemons", "")
+            Expect(err).ToNot(HaveOccurred())
+            Expect(location).To(BeEmpty())
+        })
+
+        It("records metrics with guids replaced in the path", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Statuses <- http.StatusCreated
+            metrics := &mocks.Metrics{}
+            client := internal.NewCapiDoer(httpClient, "https://example.com", func(context.Context) (string, error) {
+                return "bearer lemons", nil
+            }, internal.WithMetrics(metrics))
+
+            Expect(client.Do(context.Background(), http.MethodPost, "/v3/apps/8d1c0ad0-6b8a-4a1e-9d2b-0a6d2b1c9f3e/processes/web/actions/scale?x=y", "", nil)).To(Succeed())
+            httpClient.Err = errors.New("expected error")
+            Expect(client.Do(context.Background(), http.MethodGet, "/v3/apps", "", nil)).ToNot(Succeed())
+
+            Expect(metrics.CapiRequests).To(Equal([]string{
+                "POST /v3/apps/:guid/processes/web/actions/scale 201",
+                "GET /v3/apps 0",
+            }))
+        })
+
         It("does not return an error if body is nil", func() {
             client, _ := setup("")
 
-            err := client.Do(http.MethodGet, "/v2/lemons", "I want lemons", nil)
+            err := client.Do(context.Background(), http.MethodGet, "/v2/lemons", "I want lemons", nil)
             Expect(err).ToNot(HaveOccurred())
         })
 
@@ -96,7 +547,7 @@ var _ = Describe("CapiDoer", func() {
             resp := &struct {
                 Body int `json:"body"`
             }{}
-            err := client.Do(http.MethodGet, "/v2/lemons", "I want lemons", resp)
+            err := client.Do(context.Background(), http.MethodGet, "/v2/lemons", "I want lemons", resp)
             Expect(err).ToNot(HaveOccurred())
             Expect(resp.Body).To(Equal(1))
         })
@@ -107,7 +558,7 @@ var _ = Describe("CapiDoer", func() {
             resp := &struct {
                 Body int `json:"body"`
             }{}
-            err := client.Do(http.MethodGet, "/v2/lemons", "I want lemons", resp)
+            err := client.Do(context.Background(), http.MethodGet, "/v2/lemons", "I want lemons", resp)
             Expect(err).To(HaveOccurred())
         })
 
@@ -116,7 +567,7 @@ var _ = Describe("CapiDoer", func() {
                 client, tc := setup(`{"body": 1}`)
                 setupFunc(tc)
 
-                err := client.Do(http.MethodGet, "/v2/lemons", "I want lemons", nil)
+                err := client.Do(context.Background(), http.MethodGet, "/v2/lemons", "I want lemons", nil)
                 Expect(err).To(HaveOccurred())
 
                 capiErr, _ := err.(*internal.CapiError)
@@ -144,6 +595,7 @@ var _ = Describe("CapiDoer", func() {
 
             var combinedResps []citrus
             err := client.GetPagedResources(
+                context.Background(),
                 "/v2/lemons",
                 func(resources json.RawMessage) error {
                     var resp []citrus
@@ -177,6 +629,7 @@ var _ = Describe("CapiDoer", func() {
             client, _ := setup(`{"body": 1}`)
 
             err := client.GetPagedResources(
+                context.Background(),
                 "/v2/lemons",
                 func(resources json.RawMessage) error {
                     return errors.New("expected")
@@ -191,6 +644,7 @@ var _ = Describe("CapiDoer", func() {
                 setupFunc(tc)
 
                 err := client.GetPagedResources(
+                    context.Background(),
                     "/v2/lemons",
                     func(resources json.RawMessage) error {
                         return nil
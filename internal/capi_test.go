@@ -1,6 +1,7 @@
 package internal_test
 
 import (
+    "context"
     "encoding/json"
     "errors"
     "net/http"
@@ -13,6 +14,72 @@ import (
 )
 
 var _ = Describe("Capi", func() {
+    Describe("Root()", func() {
+        It("gets the root document", func() {
+            mockDoer := newMockCapiDoer(func(method, path, body string, v interface{}, opts ...models.HeaderOption) error {
+                Expect(method).To(Equal(http.MethodGet))
+                Expect(path).To(Equal("/"))
+                return json.Unmarshal([]byte(validRootResponse), v)
+            })
+            c := internal.NewCapiClient(mockDoer)
+
+            root, err := c.Root()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(root.Links.Login.Href).To(Equal("https://login.sys.example.com"))
+            Expect(root.Links.Uaa.Href).To(Equal("https://uaa.sys.example.com"))
+        })
+
+        It("returns an error if do returns an error", func() {
+            mockDoer := newMockCapiDoer(func(method, path, body string, v interface{}, opts ...models.HeaderOption) error {
+                return errors.New("expected")
+            })
+            c := internal.NewCapiClient(mockDoer)
+
+            _, err := c.Root()
+            Expect(err).To(HaveOccurred())
+        })
+    })
+
+    Describe("Info()", func() {
+        It("gets the v3 info", func() {
+            mockDoer := newMockCapiDoer(func(method, path, body string, v interface{}, opts ...models.HeaderOption) error {
+                Expect(method).To(Equal(http.MethodGet))
+                Expect(path).To(Equal("/v3/info"))
+                return json.Unmarshal([]byte(validInfoResponse), v)
+            })
+            c := internal.NewCapiClient(mockDoer)
+
+            info, err := c.Info()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(info).To(Equal(models.Info{
+                Name:          "vcap",
+                Build:         "3.100.0",
+                Version:       2,
+                Description:   "Cloud Foundry",
+                OsbapiVersion: "2.15",
+                CliVersion: models.CliVersion{
+                    Minimum:     "6.22.0",
+                    Recommended: "7.0.0",
+                },
+                Custom: map[string]interface{}{"arbitrary": "stuff"},
+                Links: models.InfoLinks{
+                    Self:    models.Link{Href: "https://api.example.com/v3/info"},
+                    Support: models.Link{Href: "http://support.example.com"},
+                },
+            }))
+        })
+
+        It("returns an error if do returns an error", func() {
+            mockDoer := newMockCapiDoer(func(method, path, body string, v interface{}, opts ...models.HeaderOption) error {
+                return errors.New("expected")
+            })
+            c := internal.NewCapiClient(mockDoer)
+
+            _, err := c.Info()
+            Expect(err).To(HaveOccurred())
+        })
+    })
+
     Describe("Apps()", func() {
         It("gets the apps", func() {
             mockDoer := newMockCapiGetter(func(path string, a internal.Accumulator, opts ...models.HeaderOption) error {
@@ -79,6 +146,37 @@ var _ = Describe("Capi", func() {
         })
     })
 
+    Describe("ProcessStats()", func() {
+        It("gets the stats of every instance", func() {
+            mockDoer := newMockCapiDoer(func(method, path, body string, v interface{}, opts ...models.HeaderOption) error {
+                Expect(method).To(Equal(http.MethodGet))
+                Expect(path).To(Equal("/v3/apps/app-guid/processes/web/stats"))
+                return json.Unmarshal([]byte(validProcessStatsResponse), v)
+            })
+            c := internal.NewCapiClient(mockDoer)
+
+            stats, err := c.ProcessStats("app-guid", "web")
+            Expect(err).ToNot(HaveOccurred())
+            Expect(stats).To(HaveLen(2))
+            Expect(stats[0].State).To(Equal("RUNNING"))
+            Expect(stats[0].Usage.CPU).To(Equal(0.25))
+            Expect(stats[0].Usage.Mem).To(BeEquivalentTo(134217728))
+            Expect(stats[0].MemQuota).To(BeEquivalentTo(268435456))
+            Expect(stats[1].Index).To(Equal(1))
+            Expect(stats[1].State).To(Equal("CRASHED"))
+        })
+
+        It("returns an error if do returns an error", func() {
+            mockDoer := newMockCapiDoer(func(method, path, body string, v interface{}, opts ...models.HeaderOption) error {
+                return errors.New("expected")
+            })
+            c := internal.NewCapiClient(mockDoer)
+
+            _, err := c.ProcessStats("app-guid", "web")
+            Expect(err).To(HaveOccurred())
+        })
+    })
+
     Describe("Scale()", func() {
         It("scales the process", func() {
             var called bool
@@ -193,14 +291,105 @@ var _ = Describe("Capi", func() {
             Expect(c.Stop("app-guid")).ToNot(Succeed())
         })
     })
+
+    Describe("Start()", func() {
+        It("starts the app", func() {
+            var called bool
+            mockDoer := newMockCapiDoer(func(method, path, body string, v interface{}, opts ...models.HeaderOption) error {
+                called = true
+                Expect(method).To(Equal(http.MethodPost))
+                Expect(path).To(Equal("/v3/apps/app-guid/actions/start"))
+                return nil
+            })
+            c := internal.NewCapiClient(mockDoer)
+
+            Expect(c.Start("app-guid")).To(Succeed())
+            Expect(called).To(BeTrue())
+        })
+
+        It("returns an error if do returns an error", func() {
+            mockDoer := newMockCapiDoer(func(method, path, body string, v interface{}, opts ...models.HeaderOption) error {
+                return errors.New("expected")
+            })
+            c := internal.NewCapiClient(mockDoer)
+
+            Expect(c.Start("app-guid")).ToNot(Succeed())
+        })
+    })
+
+    Describe("Tasks()", func() {
+        It("gets the tasks of the app", func() {
+            mockDoer := newMockCapiGetter(func(path string, a internal.Accumulator, opts ...models.HeaderOption) error {
+                Expect(path).To(And(
+                    ContainSubstring("/v3/apps/app-guid/tasks"),
+                    ContainSubstring("states=RUNNING"),
+                ))
+
+                Expect(a([]byte(tasksPage1))).To(Succeed())
+                Expect(a([]byte(tasksPage2))).To(Succeed())
+                return nil
+            })
+            c := internal.NewCapiClient(mockDoer)
+
+            tasks, err := c.Tasks("app-guid", map[string]string{
+                "states": "RUNNING",
+            })
+
+            Expect(err).ToNot(HaveOccurred())
+            Expect(tasks).To(ConsistOf(
+                models.Task{Guid: "task-guid", Name: "migrate", Command: "rake db:migrate", State: "RUNNING", SequenceID: 1},
+                models.Task{Guid: "task-guid-2", Name: "backup", State: "RUNNING", SequenceID: 2},
+            ))
+        })
+
+        It("returns an error if requestor returns an error", func() {
+            mockDoer := newMockCapiGetter(func(string, internal.Accumulator, ...models.HeaderOption) error {
+                return errors.New("expected")
+            })
+            c := internal.NewCapiClient(mockDoer)
+
+            _, err := c.Tasks("app-guid", nil)
+            Expect(err).To(HaveOccurred())
+        })
+    })
 })
 
 const appsPage1 = `[ { "guid": "app-guid" } ]`
 const appsPage2 = `[ { "guid": "app-guid-2" } ]`
+const tasksPage1 = `[ { "guid": "task-guid", "sequence_id": 1, "name": "migrate", "command": "rake db:migrate", "state": "RUNNING" } ]`
+const tasksPage2 = `[ { "guid": "task-guid-2", "sequence_id": 2, "name": "backup", "state": "RUNNING" } ]`
 const validProcessResponse = `{ "instances": 2 }`
+const validProcessStatsResponse = `{
+  "resources": [
+    {
+      "type": "web",
+      "index": 0,
+      "state": "RUNNING",
+      "usage": { "time": "2016-03-23T23:17:30.476314154Z", "cpu": 0.25, "mem": 134217728, "disk": 1024 },
+      "mem_quota": 268435456,
+      "disk_quota": 1073741824,
+      "uptime": 9042
+    },
+    { "type": "web", "index": 1, "state": "CRASHED" }
+  ]
+}`
 const validTaskResponse = `{"guid": "task-guid"}`
+const validInfoResponse = `{
+  "build": "3.100.0",
+  "cli_version": { "minimum": "6.22.0", "recommended": "7.0.0" },
+  "custom": { "arbitrary": "stuff" },
+  "description": "Cloud Foundry",
+  "name": "vcap",
+  "version": 2,
+  "osbapi_version": "2.15",
+  "links": {
+    "self": { "href": "https://api.example.com/v3/info" },
+    "support": { "href": "http://support.example.com" }
+  }
+}`
 
 type mockCapiRequestor struct {
+    doJob func(method string, path string, body string, opts ...models.HeaderOption) (string, error)
     do  func(method string, path string, body string, v interface{}, opts ...models.HeaderOption) error
     get func(path string, v internal.Accumulator, opts ...models.HeaderOption) error
 }
@@ -213,10 +402,14 @@ func newMockCapiGetter(get func(path string, v internal.Accumulator, opts ...mod
     return &mockCapiRequestor{get: get}
 }
 
-func (d *mockCapiRequestor) Do(method, path string, body string, v interface{}, opts ...models.HeaderOption) error {
+func (d *mockCapiRequestor) Do(ctx context.Context, method, path string, body string, v interface{}, opts ...models.HeaderOption) error {
     return d.do(method, path, body, v, opts...)
 }
 
-func (d *mockCapiRequestor) GetPagedResources(path string, v internal.Accumulator, opts ...models.HeaderOption) error {
+func (d *mockCapiRequestor) DoJob(ctx context.Context, method, path string, body string, opts ...models.HeaderOption) (string, error) {
+    return d.doJob(method, path, body, opts...)
+}
+
+func (d *mockCapiRequestor) GetPagedResources(ctx context.Context, path string, v internal.Accumulator, opts ...models.HeaderOption) error {
     return d.get(path, v, opts...)
 }
\ No newline at end of file
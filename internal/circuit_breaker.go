@@ -0,0 +1,254 @@
+package internal
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "sync"
+    "time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+    defaultCircuitBreakerCooldown = 30 * time.Second
+    probeTimeout                  = 10 * time.Second
+)
+
+type CircuitState int
+
+const (
+    CircuitClosed CircuitState = iota
+    CircuitOpen
+    CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+    switch s {
+    case CircuitClosed:
+        return "closed"
+    case CircuitOpen:
+        return "open"
+    case CircuitHalfOpen:
+        return "half-open"
+    }
+    return "unknown"
+}
+
+type stateChangeFunc func(name string, from, to CircuitState)
+
+// CircuitBreaker opens after threshold consecutive failures and then fails
+// fast with ErrCircuitOpen. A timer moves it to half-open when cooldown has
+// passed. With a probe it checks the service right away, closing the circuit
+// if it is healthy and reopening it for another cooldown if not. Without one
+// the next request is let through as the probe. Outcomes of requests that
+// were let through before the last change of state are ignored.
+type CircuitBreaker struct {
+    name          string
+    threshold     int
+    cooldown      time.Duration
+    onStateChange stateChangeFunc
+    probe         func() bool
+
+    state    CircuitState
+    failures int
+    openedAt time.Time
+    probing  bool
+
+    // generation counts the changes of state, so that neither the timer of
+    // an earlier opening nor a request let through before the last change
+    // acts on the current state
+    generation int
+
+    mu sync.Mutex
+}
+
+type CircuitBreakerOption func(*CircuitBreaker)
+
+// WithProbe checks the health of the service when the cooldown has passed
+// instead of waiting for the next request
+func WithProbe(probe func() bool) CircuitBreakerOption {
+    return func(b *CircuitBreaker) {
+        b.probe = probe
+    }
+}
+
+// NewCircuitBreaker creates a closed breaker. A threshold below 1 is 1 and a
+// cooldown of zero or less is 30s.
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration, onStateChange stateChangeFunc, opts ...CircuitBreakerOption) *CircuitBreaker {
+    if threshold < 1 {
+        threshold = 1
+    }
+    if cooldown <= 0 {
+        cooldown = defaultCircuitBreakerCooldown
+    }
+
+    b := &CircuitBreaker{
+        name:          name,
+        threshold:     threshold,
+        cooldown:      cooldown,
+        onStateChange: onStateChange,
+    }
+    for _, o := range opts {
+        o(b)
+    }
+
+    return b
+}
+
+// HttpProbe returns a probe that considers the service healthy if a GET of
+// url gets a response below 500
+func HttpProbe(httpClient httpClient, url func() (string, error)) func() bool {
+    return func() bool {
+        u, err := url()
+        if err != nil {
+            return false
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+        defer cancel()
+        req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+        if err != nil {
+            return false
+        }
+
+        resp, err := httpClient.Do(req)
+        if err != nil {
+            return false
+        }
+        resp.Body.Close()
+
+        return resp.StatusCode < http.StatusInternalServerError
+    }
+}
+
+func (b *CircuitBreaker) State() CircuitState {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.state
+}
+
+// Allow returns ErrCircuitOpen if the request must not be sent. Otherwise it
+// returns the generation the request is let through under, which must be
+// passed to Record or Cancel.
+func (b *CircuitBreaker) Allow() (int, error) {
+    b.mu.Lock()
+    from := b.state
+
+    var err error
+    switch b.state {
+    case CircuitOpen:
+        // if the timer is late this request is the probe, unless the breaker
+        // probes on its own
+        if b.probe == nil && time.Since(b.openedAt) >= b.cooldown {
+            b.state = CircuitHalfOpen
+            b.generation++
+            b.probing = true
+        } else {
+            err = ErrCircuitOpen
+        }
+    case CircuitHalfOpen:
+        if b.probing {
+            err = ErrCircuitOpen
+        } else {
+            b.probing = true
+        }
+    }
+
+    to := b.state
+    generation := b.generation
+    b.mu.Unlock()
+
+    b.notify(from, to)
+    return generation, err
+}
+
+// Record reports the outcome of a request that was let through under
+// generation. It is ignored if the state has changed since.
+func (b *CircuitBreaker) Record(generation int, success bool) {
+    b.mu.Lock()
+    if generation != b.generation {
+        b.mu.Unlock()
+        return
+    }
+    from := b.state
+
+    b.probing = false
+    if success {
+        b.failures = 0
+        if b.state != CircuitClosed {
+            b.state = CircuitClosed
+            b.generation++
+        }
+    } else {
+        b.failures++
+        if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+            b.open()
+        }
+    }
+
+    to := b.state
+    b.mu.Unlock()
+
+    b.notify(from, to)
+}
+
+// Cancel releases a request that was let through under generation but has
+// no outcome, e.g. because its caller gave up, so that a probe it was can be
+// retried by the next request
+func (b *CircuitBreaker) Cancel(generation int) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if generation == b.generation && b.state == CircuitHalfOpen && b.probe == nil {
+        b.probing = false
+    }
+}
+
+// Done records the outcome of a request sent under generation. A 5xx
+// response or an error is a failure, unless the request's context ended,
+// which says nothing about the service.
+func (b *CircuitBreaker) Done(generation int, req *http.Request, resp *http.Response, err error) {
+    if req.Context().Err() != nil {
+        b.Cancel(generation)
+        return
+    }
+
+    b.Record(generation, err == nil && resp.StatusCode < http.StatusInternalServerError)
+}
+
+// open opens the circuit and schedules the move to half-open. It must be
+// called with mu held.
+func (b *CircuitBreaker) open() {
+    b.state = CircuitOpen
+    b.openedAt = time.Now()
+    b.generation++
+
+    generation := b.generation
+    time.AfterFunc(b.cooldown, func() { b.halfOpen(generation) })
+}
+
+func (b *CircuitBreaker) halfOpen(generation int) {
+    b.mu.Lock()
+    if b.state != CircuitOpen || b.generation != generation {
+        b.mu.Unlock()
+        return
+    }
+
+    b.state = CircuitHalfOpen
+    b.generation++
+    b.probing = b.probe != nil
+    generation = b.generation
+    b.mu.Unlock()
+
+    b.notify(CircuitOpen, CircuitHalfOpen)
+    if b.probe != nil {
+        b.Record(generation, b.probe())
+    }
+}
+
+func (b *CircuitBreaker) notify(from, to CircuitState) {
+    if from != to && b.onStateChange != nil {
+        b.onStateChange(b.name, from, to)
+    }
+}
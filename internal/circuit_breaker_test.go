@@ -0,0 +1,235 @@
+package internal_test
+
+import (
+    "errors"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/internal"
+    "github.com/pivotal-cf/app-automator-cf-client/internal/mocks"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+    type stateChange struct {
+        name     string
+        from, to internal.CircuitState
+    }
+
+    var setup = func(threshold int, cooldown time.Duration, opts ...internal.CircuitBreakerOption) (*internal.CircuitBreaker, func() []stateChange) {
+        var mu sync.Mutex
+        var changes []stateChange
+        b := internal.NewCircuitBreaker("capi", threshold, cooldown, func(name string, from, to internal.CircuitState) {
+            mu.Lock()
+            defer mu.Unlock()
+            changes = append(changes, stateChange{name, from, to})
+        }, opts...)
+        return b, func() []stateChange {
+            mu.Lock()
+            defer mu.Unlock()
+            return append([]stateChange(nil), changes...)
+        }
+    }
+
+    var allow = func(b *internal.CircuitBreaker) error {
+        _, err := b.Allow()
+        return err
+    }
+
+    var fail = func(b *internal.CircuitBreaker, times int) {
+        for i := 0; i < times; i++ {
+            generation, err := b.Allow()
+            Expect(err).ToNot(HaveOccurred())
+            b.Record(generation, false)
+        }
+    }
+
+    It("stays closed below the threshold", func() {
+        b, changes := setup(3, time.Hour)
+        fail(b, 2)
+
+        Expect(allow(b)).To(Succeed())
+        Expect(b.State()).To(Equal(internal.CircuitClosed))
+        Expect(changes()).To(BeEmpty())
+    })
+
+    It("resets the failure count on success", func() {
+        b, _ := setup(2, time.Hour)
+        fail(b, 1)
+        generation, err := b.Allow()
+        Expect(err).ToNot(HaveOccurred())
+        b.Record(generation, true)
+        fail(b, 1)
+
+        Expect(b.State()).To(Equal(internal.CircuitClosed))
+    })
+
+    It("opens after consecutive failures and fails fast", func() {
+        b, changes := setup(2, time.Hour)
+        fail(b, 2)
+
+        Expect(b.State()).To(Equal(internal.CircuitOpen))
+        Expect(allow(b)).To(MatchError(internal.ErrCircuitOpen))
+        Expect(changes()).To(Equal([]stateChange{
+            {"capi", internal.CircuitClosed, internal.CircuitOpen},
+        }))
+    })
+
+    It("lets a single probe through after the cooldown and closes if it succeeds", func() {
+        b, changes := setup(1, 10*time.Millisecond)
+        fail(b, 1)
+        time.Sleep(20 * time.Millisecond)
+
+        generation, err := b.Allow()
+        Expect(err).ToNot(HaveOccurred())
+        Expect(b.State()).To(Equal(internal.CircuitHalfOpen))
+        Expect(allow(b)).To(MatchError(internal.ErrCircuitOpen))
+
+        b.Record(generation, true)
+        Expect(b.State()).To(Equal(internal.CircuitClosed))
+        Expect(allow(b)).To(Succeed())
+
+        Expect(changes()).To(Equal([]stateChange{
+            {"capi", internal.CircuitClosed, internal.CircuitOpen},
+            {"capi", internal.CircuitOpen, internal.CircuitHalfOpen},
+            {"capi", internal.CircuitHalfOpen, internal.CircuitClosed},
+        }))
+    })
+
+    It("goes half-open when the cooldown has passed without waiting for a request", func() {
+        b, changes := setup(1, 10*time.Millisecond)
+        fail(b, 1)
+
+        Eventually(b.State).Should(Equal(internal.CircuitHalfOpen))
+        Expect(changes()).To(Equal([]stateChange{
+            {"capi", internal.CircuitClosed, internal.CircuitOpen},
+            {"capi", internal.CircuitOpen, internal.CircuitHalfOpen},
+        }))
+
+        Expect(allow(b)).To(Succeed())
+        Expect(allow(b)).To(MatchError(internal.ErrCircuitOpen))
+    })
+
+    It("closes when the probe succeeds after the cooldown", func() {
+        b, changes := setup(1, 10*time.Millisecond, internal.WithProbe(func() bool { return true }))
+        fail(b, 1)
+
+        Eventually(b.State).Should(Equal(internal.CircuitClosed))
+        Expect(changes()).To(Equal([]stateChange{
+            {"capi", internal.CircuitClosed, internal.CircuitOpen},
+            {"capi", internal.CircuitOpen, internal.CircuitHalfOpen},
+            {"capi", internal.CircuitHalfOpen, internal.CircuitClosed},
+        }))
+    })
+
+    It("keeps probing on schedule while the probe fails", func() {
+        var probes int32
+        b, _ := setup(1, 10*time.Millisecond, internal.WithProbe(func() bool {
+            atomic.AddInt32(&probes, 1)
+            return false
+        }))
+        fail(b, 1)
+
+        Eventually(func() int32 { return atomic.LoadInt32(&probes) }).Should(BeNumerically(">=", 3))
+        Expect(allow(b)).To(MatchError(internal.ErrCircuitOpen))
+    })
+
+    It("does not let requests through while it probes on its own", func() {
+        release := make(chan struct{})
+        defer close(release)
+        b, _ := setup(1, 10*time.Millisecond, internal.WithProbe(func() bool {
+            <-release
+            return true
+        }))
+        fail(b, 1)
+
+        Eventually(b.State).Should(Equal(internal.CircuitHalfOpen))
+        Expect(allow(b)).To(MatchError(internal.ErrCircuitOpen))
+    })
+
+    Describe("HttpProbe()", func() {
+        var url = func() (string, error) { return "https://example.com/", nil }
+
+        It("is healthy below a 5xx response", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Status = http.StatusNotFound
+            Expect(internal.HttpProbe(httpClient, url)()).To(BeTrue())
+
+            var req mocks.HttpRequest
+            Expect(httpClient.Reqs).To(Receive(&req))
+            Expect(req.Method).To(Equal(http.MethodGet))
+            Expect(req.Url).To(Equal("https://example.com/"))
+        })
+
+        It("is unhealthy on a 5xx response or an error", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Status = http.StatusBadGateway
+            Expect(internal.HttpProbe(httpClient, url)()).To(BeFalse())
+
+            httpClient = mocks.NewHttpClient()
+            httpClient.Err = errors.New("expected")
+            Expect(internal.HttpProbe(httpClient, url)()).To(BeFalse())
+        })
+    })
+
+    It("defaults the cooldown to 30s", func() {
+        for _, cooldown := range []time.Duration{0, -time.Second} {
+            b, _ := setup(1, cooldown)
+            fail(b, 1)
+            time.Sleep(time.Millisecond)
+
+            Expect(allow(b)).To(MatchError(internal.ErrCircuitOpen))
+            Expect(b.State()).To(Equal(internal.CircuitOpen))
+        }
+    })
+
+    It("reopens if the probe fails", func() {
+        b, _ := setup(3, 10*time.Millisecond)
+        fail(b, 3)
+        time.Sleep(20 * time.Millisecond)
+
+        fail(b, 1)
+        Expect(b.State()).To(Equal(internal.CircuitOpen))
+        Expect(allow(b)).To(MatchError(internal.ErrCircuitOpen))
+    })
+
+    It("ignores the outcome of requests let through before it opened", func() {
+        b, changes := setup(1, time.Hour)
+        first, _ := b.Allow()
+        late, _ := b.Allow()
+
+        b.Record(first, false)
+        b.Record(late, true)
+        Expect(b.State()).To(Equal(internal.CircuitOpen))
+        b.Record(late, false)
+        Expect(allow(b)).To(MatchError(internal.ErrCircuitOpen))
+
+        Expect(changes()).To(Equal([]stateChange{
+            {"capi", internal.CircuitClosed, internal.CircuitOpen},
+        }))
+    })
+
+    It("lets the next request probe if the probe is cancelled", func() {
+        b, _ := setup(1, 10*time.Millisecond)
+        fail(b, 1)
+        Eventually(b.State).Should(Equal(internal.CircuitHalfOpen))
+
+        generation, err := b.Allow()
+        Expect(err).ToNot(HaveOccurred())
+        Expect(allow(b)).To(MatchError(internal.ErrCircuitOpen))
+
+        b.Cancel(generation)
+        Expect(b.State()).To(Equal(internal.CircuitHalfOpen))
+        Expect(allow(b)).To(Succeed())
+    })
+
+    It("describes its states", func() {
+        Expect(internal.CircuitClosed.String()).To(Equal("closed"))
+        Expect(internal.CircuitOpen.String()).To(Equal("open"))
+        Expect(internal.CircuitHalfOpen.String()).To(Equal("half-open"))
+    })
+})
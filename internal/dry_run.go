@@ -0,0 +1,27 @@
+package internal
+
+import (
+    "net/http"
+
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+)
+
+func newDryRunRequest(req *http.Request, body string) models.DryRunRequest {
+    header := req.Header.Clone()
+    header.Del("Authorization")
+
+    return models.DryRunRequest{
+        Method: req.Method,
+        URL:    req.URL.String(),
+        Header: header,
+        Body:   body,
+    }
+}
+
+func isMutating(method string) bool {
+    switch method {
+    case http.MethodGet, http.MethodHead, http.MethodOptions:
+        return false
+    }
+    return true
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+    "context"
+    "fmt"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+)
+
+// JobFailedError is returned when an asynchronous CAPI operation fails
+type JobFailedError struct {
+    Job models.Job
+}
+
+func (e *JobFailedError) Error() string {
+    var details []string
+    for _, jobErr := range e.Job.Errors {
+        details = append(details, fmt.Sprintf("%s (%s)", jobErr.Title, jobErr.Detail))
+    }
+
+    return fmt.Sprintf("job %s (%s) failed: %s", e.Job.Guid, e.Job.Operation, strings.Join(details, ", "))
+}
+
+// Job gets the job at the given location, which is either the Location
+// header of an accepted request or the job guid
+func (c *CapiClient) Job(location string) (models.Job, error) {
+    return c.JobContext(context.Background(), location)
+}
+
+// JobContext is Job with a context
+func (c *CapiClient) JobContext(ctx context.Context, location string) (models.Job, error) {
+    path, err := jobPath(location)
+    if err != nil {
+        return models.Job{}, err
+    }
+
+    var j models.Job
+    err = c.get(ctx, path, &j)
+    return j, err
+}
+
+// WaitForJob polls the job until it completes or fails
+func (c *CapiClient) WaitForJob(location string, pollInterval time.Duration) (models.Job, error) {
+    return c.WaitForJobContext(context.Background(), location, pollInterval)
+}
+
+// WaitForJobContext polls the job until it completes, fails or ctx is done.
+// The last polled job is returned with the error.
+func (c *CapiClient) WaitForJobContext(ctx context.Context, location string, pollInterval time.Duration) (models.Job, error) {
+    for {
+        job, err := c.JobContext(ctx, location)
+        if err != nil {
+            return job, err
+        }
+
+        switch job.State {
+        case models.JobComplete:
+            return job, nil
+        case models.JobFailed:
+            return job, &JobFailedError{Job: job}
+        }
+
+        select {
+        case <-ctx.Done():
+            return job, fmt.Errorf("waiting for job %s: %w", job.Guid, ctx.Err())
+        case <-time.After(pollInterval):
+        }
+    }
+}
+
+func jobPath(location string) (string, error) {
+    if location == "" {
+        return "", fmt.Errorf("job location is empty")
+    }
+
+    if !strings.Contains(location, "/") {
+        return "/v3/jobs/" + location, nil
+    }
+
+    u, err := url.Parse(location)
+    if err != nil {
+        return "", err
+    }
+    return u.Path, nil
+}
@@ -0,0 +1,143 @@
+package internal_test
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/internal"
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("Jobs", func() {
+    var jobsInStates = func(paths *[]string, states ...string) *mockCapiRequestor {
+        return newMockCapiDoer(func(method, path, body string, v interface{}, opts ...models.HeaderOption) error {
+            Expect(method).To(Equal(http.MethodGet))
+            *paths = append(*paths, path)
+
+            state := states[0]
+            if len(states) > 1 {
+                states = states[1:]
+            }
+            return json.Unmarshal([]byte(fmt.Sprintf(validJobResponse, state)), v)
+        })
+    }
+
+    Describe("Job()", func() {
+        DescribeTable("gets the job",
+            func(location string) {
+                var paths []string
+                c := internal.NewCapiClient(jobsInStates(&paths, models.JobFailed))
+
+                job, err := c.Job(location)
+                Expect(err).ToNot(HaveOccurred())
+                Expect(paths).To(Equal([]string{"/v3/jobs/job-guid"}))
+                Expect(job).To(Equal(models.Job{
+                    Guid:      "job-guid",
+                    State:     models.JobFailed,
+                    Operation: "app.delete",
+                    Errors: []models.JobError{
+                        {Code: 10008, Title: "CF-UnprocessableEntity", Detail: "something went wrong"},
+                    },
+                    Warnings:  []models.JobWarning{{Detail: "warning! warning!"}},
+                    CreatedAt: time.Date(2016, 10, 19, 20, 25, 4, 0, time.UTC),
+                    UpdatedAt: time.Date(2016, 11, 8, 16, 41, 26, 0, time.UTC),
+                }))
+            },
+            Entry("from a location", "https://api.example.com/v3/jobs/job-guid"),
+            Entry("from a guid", "job-guid"),
+        )
+
+        It("returns an error if the location is empty", func() {
+            c := internal.NewCapiClient(newMockCapiDoer(nil))
+
+            _, err := c.Job("")
+            Expect(err).To(HaveOccurred())
+        })
+    })
+
+    Describe("WaitForJob()", func() {
+        It("polls until the job is complete", func() {
+            var paths []string
+            c := internal.NewCapiClient(jobsInStates(&paths, models.JobProcessing, models.JobPolling, models.JobComplete))
+
+            job, err := c.WaitForJob("job-guid", time.Millisecond)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(job.State).To(Equal(models.JobComplete))
+            Expect(paths).To(HaveLen(3))
+        })
+
+        It("returns the job errors if the job fails", func() {
+            var paths []string
+            c := internal.NewCapiClient(jobsInStates(&paths, models.JobProcessing, models.JobFailed))
+
+            job, err := c.WaitForJob("job-guid", time.Millisecond)
+            Expect(err).To(MatchError("job job-guid (app.delete) failed: CF-UnprocessableEntity (something went wrong)"))
+
+            var failed *internal.JobFailedError
+            Expect(errors.As(err, &failed)).To(BeTrue())
+            Expect(failed.Job).To(Equal(job))
+        })
+
+        It("gives up when the context is done", func() {
+            var paths []string
+            c := internal.NewCapiClient(jobsInStates(&paths, models.JobProcessing))
+
+            ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+            defer cancel()
+
+            job, err := c.WaitForJobContext(ctx, "job-guid", time.Millisecond)
+            Expect(err).To(MatchError(context.DeadlineExceeded))
+            Expect(job.State).To(Equal(models.JobProcessing))
+        })
+
+        It("returns an error if getting the job fails", func() {
+            c := internal.NewCapiClient(newMockCapiDoer(func(method, path, body string, v interface{}, opts ...models.HeaderOption) error {
+                return errors.New("expected")
+            }))
+
+            _, err := c.WaitForJob("job-guid", time.Millisecond)
+            Expect(err).To(MatchError("expected"))
+        })
+    })
+
+    Describe("DeleteApp()", func() {
+        It("deletes the app and returns the job location", func() {
+            c := internal.NewCapiClient(&mockCapiRequestor{
+                doJob: func(method, path, body string, opts ...models.HeaderOption) (string, error) {
+                    Expect(method).To(Equal(http.MethodDelete))
+                    Expect(path).To(Equal("/v3/apps/app-guid"))
+                    return "https://api.example.com/v3/jobs/job-guid", nil
+                },
+            })
+
+            location, err := c.DeleteApp("app-guid")
+            Expect(err).ToNot(HaveOccurred())
+            Expect(location).To(Equal("https://api.example.com/v3/jobs/job-guid"))
+        })
+    })
+})
+
+const validJobResponse = `{
+  "guid": "job-guid",
+  "created_at": "2016-10-19T20:25:04Z",
+  "updated_at": "2016-11-08T16:41:26Z",
+  "operation": "app.delete",
+  "state": "%s",
+  "errors": [
+    { "code": 10008, "title": "CF-UnprocessableEntity", "detail": "something went wrong" }
+  ],
+  "warnings": [
+    { "detail": "warning! warning!" }
+  ],
+  "links": {
+    "self": { "href": "https://api.example.com/v3/jobs/job-guid" }
+  }
+}`
@@ -0,0 +1,36 @@
+package internal
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "strings"
+
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+)
+
+// DecodeClaims reads the payload of a UAA issued JWT. The signature is not
+// verified, the claims are only used to inspect tokens we fetched ourselves.
+func DecodeClaims(token string) (models.Claims, error) {
+    if i := strings.LastIndex(token, " "); i >= 0 {
+        token = token[i+1:]
+    }
+
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return models.Claims{}, fmt.Errorf("token is not a JWT")
+    }
+
+    payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+    if err != nil {
+        return models.Claims{}, fmt.Errorf("cannot decode JWT payload: %s", err)
+    }
+
+    var claims models.Claims
+    err = json.Unmarshal(payload, &claims)
+    if err != nil {
+        return models.Claims{}, fmt.Errorf("cannot decode JWT claims: %s", err)
+    }
+
+    return claims, nil
+}
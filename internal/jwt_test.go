@@ -0,0 +1,58 @@
+package internal_test
+
+import (
+    "encoding/base64"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/internal"
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("JWT", func() {
+    Describe("DecodeClaims()", func() {
+        It("decodes the claims", func() {
+            claims, err := internal.DecodeClaims("bearer " + validJwt)
+            Expect(err).ToNot(HaveOccurred())
+
+            Expect(claims).To(Equal(models.Claims{
+                Scopes:    []string{"cloud_controller.read", "cloud_controller.write"},
+                UserID:    "user-guid",
+                UserName:  "admin",
+                ClientID:  "cf",
+                Issuer:    "https://uaa.example.com/oauth/token",
+                ExpiresAt: 1893456000,
+            }))
+            Expect(claims.Expiry()).To(Equal(time.Unix(1893456000, 0)))
+            Expect(claims.HasScope("cloud_controller.write")).To(BeTrue())
+            Expect(claims.HasScope("cloud_controller.admin")).To(BeFalse())
+        })
+
+        It("decodes tokens without a token type", func() {
+            claims, err := internal.DecodeClaims(validJwt)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(claims.UserName).To(Equal("admin"))
+        })
+
+        DescribeTable("errors", func(token string) {
+            _, err := internal.DecodeClaims(token)
+            Expect(err).To(HaveOccurred())
+        },
+            Entry("opaque token", "bearer lemons"),
+            Entry("payload is not base64", "bearer header.!!!.signature"),
+            Entry("payload is not json", "bearer header."+base64.RawURLEncoding.EncodeToString([]byte("lemons"))+".signature"),
+        )
+    })
+})
+
+var validJwt = "header." + base64.RawURLEncoding.EncodeToString([]byte(`{
+    "scope": ["cloud_controller.read", "cloud_controller.write"],
+    "user_id": "user-guid",
+    "user_name": "admin",
+    "client_id": "cf",
+    "iss": "https://uaa.example.com/oauth/token",
+    "exp": 1893456000
+}`)) + ".signature"
@@ -0,0 +1,61 @@
+package internal
+
+import (
+    "context"
+    "log/slog"
+    "net/http"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+)
+
+var discardLogger = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// DiscardLogger returns a logger that drops every record, the default of
+// every component that takes a logger
+func DiscardLogger() *slog.Logger {
+    return discardLogger
+}
+
+func loggerOrDiscard(logger *slog.Logger) *slog.Logger {
+    if logger == nil {
+        return discardLogger
+    }
+    return logger
+}
+
+// logRequest logs a CAPI or UAA request. Only the path is logged, never the
+// headers, query or body, which may carry tokens or passwords.
+func logRequest(logger *slog.Logger, component string, req *http.Request, resp *http.Response, err error, start time.Time, retries int) {
+    attrs := []slog.Attr{
+        slog.String("component", component),
+        slog.String("method", req.Method),
+        slog.String("path", req.URL.Path),
+        slog.Duration("duration", time.Since(start)),
+        slog.Int("retries", retries),
+    }
+
+    if resp != nil {
+        attrs = append(attrs,
+            slog.Int("status", resp.StatusCode),
+            slog.String("request_id", resp.Header.Get(models.RequestIDHeader)),
+        )
+    }
+
+    level := slog.LevelInfo
+    if err != nil {
+        level = slog.LevelWarn
+        attrs = append(attrs, slog.String("error", err.Error()))
+    } else if resp.StatusCode >= http.StatusInternalServerError {
+        level = slog.LevelWarn
+    }
+
+    logger.LogAttrs(req.Context(), level, component+" request", attrs...)
+}
@@ -0,0 +1,45 @@
+package internal
+
+import (
+    "regexp"
+    "strings"
+    "time"
+)
+
+// Metrics receives measurements about the requests made by the client
+type Metrics interface {
+    CapiRequest(method, pathTemplate string, status int, duration time.Duration)
+    TokenFetch(duration time.Duration, err error)
+    TokenExpiresAt(expiresAt time.Time)
+    AppGuidCacheLookup(hit bool)
+    AppGuidCacheRefresh(err error)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) CapiRequest(string, string, int, time.Duration) {}
+func (noopMetrics) TokenFetch(time.Duration, error)                {}
+func (noopMetrics) TokenExpiresAt(time.Time)                       {}
+func (noopMetrics) AppGuidCacheLookup(bool)                        {}
+func (noopMetrics) AppGuidCacheRefresh(error)                      {}
+
+func metricsOrNoop(m Metrics) Metrics {
+    if m == nil {
+        return noopMetrics{}
+    }
+    return m
+}
+
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// pathTemplate replaces the guids in a CAPI path so that it can be used as a
+// low cardinality label
+func pathTemplate(path string) string {
+    segments := strings.Split(path, "/")
+    for i, s := range segments {
+        if guidPattern.MatchString(s) {
+            segments[i] = ":guid"
+        }
+    }
+    return strings.Join(segments, "/")
+}
@@ -18,6 +18,8 @@ type HttpRequest struct {
 type HttpClient struct {
     Err       error
     Status    int
+    Statuses  chan int
+    Header    http.Header
     Responses chan string
 
     Reqs chan HttpRequest
@@ -26,6 +28,7 @@ type HttpClient struct {
 func NewHttpClient() *HttpClient {
     return &HttpClient{
         Reqs:      make(chan HttpRequest, 100),
+        Statuses:  make(chan int, 100),
         Responses: make(chan string, 100),
         Status:    http.StatusOK,
     }
@@ -53,9 +56,16 @@ func (c *HttpClient) Do(req *http.Request) (*http.Response, error) {
         resp = `{"access_token": "lemons", "token_type": "bearer", "expires_in": 86400}`
     }
 
+    status := c.Status
+    select {
+    case status = <-c.Statuses:
+    default:
+    }
+
     respBody := ioutil.NopCloser(strings.NewReader(resp))
     return &http.Response{
-        StatusCode: c.Status,
+        StatusCode: status,
+        Header:     c.Header,
         Body:       respBody,
     }, c.Err
 }
@@ -0,0 +1,47 @@
+package mocks
+
+import (
+    "fmt"
+    "sync"
+    "time"
+)
+
+type Metrics struct {
+    CapiRequests   []string
+    TokenFetches   []error
+    TokenExpiry    time.Time
+    CacheLookups   []bool
+    CacheRefreshes []error
+
+    mu sync.Mutex
+}
+
+func (m *Metrics) CapiRequest(method, pathTemplate string, status int, duration time.Duration) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.CapiRequests = append(m.CapiRequests, fmt.Sprintf("%s %s %d", method, pathTemplate, status))
+}
+
+func (m *Metrics) TokenFetch(duration time.Duration, err error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.TokenFetches = append(m.TokenFetches, err)
+}
+
+func (m *Metrics) TokenExpiresAt(expiresAt time.Time) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.TokenExpiry = expiresAt
+}
+
+func (m *Metrics) AppGuidCacheLookup(hit bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.CacheLookups = append(m.CacheLookups, hit)
+}
+
+func (m *Metrics) AppGuidCacheRefresh(err error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.CacheRefreshes = append(m.CacheRefreshes, err)
+}
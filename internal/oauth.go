@@ -1,8 +1,10 @@
 package internal
 
 import (
+    "context"
     "encoding/json"
     "fmt"
+    "log/slog"
     "net/http"
     "net/url"
     "strings"
@@ -13,38 +15,93 @@ type httpClient interface {
     Do(req *http.Request) (*http.Response, error)
 }
 
+type urlGetter func() (string, error)
+
 type OauthClient struct {
     httpClient  httpClient
-    oauthUrl    string
+    oauthUrl    urlGetter
     requestBody string
+    breaker     *CircuitBreaker
+    logger      *slog.Logger
+    metrics     Metrics
 }
 
-func NewUserOauthClient(httpClient httpClient, oauthUrl, username, password string) *OauthClient {
-    return &OauthClient{
-        httpClient: httpClient,
-        oauthUrl:   oauthUrl,
-        requestBody: url.Values{
-            "client_id":     {"cf"},
-            "client_secret": {""},
-            "username":      {username},
-            "password":      {password},
-            "grant_type":    {"password"},
-            "response_type": {"token"},
-        }.Encode(),
+type OauthClientOption func(*OauthClient)
+
+// WithOauthUrlGetter resolves the oauth url on each token request instead of
+// using the url given to the constructor
+func WithOauthUrlGetter(getUrl func() (string, error)) OauthClientOption {
+    return func(c *OauthClient) {
+        c.oauthUrl = getUrl
+    }
+}
+
+// WithOauthCircuitBreaker fails token requests fast while UAA is unhealthy.
+// Errors and 5xx responses count as failures.
+func WithOauthCircuitBreaker(b *CircuitBreaker) OauthClientOption {
+    return func(c *OauthClient) {
+        c.breaker = b
     }
 }
 
-func NewClientCredentialsOauthClient(httpClient httpClient, oauthUrl, client, secret string) *OauthClient {
-    return &OauthClient{
+// WithOauthLogger logs every token request
+func WithOauthLogger(logger *slog.Logger) OauthClientOption {
+    return func(c *OauthClient) {
+        c.logger = logger
+    }
+}
+
+// WithOauthMetrics records every token fetch and whether it failed
+func WithOauthMetrics(m Metrics) OauthClientOption {
+    return func(c *OauthClient) {
+        c.metrics = m
+    }
+}
+
+func NewUserOauthClient(httpClient httpClient, oauthUrl, username, password string, opts ...OauthClientOption) *OauthClient {
+    return newOauthClient(httpClient, oauthUrl, url.Values{
+        "client_id":     {"cf"},
+        "client_secret": {""},
+        "username":      {username},
+        "password":      {password},
+        "grant_type":    {"password"},
+        "response_type": {"token"},
+    }, opts...)
+}
+
+func NewClientCredentialsOauthClient(httpClient httpClient, oauthUrl, client, secret string, opts ...OauthClientOption) *OauthClient {
+    return newOauthClient(httpClient, oauthUrl, url.Values{
+        "client_id":     {client},
+        "client_secret": {secret},
+        "grant_type":    {"client_credentials"},
+        "response_type": {"token"},
+    }, opts...)
+}
+
+func NewRefreshTokenOauthClient(httpClient httpClient, oauthUrl, client, secret, refreshToken string, opts ...OauthClientOption) *OauthClient {
+    return newOauthClient(httpClient, oauthUrl, url.Values{
+        "client_id":     {client},
+        "client_secret": {secret},
+        "refresh_token": {refreshToken},
+        "grant_type":    {"refresh_token"},
+        "response_type": {"token"},
+    }, opts...)
+}
+
+func newOauthClient(httpClient httpClient, oauthUrl string, body url.Values, opts ...OauthClientOption) *OauthClient {
+    c := &OauthClient{
         httpClient: httpClient,
-        oauthUrl:   oauthUrl,
-        requestBody: url.Values{
-            "client_id":     {client},
-            "client_secret": {secret},
-            "grant_type":    {"client_credentials"},
-            "response_type": {"token"},
-        }.Encode(),
+        oauthUrl: func() (string, error) {
+            return oauthUrl, nil
+        },
+        requestBody: body.Encode(),
+    }
+    for _, o := range opts {
+        o(c)
     }
+    c.logger = loggerOrDiscard(c.logger)
+    c.metrics = metricsOrNoop(c.metrics)
+    return c
 }
 
 type TokenWithExpiry struct {
@@ -53,7 +110,12 @@ type TokenWithExpiry struct {
 }
 
 func (c *OauthClient) Token() (string, error) {
-    tokenResponse, err := c.TokenWithExpiry()
+    return c.TokenContext(context.Background())
+}
+
+// TokenContext is Token with a context that cancels the token request
+func (c *OauthClient) TokenContext(ctx context.Context) (string, error) {
+    tokenResponse, err := c.TokenWithExpiryContext(ctx)
     if err != nil {
         return "", err
     }
@@ -62,12 +124,27 @@ func (c *OauthClient) Token() (string, error) {
 }
 
 func (c *OauthClient) TokenWithExpiry() (TokenWithExpiry, error) {
-    req, err := c.tokenRequest()
+    return c.TokenWithExpiryContext(context.Background())
+}
+
+// TokenWithExpiryContext is TokenWithExpiry with a context that cancels the
+// token request
+func (c *OauthClient) TokenWithExpiryContext(ctx context.Context) (TokenWithExpiry, error) {
+    start := time.Now()
+    token, err := c.fetchToken(ctx)
+    c.metrics.TokenFetch(time.Since(start), err)
+    return token, err
+}
+
+func (c *OauthClient) fetchToken(ctx context.Context) (TokenWithExpiry, error) {
+    req, err := c.tokenRequest(ctx)
     if err != nil {
         return TokenWithExpiry{}, err
     }
 
-    resp, err := c.httpClient.Do(req)
+    start := time.Now()
+    resp, err := c.send(req)
+    logRequest(c.logger, "uaa", req, resp, err, start, 0)
     if err != nil {
         return TokenWithExpiry{}, err
     }
@@ -87,14 +164,39 @@ func (c *OauthClient) TokenWithExpiry() (TokenWithExpiry, error) {
         return TokenWithExpiry{}, err
     }
 
+    expiresAt := time.Now().Add(time.Duration(tokenResponse.ExpiresIn) * time.Second)
+    if claims, err := DecodeClaims(tokenResponse.AccessToken); err == nil && claims.ExpiresAt != 0 {
+        expiresAt = claims.Expiry()
+    }
+
     return TokenWithExpiry{
         Token:     fmt.Sprintf("%s %s", tokenResponse.TokenType, tokenResponse.AccessToken),
-        ExpiresAt: time.Now().Add(time.Duration(tokenResponse.ExpiresIn) * time.Second),
+        ExpiresAt: expiresAt,
     }, nil
 }
 
-func (c *OauthClient) tokenRequest() (*http.Request, error) {
-    req, err := http.NewRequest(http.MethodPost, c.oauthUrl+"/oauth/token", strings.NewReader(c.requestBody))
+func (c *OauthClient) send(req *http.Request) (*http.Response, error) {
+    if c.breaker == nil {
+        return c.httpClient.Do(req)
+    }
+
+    generation, err := c.breaker.Allow()
+    if err != nil {
+        return nil, err
+    }
+
+    resp, err := c.httpClient.Do(req)
+    c.breaker.Done(generation, req, resp, err)
+    return resp, err
+}
+
+func (c *OauthClient) tokenRequest(ctx context.Context) (*http.Request, error) {
+    oauthUrl, err := c.oauthUrl()
+    if err != nil {
+        return nil, err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, oauthUrl+"/oauth/token", strings.NewReader(c.requestBody))
     if err != nil {
         return nil, err
     }
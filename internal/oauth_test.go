@@ -1,8 +1,10 @@
 package internal_test
 
 import (
+    "context"
     "errors"
     "net/http"
+    "net/http/httptest"
     "net/url"
     "time"
 
@@ -83,6 +85,21 @@ var _ = Describe("Oauth", func() {
                 tc.httpClient.Responses <- "im not json"
             }),
         )
+
+        It("cancels the token request when the context is done", func() {
+            release := make(chan struct{})
+            server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+                <-release
+            }))
+            defer server.Close()
+            defer close(release)
+            client := internal.NewUserOauthClient(server.Client(), server.URL, "admin", "supersecret")
+
+            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+            defer cancel()
+            _, err := client.TokenContext(ctx)
+            Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+        })
     })
 
     Describe("TokenWithExpiry()", func() {
@@ -112,6 +129,16 @@ var _ = Describe("Oauth", func() {
             })))
         })
 
+        It("uses the exp claim as the expiry if present", func() {
+            client, tc := setupUserClient()
+            tc.httpClient.Responses <- `{"access_token": "` + validJwt + `", "token_type": "bearer", "expires_in": 60}`
+
+            token, err := client.TokenWithExpiry()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(token.Token).To(Equal("bearer " + validJwt))
+            Expect(token.ExpiresAt).To(Equal(time.Unix(1893456000, 0)))
+        })
+
         DescribeTable("errors",
             func(setupFunc func(*testContext)) {
                 client, tc := setupUserClient()
@@ -132,6 +159,95 @@ var _ = Describe("Oauth", func() {
         )
     })
 
+    Describe("WithOauthUrlGetter()", func() {
+        It("gets the url before requesting a token", func() {
+            tc := setupHttpClient()
+            client := internal.NewUserOauthClient(tc.httpClient, "", "admin", "supersecret",
+                internal.WithOauthUrlGetter(func() (string, error) {
+                    return "https://login.example.com", nil
+                }),
+            )
+
+            _, err := client.Token()
+            Expect(err).ToNot(HaveOccurred())
+
+            var req mocks.HttpRequest
+            Expect(tc.httpClient.Reqs).To(Receive(&req))
+            Expect(req.Url).To(Equal("https://login.example.com/oauth/token"))
+        })
+
+        It("returns an error if getting the url fails", func() {
+            tc := setupHttpClient()
+            client := internal.NewUserOauthClient(tc.httpClient, "", "admin", "supersecret",
+                internal.WithOauthUrlGetter(func() (string, error) {
+                    return "", errors.New("expected")
+                }),
+            )
+
+            _, err := client.Token()
+            Expect(err).To(HaveOccurred())
+            Expect(tc.httpClient.Reqs).To(BeEmpty())
+        })
+    })
+
+    Describe("WithOauthMetrics()", func() {
+        It("records token fetches and failures", func() {
+            tc := setupHttpClient()
+            metrics := &mocks.Metrics{}
+            client := internal.NewUserOauthClient(tc.httpClient, "https://example.com", "admin", "supersecret",
+                internal.WithOauthMetrics(metrics),
+            )
+
+            _, err := client.Token()
+            Expect(err).ToNot(HaveOccurred())
+            tc.httpClient.Status = http.StatusUnauthorized
+            _, err = client.Token()
+            Expect(err).To(HaveOccurred())
+
+            Expect(metrics.TokenFetches).To(HaveLen(2))
+            Expect(metrics.TokenFetches[0]).ToNot(HaveOccurred())
+            Expect(metrics.TokenFetches[1]).To(HaveOccurred())
+        })
+    })
+
+    Describe("WithOauthCircuitBreaker()", func() {
+        It("fails fast once the circuit breaker opens", func() {
+            tc := setupHttpClient()
+            tc.httpClient.Err = errors.New("expected error")
+            client := internal.NewUserOauthClient(tc.httpClient, "https://example.com", "admin", "supersecret",
+                internal.WithOauthCircuitBreaker(internal.NewCircuitBreaker("uaa", 1, time.Hour, nil)),
+            )
+
+            _, err := client.Token()
+            Expect(err).To(MatchError("expected error"))
+
+            _, err = client.Token()
+            Expect(err).To(MatchError(internal.ErrCircuitOpen))
+            Expect(tc.httpClient.Reqs).To(HaveLen(1))
+        })
+    })
+
+    Describe("NewRefreshTokenOauthClient", func() {
+        It("exchanges the refresh token", func() {
+            tc := setupHttpClient()
+            client := internal.NewRefreshTokenOauthClient(tc.httpClient, "https://example.com", "cf", "", "refresh-token")
+
+            token, err := client.Token()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(token).To(Equal("bearer lemons"))
+
+            var req mocks.HttpRequest
+            Expect(tc.httpClient.Reqs).To(Receive(&req))
+            Expect(req.Body).To(Equal(url.Values{
+                "client_id":     {"cf"},
+                "client_secret": {""},
+                "refresh_token": {"refresh-token"},
+                "grant_type":    {"refresh_token"},
+                "response_type": {"token"},
+            }.Encode()))
+        })
+    })
+
     Describe("NewClientCredentialsOauthClient", func() {
         It("gets a token", func() {
             client, tc := setupClientCredsClient()
@@ -0,0 +1,121 @@
+package internal
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// RateLimiter is a token bucket that also slows down when CAPI reports that
+// the rate limit is close to being exhausted
+type RateLimiter struct {
+    rate  float64
+    burst float64
+
+    tokens float64
+    last   time.Time
+
+    // set from X-RateLimit-* headers, valid until resetAt
+    resetAt     time.Time
+    minInterval time.Duration
+    nextAllowed time.Time
+
+    mu sync.Mutex
+}
+
+// NewRateLimiter allows rate requests per second with bursts of up to burst
+// requests and slows down further when CAPI's response headers ask for it
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+    if burst < 1 {
+        burst = 1
+    }
+
+    return &RateLimiter{
+        rate:   rate,
+        burst:  float64(burst),
+        tokens: float64(burst),
+        last:   time.Now(),
+    }
+}
+
+// Wait blocks until a request may be sent or the context is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+    for {
+        wait := l.reserve()
+        if wait <= 0 {
+            return nil
+        }
+
+        timer := time.NewTimer(wait)
+        select {
+        case <-timer.C:
+        case <-ctx.Done():
+            timer.Stop()
+            return ctx.Err()
+        }
+    }
+}
+
+func (l *RateLimiter) reserve() time.Duration {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := time.Now()
+    if now.Before(l.nextAllowed) {
+        return l.nextAllowed.Sub(now)
+    }
+
+    if l.rate > 0 {
+        l.tokens += now.Sub(l.last).Seconds() * l.rate
+        if l.tokens > l.burst {
+            l.tokens = l.burst
+        }
+        l.last = now
+
+        if l.tokens < 1 {
+            return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+        }
+        l.tokens--
+    }
+
+    if now.Before(l.resetAt) {
+        l.nextAllowed = now.Add(l.minInterval)
+    }
+
+    return 0
+}
+
+// Observe adjusts the limiter from CAPI's X-RateLimit-Remaining and
+// X-RateLimit-Reset headers. When nothing is left it waits for the reset,
+// otherwise the remaining requests are spread out until the reset.
+func (l *RateLimiter) Observe(header http.Header) {
+    remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+    if err != nil {
+        return
+    }
+    reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+    if err != nil {
+        return
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := time.Now()
+    l.resetAt = time.Unix(reset, 0)
+    untilReset := l.resetAt.Sub(now)
+    if untilReset <= 0 {
+        l.minInterval = 0
+        return
+    }
+
+    if remaining <= 0 {
+        l.minInterval = 0
+        l.nextAllowed = l.resetAt
+        return
+    }
+
+    l.minInterval = untilReset / time.Duration(remaining)
+}
@@ -0,0 +1,93 @@
+package internal_test
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/internal"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimiter", func() {
+    Describe("Wait()", func() {
+        It("allows a burst without waiting", func() {
+            l := internal.NewRateLimiter(1, 5)
+
+            start := time.Now()
+            for i := 0; i < 5; i++ {
+                Expect(l.Wait(context.Background())).To(Succeed())
+            }
+            Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+        })
+
+        It("waits for tokens once the burst is used", func() {
+            l := internal.NewRateLimiter(50, 1)
+
+            start := time.Now()
+            for i := 0; i < 4; i++ {
+                Expect(l.Wait(context.Background())).To(Succeed())
+            }
+            Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+        })
+
+        It("returns the context error if it is done while waiting", func() {
+            l := internal.NewRateLimiter(0.1, 1)
+            Expect(l.Wait(context.Background())).To(Succeed())
+
+            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+            defer cancel()
+            Expect(l.Wait(ctx)).To(MatchError(context.DeadlineExceeded))
+        })
+    })
+
+    Describe("Observe()", func() {
+        var rateLimitHeader = func(remaining int, reset time.Time) http.Header {
+            return http.Header{
+                "X-Ratelimit-Remaining": {strconv.Itoa(remaining)},
+                "X-Ratelimit-Reset":     {strconv.FormatInt(reset.Unix(), 10)},
+            }
+        }
+
+        It("waits for the reset once nothing remains", func() {
+            l := internal.NewRateLimiter(0, 1)
+            l.Observe(rateLimitHeader(0, time.Now().Add(time.Hour)))
+
+            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+            defer cancel()
+            Expect(l.Wait(ctx)).To(MatchError(context.DeadlineExceeded))
+        })
+
+        It("spreads the remaining requests until the reset", func() {
+            l := internal.NewRateLimiter(0, 1)
+            l.Observe(rateLimitHeader(10, time.Now().Add(time.Hour)))
+
+            Expect(l.Wait(context.Background())).To(Succeed())
+
+            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+            defer cancel()
+            Expect(l.Wait(ctx)).To(MatchError(context.DeadlineExceeded))
+        })
+
+        It("does not slow down after the reset", func() {
+            l := internal.NewRateLimiter(0, 1)
+            l.Observe(rateLimitHeader(0, time.Now().Add(-time.Second)))
+
+            for i := 0; i < 5; i++ {
+                Expect(l.Wait(context.Background())).To(Succeed())
+            }
+        })
+
+        It("ignores responses without rate limit headers", func() {
+            l := internal.NewRateLimiter(0, 1)
+            l.Observe(http.Header{})
+
+            for i := 0; i < 5; i++ {
+                Expect(l.Wait(context.Background())).To(Succeed())
+            }
+        })
+    })
+})
@@ -1,14 +1,18 @@
 package internal
 
 import (
+    "context"
+    "log/slog"
     "sync"
     "time"
 )
 
-type tokenWithExpiryGetter func() (TokenWithExpiry, error)
+type tokenWithExpiryGetter func(ctx context.Context) (TokenWithExpiry, error)
 
 type TokenCache struct {
-    get tokenWithExpiryGetter
+    get     tokenWithExpiryGetter
+    logger  *slog.Logger
+    metrics Metrics
 
     cachedToken TokenWithExpiry
     expiresAt   time.Time
@@ -16,13 +20,41 @@ type TokenCache struct {
     sync.Mutex
 }
 
-func NewTokenCache(tokenGetter tokenWithExpiryGetter) *TokenCache {
-    return &TokenCache{
+type TokenCacheOption func(*TokenCache)
+
+// WithTokenCacheLogger logs token refreshes and invalidations at debug level
+func WithTokenCacheLogger(logger *slog.Logger) TokenCacheOption {
+    return func(c *TokenCache) {
+        c.logger = logger
+    }
+}
+
+// WithTokenCacheMetrics records the expiry of every refreshed token
+func WithTokenCacheMetrics(m Metrics) TokenCacheOption {
+    return func(c *TokenCache) {
+        c.metrics = m
+    }
+}
+
+func NewTokenCache(tokenGetter tokenWithExpiryGetter, opts ...TokenCacheOption) *TokenCache {
+    c := &TokenCache{
         get: tokenGetter,
     }
+    for _, o := range opts {
+        o(c)
+    }
+    c.logger = loggerOrDiscard(c.logger)
+    c.metrics = metricsOrNoop(c.metrics)
+    return c
 }
 
 func (c *TokenCache) Token() (string, error) {
+    return c.TokenContext(context.Background())
+}
+
+// TokenContext is Token with a context that cancels the refresh, if one is
+// needed
+func (c *TokenCache) TokenContext(ctx context.Context) (string, error) {
     oneMinuteInFuture := time.Now().Add(time.Minute)
 
     c.Lock()
@@ -30,19 +62,37 @@ func (c *TokenCache) Token() (string, error) {
 
     token := c.cachedToken
     if token.Token == "" || token.ExpiresAt.Before(oneMinuteInFuture) {
-        return c.refresh()
+        return c.refresh(ctx)
     }
 
     return token.Token, nil
 }
 
-func (c *TokenCache) refresh() (string, error) {
-    token, err := c.get()
+// Set seeds the cache with a token obtained elsewhere
+func (c *TokenCache) Set(token TokenWithExpiry) {
+    c.Lock()
+    c.cachedToken = token
+    c.Unlock()
+}
+
+func (c *TokenCache) Invalidate() {
+    c.Lock()
+    c.cachedToken = TokenWithExpiry{}
+    c.Unlock()
+
+    c.logger.Debug("token invalidated")
+}
+
+func (c *TokenCache) refresh(ctx context.Context) (string, error) {
+    token, err := c.get(ctx)
     if err != nil {
+        c.logger.Debug("token refresh failed", slog.String("error", err.Error()))
         return "", err
     }
 
     c.cachedToken = token
+    c.metrics.TokenExpiresAt(token.ExpiresAt)
+    c.logger.Debug("token refreshed", slog.Time("expires_at", token.ExpiresAt))
 
     return token.Token, nil
 }
@@ -1,13 +1,17 @@
 package internal_test
 
 import (
+    "bytes"
+    "context"
     "errors"
+    "log/slog"
     "sync"
     "time"
 
     . "github.com/onsi/ginkgo"
     . "github.com/onsi/gomega"
     "github.com/pivotal-cf/app-automator-cf-client/internal"
+    "github.com/pivotal-cf/app-automator-cf-client/internal/mocks"
 )
 
 var _ = Describe("Token cache", func() {
@@ -20,7 +24,7 @@ var _ = Describe("Token cache", func() {
         It("gets token if not present", func() {
             var tokenRefreshed bool
             c := internal.NewTokenCache(
-                func() (internal.TokenWithExpiry, error) {
+                func(context.Context) (internal.TokenWithExpiry, error) {
                     tokenRefreshed = true
                     return validToken, nil
                 },
@@ -35,7 +39,7 @@ var _ = Describe("Token cache", func() {
         It("gets token from cache if present", func() {
             var tokenRefreshed int
             c := internal.NewTokenCache(
-                func() (internal.TokenWithExpiry, error) {
+                func(context.Context) (internal.TokenWithExpiry, error) {
                     tokenRefreshed++
                     return validToken, nil
                 },
@@ -54,7 +58,7 @@ var _ = Describe("Token cache", func() {
 
         It("handles concurrent reads", func() {
             c := internal.NewTokenCache(
-                func() (internal.TokenWithExpiry, error) {
+                func(context.Context) (internal.TokenWithExpiry, error) {
                     return validToken, nil
                 },
             )
@@ -66,7 +70,7 @@ var _ = Describe("Token cache", func() {
         It("refreshes the token if it is close to expiring", func() {
             var tokenRefreshed int
             c := internal.NewTokenCache(
-                func() (internal.TokenWithExpiry, error) {
+                func(context.Context) (internal.TokenWithExpiry, error) {
                     tokenRefreshed++
                     return internal.TokenWithExpiry{
                         Token:     "token",
@@ -89,7 +93,7 @@ var _ = Describe("Token cache", func() {
         It("refreshes the token only ONCE when it expires", func() {
             var tokenRefreshed int
             c := internal.NewTokenCache(
-                func() (internal.TokenWithExpiry, error) {
+                func(context.Context) (internal.TokenWithExpiry, error) {
                     tokenRefreshed++
 
                     time.Sleep(50 * time.Millisecond)
@@ -119,9 +123,85 @@ var _ = Describe("Token cache", func() {
             Expect(tokenRefreshed).To(Equal(1))
         })
 
+        It("uses a token that was set", func() {
+            var tokenRefreshed int
+            c := internal.NewTokenCache(
+                func(context.Context) (internal.TokenWithExpiry, error) {
+                    tokenRefreshed++
+                    return validToken, nil
+                },
+            )
+
+            c.Set(internal.TokenWithExpiry{
+                Token:     "seeded",
+                ExpiresAt: time.Now().Add(time.Hour),
+            })
+
+            token, err := c.Token()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(token).To(Equal("seeded"))
+            Expect(tokenRefreshed).To(Equal(0))
+        })
+
+        It("refreshes the token after it is invalidated", func() {
+            var tokenRefreshed int
+            c := internal.NewTokenCache(
+                func(context.Context) (internal.TokenWithExpiry, error) {
+                    tokenRefreshed++
+                    return validToken, nil
+                },
+            )
+
+            _, err := c.Token()
+            Expect(err).ToNot(HaveOccurred())
+
+            c.Invalidate()
+
+            token, err := c.Token()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(token).To(Equal("token"))
+
+            Expect(tokenRefreshed).To(Equal(2))
+        })
+
+        It("logs refreshes and invalidations at debug level", func() {
+            buf := &bytes.Buffer{}
+            logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+            c := internal.NewTokenCache(
+                func(context.Context) (internal.TokenWithExpiry, error) {
+                    return validToken, nil
+                },
+                internal.WithTokenCacheLogger(logger),
+            )
+
+            _, err := c.Token()
+            Expect(err).ToNot(HaveOccurred())
+            c.Invalidate()
+
+            Expect(buf.String()).To(And(
+                ContainSubstring("level=DEBUG msg=\"token refreshed\""),
+                ContainSubstring("level=DEBUG msg=\"token invalidated\""),
+            ))
+            Expect(buf.String()).ToNot(ContainSubstring("token="))
+        })
+
+        It("records the expiry of refreshed tokens", func() {
+            metrics := &mocks.Metrics{}
+            c := internal.NewTokenCache(
+                func(context.Context) (internal.TokenWithExpiry, error) {
+                    return validToken, nil
+                },
+                internal.WithTokenCacheMetrics(metrics),
+            )
+
+            _, err := c.Token()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(metrics.TokenExpiry).To(Equal(validToken.ExpiresAt))
+        })
+
         It("returns an error if getting the token fails", func() {
             c := internal.NewTokenCache(
-                func() (internal.TokenWithExpiry, error) {
+                func(context.Context) (internal.TokenWithExpiry, error) {
                     return validToken, errors.New("expected")
                 },
             )
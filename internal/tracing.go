@@ -0,0 +1,43 @@
+package internal
+
+import (
+    "errors"
+
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/trace"
+    "go.opentelemetry.io/otel/trace/noop"
+)
+
+const instrumentationName = "github.com/pivotal-cf/app-automator-cf-client"
+
+// Tracer returns the client's tracer from the provider, or a tracer that
+// records nothing if the provider is nil
+func Tracer(tp trace.TracerProvider) trace.Tracer {
+    if tp == nil {
+        tp = noop.NewTracerProvider()
+    }
+    return tp.Tracer(instrumentationName)
+}
+
+func propagatorOrDefault(p propagation.TextMapPropagator) propagation.TextMapPropagator {
+    if p == nil {
+        return propagation.TraceContext{}
+    }
+    return p
+}
+
+// EndSpan marks the span as failed if err is set and ends it. A dry run is
+// marked as such instead of failed.
+func EndSpan(span trace.Span, err error) {
+    var dryRun *models.DryRunError
+    if errors.As(err, &dryRun) {
+        span.SetAttributes(attribute.Bool("cf.dry_run", true))
+    } else if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+    }
+    span.End()
+}
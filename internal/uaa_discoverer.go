@@ -0,0 +1,75 @@
+package internal
+
+import (
+    "fmt"
+    "net/http"
+    "sync"
+
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+)
+
+// UaaDiscoverer finds the token endpoint from the links in the CAPI root
+// document. The result is cached after the first successful lookup.
+type UaaDiscoverer struct {
+    httpClient httpClient
+    capiUrl    string
+
+    url string
+    sync.Mutex
+}
+
+func NewUaaDiscoverer(httpClient httpClient, capiUrl string) *UaaDiscoverer {
+    return &UaaDiscoverer{
+        httpClient: httpClient,
+        capiUrl:    capiUrl,
+    }
+}
+
+func (d *UaaDiscoverer) Url() (string, error) {
+    d.Lock()
+    defer d.Unlock()
+
+    if d.url != "" {
+        return d.url, nil
+    }
+
+    url, err := d.discover()
+    if err != nil {
+        return "", err
+    }
+
+    d.url = url
+    return url, nil
+}
+
+func (d *UaaDiscoverer) discover() (string, error) {
+    req, err := http.NewRequest(http.MethodGet, d.capiUrl+"/", nil)
+    if err != nil {
+        return "", err
+    }
+    req.Header.Add("Accept", "application/json")
+
+    resp, err := d.httpClient.Do(req)
+    if err != nil {
+        return "", err
+    }
+
+    if resp.StatusCode > 299 {
+        resp.Body.Close()
+        return "", fmt.Errorf("getting CAPI root returned unexpected status code %d", resp.StatusCode)
+    }
+
+    var root models.Root
+    err = decodeBody(resp, &root)
+    if err != nil {
+        return "", err
+    }
+
+    for _, link := range []models.Link{root.Links.Login, root.Links.Uaa} {
+        if link.Href != "" {
+            return link.Href, nil
+        }
+    }
+
+    return "", fmt.Errorf("CAPI root does not link to a login or uaa endpoint")
+}
@@ -0,0 +1,87 @@
+package internal_test
+
+import (
+    "errors"
+    "net/http"
+
+    "github.com/pivotal-cf/app-automator-cf-client/internal"
+    "github.com/pivotal-cf/app-automator-cf-client/internal/mocks"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+    . "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("UaaDiscoverer", func() {
+    Describe("Url()", func() {
+        It("uses the login link from the CAPI root", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Responses <- validRootResponse
+            d := internal.NewUaaDiscoverer(httpClient, "https://api.example.com")
+
+            url, err := d.Url()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(url).To(Equal("https://login.sys.example.com"))
+
+            Expect(httpClient.Reqs).To(Receive(MatchFields(IgnoreExtras, Fields{
+                "Url":    Equal("https://api.example.com/"),
+                "Method": Equal(http.MethodGet),
+            })))
+        })
+
+        It("falls back to the uaa link", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Responses <- `{"links": {"uaa": {"href": "https://uaa.sys.example.com"}}}`
+            d := internal.NewUaaDiscoverer(httpClient, "https://api.example.com")
+
+            url, err := d.Url()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(url).To(Equal("https://uaa.sys.example.com"))
+        })
+
+        It("only fetches the CAPI root once", func() {
+            httpClient := mocks.NewHttpClient()
+            httpClient.Responses <- validRootResponse
+            d := internal.NewUaaDiscoverer(httpClient, "https://api.example.com")
+
+            _, err := d.Url()
+            Expect(err).ToNot(HaveOccurred())
+            url, err := d.Url()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(url).To(Equal("https://login.sys.example.com"))
+
+            Expect(httpClient.Reqs).To(HaveLen(1))
+        })
+
+        DescribeTable("errors", func(setupFunc func(*mocks.HttpClient)) {
+            httpClient := mocks.NewHttpClient()
+            setupFunc(httpClient)
+            d := internal.NewUaaDiscoverer(httpClient, "https://api.example.com")
+
+            _, err := d.Url()
+            Expect(err).To(HaveOccurred())
+        },
+            Entry("httpClient errors", func(c *mocks.HttpClient) {
+                c.Err = errors.New("expected error")
+            }),
+            Entry("request returns unexpected status", func(c *mocks.HttpClient) {
+                c.Status = http.StatusNotFound
+            }),
+            Entry("root is invalid json", func(c *mocks.HttpClient) {
+                c.Responses <- "im not json"
+            }),
+            Entry("root has no login or uaa link", func(c *mocks.HttpClient) {
+                c.Responses <- `{"links": {"cloud_controller_v3": {"href": "https://api.example.com/v3"}}}`
+            }),
+        )
+    })
+})
+
+const validRootResponse = `{
+  "links": {
+    "self": { "href": "https://api.example.com" },
+    "uaa": { "href": "https://uaa.sys.example.com" },
+    "login": { "href": "https://login.sys.example.com" }
+  }
+}`
@@ -0,0 +1,13 @@
+package metrics_test
+
+import (
+    "testing"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+func TestMetrics(t *testing.T) {
+    RegisterFailHandler(Fail)
+    RunSpecs(t, "Metrics Suite")
+}
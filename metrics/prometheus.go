@@ -0,0 +1,139 @@
+// Package metrics provides a Prometheus collector for the client's Metrics
+// hooks
+package metrics
+
+import (
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector implements client.Metrics and prometheus.Collector
+type Collector struct {
+    capiRequests  *prometheus.CounterVec
+    capiDuration  *prometheus.HistogramVec
+    tokenFetches  *prometheus.CounterVec
+    tokenDuration prometheus.Histogram
+    tokenTTL      prometheus.GaugeFunc
+    cacheLookups  *prometheus.CounterVec
+    cacheRefresh  *prometheus.CounterVec
+
+    expiresAt time.Time
+    mu        sync.Mutex
+}
+
+func NewCollector(namespace string) *Collector {
+    c := &Collector{
+        capiRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: namespace,
+            Name:      "capi_requests_total",
+            Help:      "CAPI requests by method, path template and status. Status is 0 if no response was received.",
+        }, []string{"method", "path", "status"}),
+        capiDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Namespace: namespace,
+            Name:      "capi_request_duration_seconds",
+            Help:      "CAPI request latency by method and path template.",
+            Buckets:   prometheus.DefBuckets,
+        }, []string{"method", "path"}),
+        tokenFetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: namespace,
+            Name:      "uaa_token_fetches_total",
+            Help:      "UAA token fetches by result.",
+        }, []string{"result"}),
+        tokenDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+            Namespace: namespace,
+            Name:      "uaa_token_fetch_duration_seconds",
+            Help:      "UAA token fetch latency.",
+            Buckets:   prometheus.DefBuckets,
+        }),
+        cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: namespace,
+            Name:      "app_guid_cache_lookups_total",
+            Help:      "App guid cache lookups by result (hit or miss).",
+        }, []string{"result"}),
+        cacheRefresh: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: namespace,
+            Name:      "app_guid_cache_refreshes_total",
+            Help:      "App guid cache refreshes by result.",
+        }, []string{"result"}),
+    }
+
+    c.tokenTTL = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+        Namespace: namespace,
+        Name:      "uaa_token_expiry_seconds",
+        Help:      "Seconds until the cached UAA token expires.",
+    }, c.secondsUntilExpiry)
+
+    return c
+}
+
+func (c *Collector) CapiRequest(method, pathTemplate string, status int, duration time.Duration) {
+    c.capiRequests.WithLabelValues(method, pathTemplate, strconv.Itoa(status)).Inc()
+    c.capiDuration.WithLabelValues(method, pathTemplate).Observe(duration.Seconds())
+}
+
+func (c *Collector) TokenFetch(duration time.Duration, err error) {
+    c.tokenFetches.WithLabelValues(result(err)).Inc()
+    c.tokenDuration.Observe(duration.Seconds())
+}
+
+func (c *Collector) TokenExpiresAt(expiresAt time.Time) {
+    c.mu.Lock()
+    c.expiresAt = expiresAt
+    c.mu.Unlock()
+}
+
+func (c *Collector) AppGuidCacheLookup(hit bool) {
+    if hit {
+        c.cacheLookups.WithLabelValues("hit").Inc()
+        return
+    }
+    c.cacheLookups.WithLabelValues("miss").Inc()
+}
+
+func (c *Collector) AppGuidCacheRefresh(err error) {
+    c.cacheRefresh.WithLabelValues(result(err)).Inc()
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+    for _, m := range c.collectors() {
+        m.Describe(ch)
+    }
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+    for _, m := range c.collectors() {
+        m.Collect(ch)
+    }
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+    return []prometheus.Collector{
+        c.capiRequests,
+        c.capiDuration,
+        c.tokenFetches,
+        c.tokenDuration,
+        c.tokenTTL,
+        c.cacheLookups,
+        c.cacheRefresh,
+    }
+}
+
+func (c *Collector) secondsUntilExpiry() float64 {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.expiresAt.IsZero() {
+        return 0
+    }
+    return time.Until(c.expiresAt).Seconds()
+}
+
+func result(err error) string {
+    if err != nil {
+        return "failure"
+    }
+    return "success"
+}
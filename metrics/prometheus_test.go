@@ -0,0 +1,99 @@
+package metrics_test
+
+import (
+    "errors"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+    "github.com/pivotal-cf/app-automator-cf-client/metrics"
+    "github.com/prometheus/client_golang/prometheus"
+    dto "github.com/prometheus/client_model/go"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ client.Metrics = &metrics.Collector{}
+
+var _ = Describe("Collector", func() {
+    var gather = func(c *metrics.Collector) map[string]*dto.MetricFamily {
+        registry := prometheus.NewRegistry()
+        Expect(registry.Register(c)).To(Succeed())
+
+        families, err := registry.Gather()
+        Expect(err).ToNot(HaveOccurred())
+
+        byName := map[string]*dto.MetricFamily{}
+        for _, f := range families {
+            byName[f.GetName()] = f
+        }
+        return byName
+    }
+
+    var labels = func(m *dto.Metric) map[string]string {
+        l := map[string]string{}
+        for _, p := range m.GetLabel() {
+            l[p.GetName()] = p.GetValue()
+        }
+        return l
+    }
+
+    It("counts CAPI requests by method, path and status", func() {
+        c := metrics.NewCollector("automator")
+        c.CapiRequest("POST", "/v3/apps/:guid/actions/stop", 201, time.Second)
+        c.CapiRequest("POST", "/v3/apps/:guid/actions/stop", 201, time.Second)
+
+        families := gather(c)
+        requests := families["automator_capi_requests_total"].GetMetric()
+        Expect(requests).To(HaveLen(1))
+        Expect(labels(requests[0])).To(Equal(map[string]string{
+            "method": "POST",
+            "path":   "/v3/apps/:guid/actions/stop",
+            "status": "201",
+        }))
+        Expect(requests[0].GetCounter().GetValue()).To(Equal(2.0))
+
+        latency := families["automator_capi_request_duration_seconds"].GetMetric()
+        Expect(latency[0].GetHistogram().GetSampleSum()).To(Equal(2.0))
+    })
+
+    It("counts token fetches and failures", func() {
+        c := metrics.NewCollector("automator")
+        c.TokenFetch(time.Second, nil)
+        c.TokenFetch(time.Second, errors.New("expected"))
+        c.TokenFetch(time.Second, errors.New("expected"))
+
+        fetches := gather(c)["automator_uaa_token_fetches_total"].GetMetric()
+        counts := map[string]float64{}
+        for _, m := range fetches {
+            counts[labels(m)["result"]] = m.GetCounter().GetValue()
+        }
+        Expect(counts).To(Equal(map[string]float64{"success": 1, "failure": 2}))
+    })
+
+    It("reports the time until the token expires", func() {
+        c := metrics.NewCollector("automator")
+        c.TokenExpiresAt(time.Now().Add(time.Hour))
+
+        ttl := gather(c)["automator_uaa_token_expiry_seconds"].GetMetric()
+        Expect(ttl[0].GetGauge().GetValue()).To(BeNumerically("~", 3600, 5))
+    })
+
+    It("counts app guid cache hits, misses and refreshes", func() {
+        c := metrics.NewCollector("automator")
+        c.AppGuidCacheLookup(true)
+        c.AppGuidCacheLookup(true)
+        c.AppGuidCacheLookup(false)
+        c.AppGuidCacheRefresh(nil)
+
+        families := gather(c)
+        lookups := map[string]float64{}
+        for _, m := range families["automator_app_guid_cache_lookups_total"].GetMetric() {
+            lookups[labels(m)["result"]] = m.GetCounter().GetValue()
+        }
+        Expect(lookups).To(Equal(map[string]float64{"hit": 2, "miss": 1}))
+
+        refreshes := families["automator_app_guid_cache_refreshes_total"].GetMetric()
+        Expect(refreshes[0].GetCounter().GetValue()).To(Equal(1.0))
+    })
+})
@@ -0,0 +1,32 @@
+package models
+
+import (
+    "fmt"
+    "net/http"
+)
+
+// DryRunRequest is a mutating request that was not sent because the client
+// is in dry run mode, without its Authorization header
+type DryRunRequest struct {
+    Method string
+    URL    string
+    Header http.Header
+    Body   string
+}
+
+func (r DryRunRequest) String() string {
+    if r.Body == "" {
+        return fmt.Sprintf("%s %s", r.Method, r.URL)
+    }
+    return fmt.Sprintf("%s %s with %s", r.Method, r.URL, r.Body)
+}
+
+// DryRunError is returned by a mutating call in dry run mode instead of
+// sending its request. Use errors.As to tell a preview from a failure.
+type DryRunError struct {
+    Request DryRunRequest
+}
+
+func (e *DryRunError) Error() string {
+    return "dry run: would send " + e.Request.String()
+}
@@ -1,16 +1,49 @@
 package models
 
+import (
+    "net/http"
+    "time"
+)
+
 type App struct {
-    Guid string `json:"guid"`
-    Name string `json:"name"`
+    Guid  string `json:"guid"`
+    Name  string `json:"name"`
+    State string `json:"state,omitempty"`
 }
 
 type Process struct {
     Instances int `json:"instances"`
 }
 
+// ProcessStats is the state and resource usage of one instance of a process
+type ProcessStats struct {
+    Type      string       `json:"type"`
+    Index     int          `json:"index"`
+    State     string       `json:"state"`
+    Usage     ProcessUsage `json:"usage"`
+    MemQuota  uint64       `json:"mem_quota"`
+    DiskQuota uint64       `json:"disk_quota"`
+    Uptime    int          `json:"uptime"`
+}
+
+// ProcessUsage is the usage of an instance at Time. CPU is a fraction of one
+// core and Mem and Disk are in bytes.
+type ProcessUsage struct {
+    Time time.Time `json:"time"`
+    CPU  float64   `json:"cpu"`
+    Mem  uint64    `json:"mem"`
+    Disk uint64    `json:"disk"`
+}
+
 type Task struct {
-    Guid string `json:"guid"`
+    Guid       string    `json:"guid"`
+    SequenceID int       `json:"sequence_id,omitempty"`
+    Name       string    `json:"name,omitempty"`
+    Command    string    `json:"command,omitempty"`
+    State      string    `json:"state,omitempty"`
+    MemoryInMB uint      `json:"memory_in_mb,omitempty"`
+    DiskInMB   uint      `json:"disk_in_mb,omitempty"`
+    CreatedAt  time.Time `json:"created_at"`
 }
 
 type TaskConfig struct {
@@ -19,3 +52,133 @@ type TaskConfig struct {
     MemoryInMB  uint   `json:"memory_in_mb,omitempty"`
     DropletGUID string `json:"droplet_guid,omitempty"`
 }
+
+// ResponseMetadata describes a completed CAPI request
+type ResponseMetadata struct {
+    Method     string
+    Path       string
+    StatusCode int
+    RequestID  string
+    Header     http.Header
+    Duration   time.Duration
+
+    // Warnings are the decoded X-Cf-Warnings, e.g. deprecations or quotas
+    // that are close to their limit
+    Warnings []string
+
+    // JobLocation is the job to poll if CAPI accepted the request to
+    // complete it asynchronously
+    JobLocation string
+}
+
+const (
+    JobProcessing = "PROCESSING"
+    JobPolling    = "POLLING"
+    JobComplete   = "COMPLETE"
+    JobFailed     = "FAILED"
+)
+
+// Job tracks an operation that CAPI completes asynchronously
+type Job struct {
+    Guid      string       `json:"guid"`
+    State     string       `json:"state"`
+    Operation string       `json:"operation"`
+    Errors    []JobError   `json:"errors"`
+    Warnings  []JobWarning `json:"warnings"`
+    CreatedAt time.Time    `json:"created_at"`
+    UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// Done returns whether the job completed or failed
+func (j Job) Done() bool {
+    return j.State == JobComplete || j.State == JobFailed
+}
+
+type JobError struct {
+    Code   int    `json:"code"`
+    Title  string `json:"title"`
+    Detail string `json:"detail"`
+}
+
+type JobWarning struct {
+    Detail string `json:"detail"`
+}
+
+type Claims struct {
+    Scopes    []string `json:"scope"`
+    UserID    string   `json:"user_id"`
+    UserName  string   `json:"user_name"`
+    ClientID  string   `json:"client_id"`
+    Issuer    string   `json:"iss"`
+    ExpiresAt int64    `json:"exp"`
+}
+
+func (c Claims) HasScope(scope string) bool {
+    for _, s := range c.Scopes {
+        if s == scope {
+            return true
+        }
+    }
+
+    return false
+}
+
+func (c Claims) Expiry() time.Time {
+    if c.ExpiresAt == 0 {
+        return time.Time{}
+    }
+
+    return time.Unix(c.ExpiresAt, 0)
+}
+
+type Link struct {
+    Href string   `json:"href"`
+    Meta LinkMeta `json:"meta"`
+}
+
+type LinkMeta struct {
+    Version            string `json:"version,omitempty"`
+    HostKeyFingerprint string `json:"host_key_fingerprint,omitempty"`
+    OauthClient        string `json:"oauth_client,omitempty"`
+}
+
+type Root struct {
+    Links RootLinks `json:"links"`
+}
+
+type RootLinks struct {
+    Self              Link `json:"self"`
+    CloudControllerV2 Link `json:"cloud_controller_v2"`
+    CloudControllerV3 Link `json:"cloud_controller_v3"`
+    NetworkPolicyV0   Link `json:"network_policy_v0"`
+    NetworkPolicyV1   Link `json:"network_policy_v1"`
+    Login             Link `json:"login"`
+    Uaa               Link `json:"uaa"`
+    Credhub           Link `json:"credhub"`
+    Routing           Link `json:"routing"`
+    Logging           Link `json:"logging"`
+    LogCache          Link `json:"log_cache"`
+    LogStream         Link `json:"log_stream"`
+    AppSsh            Link `json:"app_ssh"`
+}
+
+type Info struct {
+    Name          string                 `json:"name"`
+    Build         string                 `json:"build"`
+    Version       int                    `json:"version"`
+    Description   string                 `json:"description"`
+    OsbapiVersion string                 `json:"osbapi_version"`
+    CliVersion    CliVersion             `json:"cli_version"`
+    Custom        map[string]interface{} `json:"custom"`
+    Links         InfoLinks              `json:"links"`
+}
+
+type CliVersion struct {
+    Minimum     string `json:"minimum"`
+    Recommended string `json:"recommended"`
+}
+
+type InfoLinks struct {
+    Self    Link `json:"self"`
+    Support Link `json:"support"`
+}
@@ -1,5 +1,45 @@
 package models
 
-import "net/http"
+import (
+    "context"
+    "net/http"
+)
 
 type HeaderOption func(header *http.Header)
+
+// RequestIDHeader carries the id that the gorouter and Cloud Controller log
+// for a request
+const RequestIDHeader = "X-Vcap-Request-Id"
+
+// WithRequestID sends the given request id instead of letting the gorouter
+// generate one. Cloud Controller appends its own id to it.
+func WithRequestID(id string) HeaderOption {
+    return func(header *http.Header) {
+        header.Set(RequestIDHeader, id)
+    }
+}
+
+type responseMetadataKey struct{}
+
+// WithResponseMetadata returns a context that makes the call it is passed to
+// fill md with the request id, headers, warnings and duration of its response.
+// For calls that list several pages it describes the last page. md is left
+// unchanged if the request fails; a failed request returns an error carrying
+// the same information.
+func WithResponseMetadata(ctx context.Context, md *ResponseMetadata) context.Context {
+    return context.WithValue(ctx, responseMetadataKey{}, md)
+}
+
+// ResponseMetadataFrom returns the target set by WithResponseMetadata, or nil
+func ResponseMetadataFrom(ctx context.Context) *ResponseMetadata {
+    md, _ := ctx.Value(responseMetadataKey{}).(*ResponseMetadata)
+    return md
+}
+
+// RoundTripFunc sends a single CAPI request
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps every CAPI request. It may inspect or change the request,
+// the response and the error, or answer the request itself. Returning
+// neither a response nor an error fails the request.
+type Middleware func(next RoundTripFunc) RoundTripFunc
@@ -2,7 +2,9 @@ package client
 
 import (
     "github.com/pivotal-cf/app-automator-cf-client/internal"
+    "log/slog"
     "net/http"
+    "time"
 )
 
 type httpClient interface {
@@ -13,22 +15,68 @@ type OauthConfig struct {
     HttpClient httpClient
     OauthUrl   string
 
+    // OauthUrlGetter is used instead of OauthUrl when set, e.g. to discover
+    // the url from the CAPI root document on first use
+    OauthUrlGetter func() (string, error)
+
     Username string
     Password string
 
     Client       string
     ClientSecret string
+
+    // RefreshToken is exchanged for new tokens instead of the user or client
+    // credentials. AccessToken, if set, is used until it expires.
+    RefreshToken string
+    AccessToken  string
+
+    // CircuitBreakerThreshold is the number of consecutive UAA failures after
+    // which token requests fail fast with ErrCircuitOpen. UAA's /healthz is
+    // probed each time CircuitBreakerCooldown has passed until it is healthy.
+    CircuitBreakerThreshold int
+    CircuitBreakerCooldown  time.Duration
+    OnCircuitStateChange    func(name string, from, to CircuitState)
+
+    Logger  *slog.Logger
+    Metrics Metrics
 }
 
 func NewTokenCache(cfg OauthConfig) *internal.TokenCache {
     var oauthClient *internal.OauthClient
 
-    if cfg.Username != "" {
+    opts := []internal.OauthClientOption{
+        internal.WithOauthLogger(cfg.Logger),
+        internal.WithOauthMetrics(cfg.Metrics),
+    }
+    if cfg.OauthUrlGetter != nil {
+        opts = append(opts, internal.WithOauthUrlGetter(cfg.OauthUrlGetter))
+    }
+    if cfg.CircuitBreakerThreshold > 0 {
+        opts = append(opts, internal.WithOauthCircuitBreaker(internal.NewCircuitBreaker(
+            "uaa",
+            cfg.CircuitBreakerThreshold,
+            cfg.CircuitBreakerCooldown,
+            cfg.OnCircuitStateChange,
+            internal.WithProbe(internal.HttpProbe(cfg.HttpClient, uaaHealthUrl(cfg))),
+        )))
+    }
+
+    if cfg.RefreshToken != "" {
+        oauthClient = internal.NewRefreshTokenOauthClient(
+            cfg.HttpClient,
+            cfg.OauthUrl,
+            cfg.Client,
+            cfg.ClientSecret,
+            cfg.RefreshToken,
+            opts...,
+        )
+    } else if cfg.Username != "" {
         oauthClient = internal.NewUserOauthClient(
             cfg.HttpClient,
             cfg.OauthUrl,
             cfg.Username,
             cfg.Password,
+            opts...,
         )
     } else {
         oauthClient = internal.NewClientCredentialsOauthClient(
@@ -36,8 +84,33 @@ func NewTokenCache(cfg OauthConfig) *internal.TokenCache {
             cfg.OauthUrl,
             cfg.Client,
             cfg.ClientSecret,
+            opts...,
         )
     }
 
-    return internal.NewTokenCache(oauthClient.TokenWithExpiry)
+    cache := internal.NewTokenCache(
+        oauthClient.TokenWithExpiryContext,
+        internal.WithTokenCacheLogger(cfg.Logger),
+        internal.WithTokenCacheMetrics(cfg.Metrics),
+    )
+    if claims, err := internal.DecodeClaims(cfg.AccessToken); err == nil {
+        cache.Set(internal.TokenWithExpiry{
+            Token:     cfg.AccessToken,
+            ExpiresAt: claims.Expiry(),
+        })
+    }
+
+    return cache
+}
+
+// uaaHealthUrl returns the url that the circuit breaker probes
+func uaaHealthUrl(cfg OauthConfig) func() (string, error) {
+    return func() (string, error) {
+        if cfg.OauthUrlGetter == nil {
+            return cfg.OauthUrl + "/healthz", nil
+        }
+
+        oauthUrl, err := cfg.OauthUrlGetter()
+        return oauthUrl + "/healthz", err
+    }
 }
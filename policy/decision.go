@@ -0,0 +1,192 @@
+package policy
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+)
+
+// Decision records one evaluation of a rule
+type Decision struct {
+    AppName string
+    Time    time.Time
+
+    // Current is the instance count before the evaluation and Desired the
+    // count the rule asked for
+    Current uint
+    Desired uint
+
+    // CPU and Memory are the averages the thresholds were compared with and
+    // Running the number of instances they were taken from
+    CPU     float64
+    Memory  float64
+    Running int
+
+    // Schedule is the name of the schedule that set the bounds, if any
+    Schedule string
+
+    Reason string
+
+    // Scaled is true if Scale was called and succeeded. In dry run mode
+    // DryRun holds the scale request instead and cooldowns apply as if it
+    // had been sent. Err is set if reading the process or scaling it failed.
+    Scaled bool
+    DryRun *models.DryRunRequest
+    Err    error
+}
+
+func (d Decision) String() string {
+    if d.Err != nil {
+        return fmt.Sprintf("%s: %s: %s", d.AppName, d.Reason, d.Err)
+    }
+    if d.Desired == d.Current {
+        return fmt.Sprintf("%s: keeping %d instances: %s", d.AppName, d.Current, d.Reason)
+    }
+    if d.DryRun != nil {
+        return fmt.Sprintf("%s: would scale from %d to %d instances: %s", d.AppName, d.Current, d.Desired, d.Reason)
+    }
+    return fmt.Sprintf("%s: scaling from %d to %d instances: %s", d.AppName, d.Current, d.Desired, d.Reason)
+}
+
+// decide evaluates the rule against the current instance count and stats of
+// the process. lastScaled is when the engine last scaled the app, or zero.
+func (r Rule) decide(now time.Time, current uint, stats []models.ProcessStats, lastScaled time.Time) Decision {
+    min, max, schedule := r.bounds(now)
+    d := Decision{
+        AppName:  r.AppName,
+        Time:     now,
+        Current:  current,
+        Desired:  current,
+        Schedule: schedule,
+    }
+    d.CPU, d.Memory, d.Running = usage(stats)
+
+    bound := func(kind string) string {
+        if schedule != "" {
+            return "schedule " + schedule + " " + kind
+        }
+        return kind
+    }
+    if current < min {
+        d.Desired = min
+        d.Reason = fmt.Sprintf("below the %s of %d", bound("minimum"), min)
+        return d
+    }
+    if current > max {
+        d.Desired = max
+        d.Reason = fmt.Sprintf("above the %s of %d", bound("maximum"), max)
+        return d
+    }
+
+    if !lastScaled.IsZero() && now.Sub(lastScaled) < r.Cooldown {
+        d.Reason = fmt.Sprintf("cooling down until %s", lastScaled.Add(r.Cooldown).Format(time.RFC3339))
+        return d
+    }
+
+    if !r.CPU.enabled() && !r.Memory.enabled() {
+        d.Reason = "within bounds"
+        return d
+    }
+    if d.Running == 0 {
+        d.Reason = "no running instances to measure"
+        return d
+    }
+
+    if reasons := r.scaleOutReasons(d); len(reasons) > 0 {
+        d.Desired = minUint(current+step(r.StepUp), max)
+        d.Reason = strings.Join(reasons, ", ")
+        if d.Desired == current {
+            d.Reason += fmt.Sprintf(", but already at the maximum of %d", max)
+        }
+        return d
+    }
+
+    if reasons, ok := r.scaleInReasons(d); ok {
+        d.Desired = current - minUint(step(r.StepDown), current-min)
+        d.Reason = strings.Join(reasons, ", ")
+        if d.Desired == current {
+            d.Reason += fmt.Sprintf(", but already at the minimum of %d", min)
+        }
+        return d
+    }
+
+    d.Reason = "within thresholds"
+    return d
+}
+
+func (r Rule) scaleOutReasons(d Decision) []string {
+    var reasons []string
+    if r.CPU.ScaleOutAbove > 0 && d.CPU > r.CPU.ScaleOutAbove {
+        reasons = append(reasons, fmt.Sprintf("cpu %.1f%% above %.1f%%", d.CPU, r.CPU.ScaleOutAbove))
+    }
+    if r.Memory.ScaleOutAbove > 0 && d.Memory > r.Memory.ScaleOutAbove {
+        reasons = append(reasons, fmt.Sprintf("memory %.1f%% above %.1f%%", d.Memory, r.Memory.ScaleOutAbove))
+    }
+    return reasons
+}
+
+// scaleInReasons only allows scaling in if every enabled threshold has a
+// scale in limit that usage is below
+func (r Rule) scaleInReasons(d Decision) ([]string, bool) {
+    var reasons []string
+    for _, m := range []struct {
+        name      string
+        threshold Threshold
+        value     float64
+    }{
+        {"cpu", r.CPU, d.CPU},
+        {"memory", r.Memory, d.Memory},
+    } {
+        if !m.threshold.enabled() {
+            continue
+        }
+        if m.threshold.ScaleInBelow == 0 || m.value >= m.threshold.ScaleInBelow {
+            return nil, false
+        }
+        reasons = append(reasons, fmt.Sprintf("%s %.1f%% below %.1f%%", m.name, m.value, m.threshold.ScaleInBelow))
+    }
+
+    return reasons, len(reasons) > 0
+}
+
+// usage averages the CPU and memory usage of the running instances in
+// percent
+func usage(stats []models.ProcessStats) (cpu, memory float64, running int) {
+    var memInstances int
+    for _, s := range stats {
+        if s.State != "RUNNING" {
+            continue
+        }
+
+        running++
+        cpu += s.Usage.CPU * 100
+        if s.MemQuota > 0 {
+            memory += float64(s.Usage.Mem) / float64(s.MemQuota) * 100
+            memInstances++
+        }
+    }
+
+    if running > 0 {
+        cpu /= float64(running)
+    }
+    if memInstances > 0 {
+        memory /= float64(memInstances)
+    }
+    return cpu, memory, running
+}
+
+func step(n uint) uint {
+    if n == 0 {
+        return 1
+    }
+    return n
+}
+
+func minUint(a, b uint) uint {
+    if a < b {
+        return a
+    }
+    return b
+}
@@ -0,0 +1,235 @@
+package policy
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "sync"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/internal"
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+)
+
+const (
+    defaultInterval    = 30 * time.Second
+    defaultHistorySize = 100
+    processType        = "web"
+)
+
+// Scaler is the part of client.Client the engine needs
+type Scaler interface {
+    ProcessContext(ctx context.Context, appName, processType string, opts ...models.HeaderOption) (models.Process, error)
+    ProcessStatsContext(ctx context.Context, appName, processType string, opts ...models.HeaderOption) ([]models.ProcessStats, error)
+    ScaleContext(ctx context.Context, appName string, instanceTarget uint, opts ...models.HeaderOption) error
+}
+
+// Engine evaluates rules and scales apps accordingly
+type Engine struct {
+    scaler      Scaler
+    rules       []Rule
+    interval    time.Duration
+    historySize int
+    now         func() time.Time
+    logger      *slog.Logger
+    onDecision  func(Decision)
+
+    mu         sync.Mutex
+    lastScaled map[string]time.Time
+    history    []Decision
+}
+
+type Option func(*Engine)
+
+// WithInterval sets how often Run evaluates the rules, 30s by default or if d
+// is not positive
+func WithInterval(d time.Duration) Option {
+    return func(e *Engine) {
+        e.interval = d
+    }
+}
+
+// WithLogger logs every decision at info level and failures at error level
+func WithLogger(logger *slog.Logger) Option {
+    return func(e *Engine) {
+        if logger != nil {
+            e.logger = logger
+        }
+    }
+}
+
+// WithDecisionHandler is called with every decision after it is carried out
+func WithDecisionHandler(f func(Decision)) Option {
+    return func(e *Engine) {
+        e.onDecision = f
+    }
+}
+
+// WithHistorySize sets how many decisions Decisions returns, 100 by default or
+// if n is not positive
+func WithHistorySize(n int) Option {
+    return func(e *Engine) {
+        e.historySize = n
+    }
+}
+
+// WithClock replaces time.Now, e.g. to test schedules and cooldowns
+func WithClock(now func() time.Time) Option {
+    return func(e *Engine) {
+        e.now = now
+    }
+}
+
+// New creates an Engine for the rules, returning an error if any of them is
+// invalid. *client.Client is a Scaler; in dry run mode its scaling decisions
+// are previews that carry the request they would have sent.
+func New(scaler Scaler, rules []Rule, opts ...Option) (*Engine, error) {
+    seen := map[string]bool{}
+    for _, r := range rules {
+        err := r.Validate()
+        if err != nil {
+            return nil, err
+        }
+        if seen[r.AppName] {
+            return nil, fmt.Errorf("more than one rule for %s", r.AppName)
+        }
+        seen[r.AppName] = true
+    }
+
+    e := &Engine{
+        scaler:      scaler,
+        rules:       rules,
+        interval:    defaultInterval,
+        historySize: defaultHistorySize,
+        now:         time.Now,
+        logger:      internal.DiscardLogger(),
+        lastScaled:  map[string]time.Time{},
+    }
+    for _, o := range opts {
+        o(e)
+    }
+    if e.interval <= 0 {
+        e.interval = defaultInterval
+    }
+    if e.historySize <= 0 {
+        e.historySize = defaultHistorySize
+    }
+
+    return e, nil
+}
+
+// Run evaluates the rules right away and then at every interval until ctx is
+// done, when it returns ctx.Err()
+func (e *Engine) Run(ctx context.Context) error {
+    ticker := time.NewTicker(e.interval)
+    defer ticker.Stop()
+
+    for {
+        e.EvaluateContext(ctx)
+
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+// Evaluate evaluates every rule once, scales the apps that need it and
+// returns the decisions
+func (e *Engine) Evaluate() []Decision {
+    return e.EvaluateContext(context.Background())
+}
+
+// EvaluateContext is Evaluate with a context
+func (e *Engine) EvaluateContext(ctx context.Context) []Decision {
+    decisions := make([]Decision, 0, len(e.rules))
+    for _, r := range e.rules {
+        d := e.evaluate(ctx, r)
+        e.record(d)
+        decisions = append(decisions, d)
+    }
+
+    return decisions
+}
+
+// Decisions returns the most recent decisions, oldest first
+func (e *Engine) Decisions() []Decision {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+
+    return append([]Decision(nil), e.history...)
+}
+
+func (e *Engine) evaluate(ctx context.Context, r Rule) Decision {
+    now := e.now()
+
+    proc, err := e.scaler.ProcessContext(ctx, r.AppName, processType)
+    if err != nil {
+        return Decision{AppName: r.AppName, Time: now, Reason: "unable to get the process", Err: err}
+    }
+    current := uint(proc.Instances)
+
+    stats, err := e.scaler.ProcessStatsContext(ctx, r.AppName, processType)
+    if err != nil {
+        return Decision{AppName: r.AppName, Time: now, Current: current, Desired: current, Reason: "unable to get the process stats", Err: err}
+    }
+
+    e.mu.Lock()
+    lastScaled := e.lastScaled[r.AppName]
+    e.mu.Unlock()
+
+    d := r.decide(now, current, stats, lastScaled)
+    if d.Desired == d.Current {
+        return d
+    }
+
+    d.Err = e.scaler.ScaleContext(ctx, r.AppName, d.Desired)
+    var dryRun *models.DryRunError
+    if errors.As(d.Err, &dryRun) {
+        d.DryRun = &dryRun.Request
+        d.Err = nil
+    }
+    if d.Err != nil {
+        return d
+    }
+
+    d.Scaled = d.DryRun == nil
+    e.mu.Lock()
+    e.lastScaled[r.AppName] = now
+    e.mu.Unlock()
+
+    return d
+}
+
+func (e *Engine) record(d Decision) {
+    e.mu.Lock()
+    e.history = append(e.history, d)
+    if len(e.history) > e.historySize {
+        e.history = e.history[len(e.history)-e.historySize:]
+    }
+    e.mu.Unlock()
+
+    attrs := []any{
+        slog.String("app", d.AppName),
+        slog.Uint64("current", uint64(d.Current)),
+        slog.Uint64("desired", uint64(d.Desired)),
+        slog.String("reason", d.Reason),
+    }
+    if d.Schedule != "" {
+        attrs = append(attrs, slog.String("schedule", d.Schedule))
+    }
+    if d.DryRun != nil {
+        attrs = append(attrs, slog.Bool("dry_run", true))
+    }
+    if d.Err != nil {
+        e.logger.Error("autoscaling failed", append(attrs, slog.String("error", d.Err.Error()))...)
+    } else {
+        e.logger.Info("autoscaling decision", attrs...)
+    }
+
+    if e.onDecision != nil {
+        e.onDecision(d)
+    }
+}
@@ -0,0 +1,381 @@
+package policy_test
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+    "github.com/pivotal-cf/app-automator-cf-client/cftest"
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+    "github.com/pivotal-cf/app-automator-cf-client/policy"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("Engine", func() {
+    var (
+        scaler *fakeScaler
+        now    time.Time
+        clock  = func() time.Time { return now }
+    )
+
+    BeforeEach(func() {
+        // a Wednesday
+        now = time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+        scaler = &fakeScaler{instances: map[string]int{"worker": 3}}
+        scaler.setUsage(0.5, 0.5)
+    })
+
+    evaluate := func(rule policy.Rule, opts ...policy.Option) policy.Decision {
+        engine, err := policy.New(scaler, []policy.Rule{rule}, append(opts, policy.WithClock(clock))...)
+        Expect(err).ToNot(HaveOccurred())
+
+        decisions := engine.Evaluate()
+        Expect(decisions).To(HaveLen(1))
+        return decisions[0]
+    }
+
+    cpuRule := policy.Rule{
+        AppName:      "worker",
+        MinInstances: 1,
+        MaxInstances: 5,
+        CPU:          policy.Threshold{ScaleOutAbove: 80, ScaleInBelow: 20},
+    }
+
+    It("scales out when cpu is above the threshold", func() {
+        scaler.setUsage(0.9, 0.5)
+
+        d := evaluate(cpuRule)
+        Expect(d.Current).To(BeEquivalentTo(3))
+        Expect(d.Desired).To(BeEquivalentTo(4))
+        Expect(d.CPU).To(BeNumerically("~", 90))
+        Expect(d.Running).To(Equal(3))
+        Expect(d.Reason).To(Equal("cpu 90.0% above 80.0%"))
+        Expect(d.Scaled).To(BeTrue())
+        Expect(scaler.instances["worker"]).To(Equal(4))
+    })
+
+    It("scales in when cpu is below the threshold", func() {
+        scaler.setUsage(0.1, 0.5)
+
+        d := evaluate(cpuRule)
+        Expect(d.Desired).To(BeEquivalentTo(2))
+        Expect(d.Reason).To(Equal("cpu 10.0% below 20.0%"))
+        Expect(scaler.instances["worker"]).To(Equal(2))
+    })
+
+    It("keeps the instances within the thresholds", func() {
+        d := evaluate(cpuRule)
+        Expect(d.Desired).To(BeEquivalentTo(3))
+        Expect(d.Reason).To(Equal("within thresholds"))
+        Expect(d.Scaled).To(BeFalse())
+        Expect(scaler.scaleCalls).To(Equal(0))
+    })
+
+    It("uses the step sizes without leaving the bounds", func() {
+        scaler.setUsage(0.9, 0.5)
+        rule := cpuRule
+        rule.StepUp = 5
+
+        d := evaluate(rule)
+        Expect(d.Desired).To(BeEquivalentTo(5))
+
+        scaler.setUsage(0.1, 0.5)
+        rule.StepDown = 10
+        d = evaluate(rule)
+        Expect(d.Desired).To(BeEquivalentTo(1))
+    })
+
+    It("reports when it is already at the maximum", func() {
+        scaler.instances["worker"] = 5
+        scaler.setUsage(0.9, 0.5)
+
+        d := evaluate(cpuRule)
+        Expect(d.Desired).To(BeEquivalentTo(5))
+        Expect(d.Reason).To(HaveSuffix("but already at the maximum of 5"))
+        Expect(scaler.scaleCalls).To(Equal(0))
+    })
+
+    It("scales in only if every threshold allows it", func() {
+        scaler.setUsage(0.1, 0.7)
+        rule := cpuRule
+        rule.Memory = policy.Threshold{ScaleOutAbove: 90, ScaleInBelow: 50}
+
+        d := evaluate(rule)
+        Expect(d.Desired).To(BeEquivalentTo(3))
+        Expect(d.Memory).To(BeNumerically("~", 70))
+
+        scaler.setUsage(0.1, 0.3)
+        d = evaluate(rule)
+        Expect(d.Desired).To(BeEquivalentTo(2))
+        Expect(d.Reason).To(Equal("cpu 10.0% below 20.0%, memory 30.0% below 50.0%"))
+    })
+
+    It("scales out if any threshold is exceeded", func() {
+        scaler.setUsage(0.1, 0.95)
+        rule := cpuRule
+        rule.Memory = policy.Threshold{ScaleOutAbove: 90}
+
+        d := evaluate(rule)
+        Expect(d.Desired).To(BeEquivalentTo(4))
+        Expect(d.Reason).To(Equal("memory 95.0% above 90.0%"))
+    })
+
+    It("only measures running instances", func() {
+        scaler.stats = []models.ProcessStats{
+            {State: "RUNNING", Usage: models.ProcessUsage{CPU: 0.9}},
+            {State: "CRASHED"},
+        }
+
+        d := evaluate(cpuRule)
+        Expect(d.Running).To(Equal(1))
+        Expect(d.CPU).To(BeNumerically("~", 90))
+
+        scaler.stats = []models.ProcessStats{{State: "STARTING"}}
+        d = evaluate(cpuRule)
+        Expect(d.Desired).To(BeEquivalentTo(d.Current))
+        Expect(d.Reason).To(Equal("no running instances to measure"))
+    })
+
+    It("scales into the bounds", func() {
+        scaler.instances["worker"] = 8
+
+        d := evaluate(cpuRule)
+        Expect(d.Desired).To(BeEquivalentTo(5))
+        Expect(d.Reason).To(Equal("above the maximum of 5"))
+
+        scaler.instances["worker"] = 0
+        rule := cpuRule
+        rule.MinInstances = 2
+        d = evaluate(rule)
+        Expect(d.Desired).To(BeEquivalentTo(2))
+        Expect(d.Reason).To(Equal("below the minimum of 2"))
+    })
+
+    It("waits for the cooldown after scaling", func() {
+        scaler.setUsage(0.9, 0.5)
+        rule := cpuRule
+        rule.Cooldown = 5 * time.Minute
+        engine, err := policy.New(scaler, []policy.Rule{rule}, policy.WithClock(clock))
+        Expect(err).ToNot(HaveOccurred())
+
+        Expect(engine.Evaluate()[0].Desired).To(BeEquivalentTo(4))
+
+        now = now.Add(time.Minute)
+        d := engine.Evaluate()[0]
+        Expect(d.Desired).To(BeEquivalentTo(4))
+        Expect(d.Reason).To(Equal("cooling down until 2024-05-15T12:05:00Z"))
+
+        now = now.Add(5 * time.Minute)
+        Expect(engine.Evaluate()[0].Desired).To(BeEquivalentTo(5))
+    })
+
+    It("applies scheduled overrides", func() {
+        rule := cpuRule
+        rule.Schedules = []policy.Schedule{
+            {Name: "weekend", Days: []time.Weekday{time.Saturday, time.Sunday}, Start: "00:00", End: "23:59", MaxInstances: 1},
+            {Name: "business hours", Start: "09:00", End: "17:00", MinInstances: 4},
+        }
+
+        d := evaluate(rule)
+        Expect(d.Schedule).To(Equal("business hours"))
+        Expect(d.Desired).To(BeEquivalentTo(4))
+        Expect(d.Reason).To(Equal("below the schedule business hours minimum of 4"))
+
+        now = time.Date(2024, 5, 18, 12, 0, 0, 0, time.UTC)
+        d = evaluate(rule)
+        Expect(d.Schedule).To(Equal("weekend"))
+        Expect(d.Desired).To(BeEquivalentTo(1))
+    })
+
+    It("records failures", func() {
+        scaler.setUsage(0.9, 0.5)
+        scaler.scaleErr = errors.New("expected")
+
+        d := evaluate(cpuRule)
+        Expect(d.Err).To(MatchError("expected"))
+        Expect(d.Scaled).To(BeFalse())
+
+        scaler.processErr = errors.New("no process")
+        d = evaluate(cpuRule)
+        Expect(d.Err).To(MatchError("no process"))
+        Expect(d.Reason).To(Equal("unable to get the process"))
+    })
+
+    It("keeps a bounded history and calls the decision handler", func() {
+        var handled []policy.Decision
+        engine, err := policy.New(scaler, []policy.Rule{cpuRule},
+            policy.WithHistorySize(2),
+            policy.WithDecisionHandler(func(d policy.Decision) {
+                handled = append(handled, d)
+            }),
+        )
+        Expect(err).ToNot(HaveOccurred())
+
+        for i := 0; i < 3; i++ {
+            engine.Evaluate()
+        }
+
+        Expect(handled).To(HaveLen(3))
+        Expect(engine.Decisions()).To(HaveLen(2))
+    })
+
+    It("keeps the default history size if the given one is not positive", func() {
+        engine, err := policy.New(scaler, []policy.Rule{cpuRule}, policy.WithHistorySize(-1))
+        Expect(err).ToNot(HaveOccurred())
+
+        for i := 0; i < 3; i++ {
+            engine.Evaluate()
+        }
+
+        Expect(engine.Decisions()).To(HaveLen(3))
+    })
+
+    It("keeps the default interval if the given one is not positive", func() {
+        engine, err := policy.New(scaler, []policy.Rule{cpuRule}, policy.WithInterval(0))
+        Expect(err).ToNot(HaveOccurred())
+
+        ctx, cancel := context.WithCancel(context.Background())
+        done := make(chan error)
+        go func() { done <- engine.Run(ctx) }()
+
+        Eventually(func() int { return len(engine.Decisions()) }).Should(Equal(1))
+        Consistently(func() int { return len(engine.Decisions()) }, 50*time.Millisecond).Should(Equal(1))
+        cancel()
+        Eventually(done).Should(Receive(Equal(context.Canceled)))
+    })
+
+    It("evaluates at every interval until the context is done", func() {
+        engine, err := policy.New(scaler, []policy.Rule{cpuRule}, policy.WithInterval(10*time.Millisecond))
+        Expect(err).ToNot(HaveOccurred())
+
+        ctx, cancel := context.WithCancel(context.Background())
+        done := make(chan error)
+        go func() { done <- engine.Run(ctx) }()
+
+        Eventually(func() int { return len(engine.Decisions()) }).Should(BeNumerically(">=", 3))
+        cancel()
+        Eventually(done).Should(Receive(Equal(context.Canceled)))
+    })
+
+    It("scales apps through the client", func() {
+        server := cftest.NewServer()
+        defer server.Close()
+        app := server.AddApp(cftest.App{Name: "worker"})
+        p, _ := server.Process(app.Guid, "web")
+        p.CPU = 0.95
+        server.SetProcess(p)
+
+        engine, err := policy.New(client.New(server.Config()), []policy.Rule{cpuRule})
+        Expect(err).ToNot(HaveOccurred())
+
+        d := engine.Evaluate()[0]
+        Expect(d.Err).ToNot(HaveOccurred())
+        Expect(d.Scaled).To(BeTrue())
+
+        p, _ = server.Process(app.Guid, "web")
+        Expect(p.Instances).To(Equal(2))
+    })
+
+    It("passes the context on to the scaler", func() {
+        scaler.setUsage(0.9, 0.5)
+        engine, err := policy.New(scaler, []policy.Rule{cpuRule})
+        Expect(err).ToNot(HaveOccurred())
+
+        ctx := context.WithValue(context.Background(), contextKey{}, "value")
+        d := engine.EvaluateContext(ctx)[0]
+        Expect(d.Scaled).To(BeTrue())
+        Expect(scaler.ctx.Value(contextKey{})).To(Equal("value"))
+    })
+
+    It("previews scaling in dry run mode", func() {
+        server := cftest.NewServer()
+        defer server.Close()
+        app := server.AddApp(cftest.App{Name: "worker"})
+        p, _ := server.Process(app.Guid, "web")
+        p.CPU = 0.95
+        server.SetProcess(p)
+
+        var dryRuns []client.DryRunRequest
+        cfg := server.Config()
+        cfg.DryRun = true
+        cfg.OnDryRun = func(r client.DryRunRequest) {
+            dryRuns = append(dryRuns, r)
+        }
+        engine, err := policy.New(client.New(cfg), []policy.Rule{cpuRule})
+        Expect(err).ToNot(HaveOccurred())
+
+        d := engine.Evaluate()[0]
+        Expect(d.Err).ToNot(HaveOccurred())
+        Expect(d.Desired).To(BeEquivalentTo(2))
+        Expect(d.Scaled).To(BeFalse())
+        Expect(d.DryRun).ToNot(BeNil())
+        Expect(d.DryRun.Body).To(MatchJSON(`{"instances": 2}`))
+        Expect(d.String()).To(HavePrefix("worker: would scale from 1 to 2 instances"))
+        Expect(dryRuns).To(HaveLen(1))
+
+        p, _ = server.Process(app.Guid, "web")
+        Expect(p.Instances).To(Equal(1))
+    })
+
+    It("rejects invalid and duplicate rules", func() {
+        _, err := policy.New(scaler, []policy.Rule{{AppName: "worker"}})
+        Expect(err).To(MatchError("rule for worker has no maximum instance count"))
+
+        _, err = policy.New(scaler, []policy.Rule{cpuRule, cpuRule})
+        Expect(err).To(MatchError("more than one rule for worker"))
+    })
+})
+
+type contextKey struct{}
+
+type fakeScaler struct {
+    mu         sync.Mutex
+    instances  map[string]int
+    stats      []models.ProcessStats
+    scaleCalls int
+    processErr error
+    scaleErr   error
+    ctx        context.Context
+}
+
+// setUsage reports the same cpu and memory usage, as a fraction of the
+// quota, for every instance
+func (s *fakeScaler) setUsage(cpu, mem float64) {
+    s.stats = nil
+    for i := 0; i < s.instances["worker"]; i++ {
+        s.stats = append(s.stats, models.ProcessStats{
+            Index:    i,
+            State:    "RUNNING",
+            Usage:    models.ProcessUsage{CPU: cpu, Mem: uint64(mem*1000 + 0.5)},
+            MemQuota: 1000,
+        })
+    }
+}
+
+func (s *fakeScaler) ProcessContext(ctx context.Context, appName, processType string, opts ...models.HeaderOption) (models.Process, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return models.Process{Instances: s.instances[appName]}, s.processErr
+}
+
+func (s *fakeScaler) ProcessStatsContext(ctx context.Context, appName, processType string, opts ...models.HeaderOption) ([]models.ProcessStats, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.stats, nil
+}
+
+func (s *fakeScaler) ScaleContext(ctx context.Context, appName string, instanceTarget uint, opts ...models.HeaderOption) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.ctx = ctx
+    if s.scaleErr != nil {
+        return s.scaleErr
+    }
+    s.scaleCalls++
+    s.instances[appName] = int(instanceTarget)
+    return nil
+}
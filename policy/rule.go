@@ -0,0 +1,196 @@
+// Package policy scales apps according to declarative rules. An Engine
+// periodically reads the instance count and stats of the web process of each
+// app, decides on a new instance count and calls Scale, recording every
+// Decision with its reason:
+//
+//    engine, err := policy.New(c, []policy.Rule{{
+//        AppName:      "worker",
+//        MinInstances: 2,
+//        MaxInstances: 10,
+//        CPU:          policy.Threshold{ScaleOutAbove: 80, ScaleInBelow: 20},
+//        Cooldown:     5 * time.Minute,
+//    }})
+//    err = engine.Run(ctx)
+package policy
+
+import (
+    "fmt"
+    "time"
+)
+
+const timeOfDayLayout = "15:04"
+
+// Rule describes how to scale the web process of one app
+type Rule struct {
+    AppName string
+
+    // MinInstances and MaxInstances bound the instance count. An app outside
+    // the bounds is scaled into them right away, regardless of the cooldown.
+    MinInstances uint
+    MaxInstances uint
+
+    // CPU is the average CPU usage of the running instances in percent of
+    // one core. Memory is their average memory usage in percent of the
+    // memory quota.
+    CPU    Threshold
+    Memory Threshold
+
+    // StepUp and StepDown are the number of instances added or removed at a
+    // time. Both default to 1.
+    StepUp   uint
+    StepDown uint
+
+    // Cooldown is the time to wait after scaling before the thresholds are
+    // evaluated again
+    Cooldown time.Duration
+
+    // Schedules override the bounds while they are active. The first active
+    // schedule wins.
+    Schedules []Schedule
+}
+
+// Threshold scales out when usage is above ScaleOutAbove and in when it is
+// below ScaleInBelow. A zero value disables that direction. The app is
+// scaled out if any threshold is exceeded and in only if every enabled
+// threshold allows it.
+type Threshold struct {
+    ScaleOutAbove float64
+    ScaleInBelow  float64
+}
+
+func (t Threshold) enabled() bool {
+    return t.ScaleOutAbove > 0 || t.ScaleInBelow > 0
+}
+
+// Schedule overrides the bounds of a rule between Start and End, given as
+// "15:04" in Location, on Days. Every day is included if Days is empty and
+// UTC is used if Location is nil. A window whose End is before its Start
+// spans midnight. Zero bounds keep the rule's own; a MinInstances above the
+// rule's maximum raises the maximum too.
+type Schedule struct {
+    Name         string
+    Days         []time.Weekday
+    Start        string
+    End          string
+    Location     *time.Location
+    MinInstances uint
+    MaxInstances uint
+}
+
+// Validate reports the first problem with the rule
+func (r Rule) Validate() error {
+    if r.AppName == "" {
+        return fmt.Errorf("rule has no app name")
+    }
+    if r.MaxInstances == 0 {
+        return fmt.Errorf("rule for %s has no maximum instance count", r.AppName)
+    }
+    if r.MinInstances > r.MaxInstances {
+        return fmt.Errorf("rule for %s has a minimum of %d above its maximum of %d", r.AppName, r.MinInstances, r.MaxInstances)
+    }
+
+    for _, t := range []struct {
+        name string
+        Threshold
+    }{{"cpu", r.CPU}, {"memory", r.Memory}} {
+        if t.ScaleOutAbove > 0 && t.ScaleInBelow >= t.ScaleOutAbove {
+            return fmt.Errorf("rule for %s scales in below %.1f%% %s, which is not below its scale out threshold of %.1f%%", r.AppName, t.ScaleInBelow, t.name, t.ScaleOutAbove)
+        }
+    }
+
+    for _, s := range r.Schedules {
+        _, _, err := s.window()
+        if err != nil {
+            return fmt.Errorf("rule for %s: %s", r.AppName, err)
+        }
+        if s.MaxInstances > 0 && s.MinInstances > s.MaxInstances {
+            return fmt.Errorf("rule for %s: schedule %s has a minimum of %d above its maximum of %d", r.AppName, s.Name, s.MinInstances, s.MaxInstances)
+        }
+    }
+
+    return nil
+}
+
+// bounds returns the instance bounds at t and the name of the schedule that
+// set them, if any
+func (r Rule) bounds(t time.Time) (uint, uint, string) {
+    for _, s := range r.Schedules {
+        if !s.active(t) {
+            continue
+        }
+
+        min, max := r.MinInstances, r.MaxInstances
+        if s.MinInstances > 0 {
+            min = s.MinInstances
+        }
+        if s.MaxInstances > 0 {
+            max = s.MaxInstances
+        }
+        if min > max {
+            max = min
+        }
+        return min, max, s.Name
+    }
+
+    return r.MinInstances, r.MaxInstances, ""
+}
+
+func (s Schedule) active(t time.Time) bool {
+    start, end, err := s.window()
+    if err != nil {
+        return false
+    }
+
+    loc := s.Location
+    if loc == nil {
+        loc = time.UTC
+    }
+    t = t.In(loc)
+
+    sinceMidnight := timeOfDay(t)
+    day := t.Weekday()
+
+    var inWindow bool
+    switch {
+    case start <= end:
+        inWindow = sinceMidnight >= start && sinceMidnight < end
+    case sinceMidnight >= start:
+        inWindow = true
+    case sinceMidnight < end:
+        // after midnight the window belongs to the day it started on
+        inWindow = true
+        day = (day + 6) % 7
+    }
+
+    return inWindow && s.onDay(day)
+}
+
+func (s Schedule) onDay(day time.Weekday) bool {
+    if len(s.Days) == 0 {
+        return true
+    }
+
+    for _, d := range s.Days {
+        if d == day {
+            return true
+        }
+    }
+    return false
+}
+
+func (s Schedule) window() (time.Duration, time.Duration, error) {
+    start, err := time.Parse(timeOfDayLayout, s.Start)
+    if err != nil {
+        return 0, 0, fmt.Errorf("schedule %s has an invalid start %q, expected HH:MM", s.Name, s.Start)
+    }
+    end, err := time.Parse(timeOfDayLayout, s.End)
+    if err != nil {
+        return 0, 0, fmt.Errorf("schedule %s has an invalid end %q, expected HH:MM", s.Name, s.End)
+    }
+
+    return timeOfDay(start), timeOfDay(end), nil
+}
+
+func timeOfDay(t time.Time) time.Duration {
+    return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
@@ -0,0 +1,74 @@
+package policy_test
+
+import (
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/policy"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rule", func() {
+    DescribeTable("Validate()",
+        func(modify func(*policy.Rule), expected string) {
+            r := policy.Rule{
+                AppName:      "worker",
+                MinInstances: 1,
+                MaxInstances: 5,
+                CPU:          policy.Threshold{ScaleOutAbove: 80, ScaleInBelow: 20},
+            }
+            modify(&r)
+
+            err := r.Validate()
+            if expected == "" {
+                Expect(err).ToNot(HaveOccurred())
+                return
+            }
+            Expect(err).To(MatchError(expected))
+        },
+        Entry("valid", func(r *policy.Rule) {}, ""),
+        Entry("no app name", func(r *policy.Rule) { r.AppName = "" }, "rule has no app name"),
+        Entry("min above max", func(r *policy.Rule) { r.MinInstances = 6 }, "rule for worker has a minimum of 6 above its maximum of 5"),
+        Entry("overlapping thresholds", func(r *policy.Rule) { r.Memory = policy.Threshold{ScaleOutAbove: 50, ScaleInBelow: 60} },
+            "rule for worker scales in below 60.0% memory, which is not below its scale out threshold of 50.0%"),
+        Entry("invalid schedule time", func(r *policy.Rule) {
+            r.Schedules = []policy.Schedule{{Name: "nightly", Start: "22", End: "06:00"}}
+        }, `rule for worker: schedule nightly has an invalid start "22", expected HH:MM`),
+        Entry("schedule min above max", func(r *policy.Rule) {
+            r.Schedules = []policy.Schedule{{Name: "nightly", Start: "22:00", End: "06:00", MinInstances: 3, MaxInstances: 2}}
+        }, "rule for worker: schedule nightly has a minimum of 3 above its maximum of 2"),
+    )
+
+    Describe("schedules", func() {
+        evaluateAt := func(t time.Time, s policy.Schedule) string {
+            scaler := &fakeScaler{instances: map[string]int{"worker": 1}}
+            engine, err := policy.New(scaler, []policy.Rule{{
+                AppName:      "worker",
+                MaxInstances: 5,
+                Schedules:    []policy.Schedule{s},
+            }}, policy.WithClock(func() time.Time { return t }))
+            Expect(err).ToNot(HaveOccurred())
+
+            return engine.Evaluate()[0].Schedule
+        }
+
+        nightly := policy.Schedule{Name: "nightly", Days: []time.Weekday{time.Friday}, Start: "22:00", End: "06:00", MinInstances: 3}
+
+        It("spans midnight and belongs to the day it starts on", func() {
+            Expect(evaluateAt(time.Date(2024, 5, 17, 23, 0, 0, 0, time.UTC), nightly)).To(Equal("nightly"))
+            Expect(evaluateAt(time.Date(2024, 5, 18, 5, 59, 0, 0, time.UTC), nightly)).To(Equal("nightly"))
+            Expect(evaluateAt(time.Date(2024, 5, 18, 6, 0, 0, 0, time.UTC), nightly)).To(BeEmpty())
+            Expect(evaluateAt(time.Date(2024, 5, 17, 5, 0, 0, 0, time.UTC), nightly)).To(BeEmpty())
+        })
+
+        It("uses the location of the schedule", func() {
+            s := nightly
+            s.Location = time.FixedZone("UTC+2", 2*60*60)
+
+            Expect(evaluateAt(time.Date(2024, 5, 17, 19, 0, 0, 0, time.UTC), s)).To(BeEmpty())
+            Expect(evaluateAt(time.Date(2024, 5, 17, 20, 0, 0, 0, time.UTC), s)).To(Equal("nightly"))
+        })
+    })
+})
@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Cron is a parsed cron expression
+type Cron struct {
+    minute, hour, dom, month, dow uint64
+
+    // domRestricted and dowRestricted are set unless the field is *. If
+    // both are restricted a time matches if either does, as in cron.
+    domRestricted bool
+    dowRestricted bool
+}
+
+var cronAliases = map[string]string{
+    "@yearly":   "0 0 1 1 *",
+    "@annually": "0 0 1 1 *",
+    "@monthly":  "0 0 1 * *",
+    "@weekly":   "0 0 * * 0",
+    "@daily":    "0 0 * * *",
+    "@midnight": "0 0 * * *",
+    "@hourly":   "0 * * * *",
+}
+
+var cronFields = []struct {
+    name     string
+    min, max int
+}{
+    {"minute", 0, 59},
+    {"hour", 0, 23},
+    {"day of month", 1, 31},
+    {"month", 1, 12},
+    {"day of week", 0, 7},
+}
+
+// ParseCron parses a standard five field cron expression, e.g. "30 2 * * 1-5",
+// or one of @yearly, @monthly, @weekly, @daily, @midnight and @hourly. Fields
+// accept *, lists, ranges and steps. Sunday is 0 or 7.
+func ParseCron(expr string) (Cron, error) {
+    spec := strings.TrimSpace(expr)
+    if alias, ok := cronAliases[spec]; ok {
+        spec = alias
+    }
+
+    fields := strings.Fields(spec)
+    if len(fields) != len(cronFields) {
+        return Cron{}, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", expr, len(fields))
+    }
+
+    var bits [5]uint64
+    for i, f := range cronFields {
+        var err error
+        bits[i], err = parseCronField(fields[i], f.min, f.max)
+        if err != nil {
+            return Cron{}, fmt.Errorf("invalid cron expression %q: %s: %s", expr, f.name, err)
+        }
+    }
+
+    // 7 is another name for Sunday
+    if bits[4]&(1<<7) != 0 {
+        bits[4] = bits[4]&^(1<<7) | 1
+    }
+
+    return Cron{
+        minute:        bits[0],
+        hour:          bits[1],
+        dom:           bits[2],
+        month:         bits[3],
+        dow:           bits[4],
+        domRestricted: fields[2] != "*",
+        dowRestricted: fields[4] != "*",
+    }, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+    var bits uint64
+    for _, part := range strings.Split(field, ",") {
+        rangePart, step := part, 1
+        if i := strings.Index(part, "/"); i >= 0 {
+            var err error
+            step, err = strconv.Atoi(part[i+1:])
+            if err != nil || step <= 0 {
+                return 0, fmt.Errorf("invalid step in %q", part)
+            }
+            rangePart = part[:i]
+        }
+
+        lo, hi := min, max
+        switch {
+        case rangePart == "*":
+        case strings.Contains(rangePart, "-"):
+            bounds := strings.SplitN(rangePart, "-", 2)
+            var err error
+            lo, err = strconv.Atoi(bounds[0])
+            if err != nil {
+                return 0, fmt.Errorf("invalid range %q", part)
+            }
+            hi, err = strconv.Atoi(bounds[1])
+            if err != nil {
+                return 0, fmt.Errorf("invalid range %q", part)
+            }
+        default:
+            n, err := strconv.Atoi(rangePart)
+            if err != nil {
+                return 0, fmt.Errorf("invalid value %q", part)
+            }
+            lo, hi = n, n
+            if step > 1 {
+                hi = max
+            }
+        }
+
+        if lo < min || hi > max || lo > hi {
+            return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+        }
+        for n := lo; n <= hi; n += step {
+            bits |= 1 << uint(n)
+        }
+    }
+
+    return bits, nil
+}
+
+// Next returns the first time after t that matches, in t's location. It
+// returns the zero time if nothing matches within five years, e.g. for
+// "0 0 30 2 *".
+func (c Cron) Next(t time.Time) time.Time {
+    t = t.Truncate(time.Minute).Add(time.Minute)
+    limit := t.AddDate(5, 0, 0)
+
+    for t.Before(limit) {
+        if !has(c.month, int(t.Month())) {
+            t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+            continue
+        }
+        if !c.dayMatches(t) {
+            t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+            continue
+        }
+        if !has(c.hour, t.Hour()) {
+            t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+            continue
+        }
+        if !has(c.minute, t.Minute()) {
+            t = t.Add(time.Minute)
+            continue
+        }
+        return t
+    }
+
+    return time.Time{}
+}
+
+func (c Cron) dayMatches(t time.Time) bool {
+    dom := has(c.dom, t.Day())
+    dow := has(c.dow, int(t.Weekday()))
+    if c.domRestricted && c.dowRestricted {
+        return dom || dow
+    }
+    return dom && dow
+}
+
+func has(bits uint64, n int) bool {
+    return bits&(1<<uint(n)) != 0
+}
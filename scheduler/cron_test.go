@@ -0,0 +1,56 @@
+package scheduler_test
+
+import (
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/scheduler"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cron", func() {
+    // a Wednesday
+    from := time.Date(2024, 5, 15, 12, 30, 20, 0, time.UTC)
+
+    DescribeTable("Next()",
+        func(expr string, expected time.Time) {
+            cron, err := scheduler.ParseCron(expr)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(cron.Next(from)).To(Equal(expected))
+        },
+        Entry("every minute", "* * * * *", time.Date(2024, 5, 15, 12, 31, 0, 0, time.UTC)),
+        Entry("nightly", "30 2 * * *", time.Date(2024, 5, 16, 2, 30, 0, 0, time.UTC)),
+        Entry("later today", "45 12 * * *", time.Date(2024, 5, 15, 12, 45, 0, 0, time.UTC)),
+        Entry("steps", "*/20 * * * *", time.Date(2024, 5, 15, 12, 40, 0, 0, time.UTC)),
+        Entry("ranges and lists", "0 9-11,14 * * *", time.Date(2024, 5, 15, 14, 0, 0, 0, time.UTC)),
+        Entry("weekdays", "0 8 * * 1-5", time.Date(2024, 5, 16, 8, 0, 0, 0, time.UTC)),
+        Entry("sunday as 7", "0 0 * * 7", time.Date(2024, 5, 19, 0, 0, 0, 0, time.UTC)),
+        Entry("day of month", "0 0 1 * *", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)),
+        Entry("day of month or week", "0 0 1 * 5", time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)),
+        Entry("leap day", "0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)),
+        Entry("alias", "@hourly", time.Date(2024, 5, 15, 13, 0, 0, 0, time.UTC)),
+        Entry("never", "0 0 30 2 *", time.Time{}),
+    )
+
+    It("uses the location of the time", func() {
+        cron, err := scheduler.ParseCron("0 2 * * *")
+        Expect(err).ToNot(HaveOccurred())
+
+        zone := time.FixedZone("UTC-5", -5*60*60)
+        Expect(cron.Next(from.In(zone))).To(Equal(time.Date(2024, 5, 16, 2, 0, 0, 0, zone)))
+    })
+
+    DescribeTable("invalid expressions",
+        func(expr, expected string) {
+            _, err := scheduler.ParseCron(expr)
+            Expect(err).To(MatchError(ContainSubstring(expected)))
+        },
+        Entry("too few fields", "* * *", "expected 5 fields, got 3"),
+        Entry("out of range", "60 * * * *", `minute: "60" is out of range 0-59`),
+        Entry("not a number", "* x * * *", `hour: invalid value "x"`),
+        Entry("bad step", "*/0 * * * *", `minute: invalid step in "*/0"`),
+        Entry("reversed range", "* * * 5-2 *", `month: "5-2" is out of range 1-12`),
+    )
+})
@@ -0,0 +1,523 @@
+// Package scheduler runs Cloud Foundry tasks on cron schedules:
+//
+//    s, err := scheduler.New(c, []scheduler.Schedule{{
+//        Name:    "nightly-report",
+//        AppName: "reports",
+//        Cron:    "30 2 * * *",
+//        Command: "bin/report",
+//        Task:    models.TaskConfig{MemoryInMB: 512},
+//        Jitter:  5 * time.Minute,
+//    }})
+//    err = s.Run(ctx)
+//
+// A run is skipped while a task with the same name is still pending or
+// running, so slow tasks never overlap. Every run is kept in the history
+// and its state follows the task until it succeeds or fails.
+package scheduler
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "math/rand"
+    "sync"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client/internal"
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+)
+
+const (
+    defaultHistorySize    = 100
+    defaultStatusInterval = 30 * time.Second
+
+    // maxMissedRefreshes is how many refreshes in a row may not list the task
+    // of a run before the run is given up as lost
+    maxMissedRefreshes = 3
+)
+
+// Run states in addition to the task states PENDING, RUNNING, SUCCEEDED and
+// FAILED
+const (
+    // RunSkipped is a run that did not start because the previous task was
+    // still pending or running
+    RunSkipped = "SKIPPED"
+
+    // RunErrored is a run whose task could not be created
+    RunErrored = "ERRORED"
+
+    // RunDryRun is a run whose task was not created because the client is
+    // in dry run mode
+    RunDryRun = "DRY_RUN"
+
+    // RunLost is a run whose task stopped being listed before it finished,
+    // e.g. because the task or its app was deleted
+    RunLost = "LOST"
+)
+
+// TaskClient is the part of client.Client the scheduler needs
+type TaskClient interface {
+    CreateTaskContext(ctx context.Context, appName, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error)
+    TasksContext(ctx context.Context, appName string, query map[string]string) ([]models.Task, error)
+}
+
+// Schedule runs Command as a task of AppName whenever Cron matches, in
+// Location or UTC if it is nil. The task is named after the schedule unless
+// Task.Name is set. Each run waits a random delay of up to Jitter before it
+// starts, to spread out schedules that fire at the same time.
+type Schedule struct {
+    Name     string
+    AppName  string
+    Cron     string
+    Command  string
+    Task     models.TaskConfig
+    Jitter   time.Duration
+    Location *time.Location
+}
+
+// Run is one firing of a schedule
+type Run struct {
+    Schedule    string
+    AppName     string
+    ScheduledAt time.Time
+    StartedAt   time.Time
+    FinishedAt  time.Time
+
+    // TaskGuid is empty if the run was skipped, errored or a dry run
+    TaskGuid string
+    State    string
+    Reason   string
+    Err      error
+
+    // missed counts the refreshes in a row that did not list the task
+    missed int
+}
+
+// Done reports whether the run has reached a final state
+func (r Run) Done() bool {
+    switch r.State {
+    case "SUCCEEDED", "FAILED", RunSkipped, RunErrored, RunDryRun, RunLost:
+        return true
+    }
+    return false
+}
+
+// Succeeded reports whether the task of the run succeeded
+func (r Run) Succeeded() bool {
+    return r.State == "SUCCEEDED"
+}
+
+type entry struct {
+    Schedule
+    cron Cron
+    next time.Time
+
+    // starting serializes the runs of the schedule, so that a run that is
+    // fired while another one is starting sees its task and is skipped
+    starting sync.Mutex
+}
+
+// Scheduler runs tasks on their schedules
+type Scheduler struct {
+    client         TaskClient
+    entries        []*entry
+    now            func() time.Time
+    logger         *slog.Logger
+    onRun          func(Run)
+    historySize    int
+    statusInterval time.Duration
+
+    mu      sync.Mutex
+    random  *rand.Rand
+    history []*Run
+}
+
+type Option func(*Scheduler)
+
+// WithLogger logs every run at info level and failures at error level
+func WithLogger(logger *slog.Logger) Option {
+    return func(s *Scheduler) {
+        if logger != nil {
+            s.logger = logger
+        }
+    }
+}
+
+// WithRunHandler is called when a run starts, is skipped or errors, and
+// again when its task succeeds or fails
+func WithRunHandler(f func(Run)) Option {
+    return func(s *Scheduler) {
+        s.onRun = f
+    }
+}
+
+// WithHistorySize sets how many runs History returns, 100 by default or if n
+// is not positive
+func WithHistorySize(n int) Option {
+    return func(s *Scheduler) {
+        s.historySize = n
+    }
+}
+
+// WithStatusInterval sets how often Run refreshes the state of unfinished
+// runs, 30s by default or if d is not positive
+func WithStatusInterval(d time.Duration) Option {
+    return func(s *Scheduler) {
+        s.statusInterval = d
+    }
+}
+
+// WithClock replaces time.Now, e.g. to test schedules
+func WithClock(now func() time.Time) Option {
+    return func(s *Scheduler) {
+        s.now = now
+    }
+}
+
+// New creates a Scheduler, returning an error if any schedule is invalid.
+// *client.Client is a TaskClient.
+func New(c TaskClient, schedules []Schedule, opts ...Option) (*Scheduler, error) {
+    s := &Scheduler{
+        client:         c,
+        now:            time.Now,
+        logger:         internal.DiscardLogger(),
+        historySize:    defaultHistorySize,
+        statusInterval: defaultStatusInterval,
+        random:         rand.New(rand.NewSource(time.Now().UnixNano())),
+    }
+    for _, o := range opts {
+        o(s)
+    }
+    if s.historySize <= 0 {
+        s.historySize = defaultHistorySize
+    }
+    if s.statusInterval <= 0 {
+        s.statusInterval = defaultStatusInterval
+    }
+
+    seen := map[string]bool{}
+    for _, sched := range schedules {
+        if sched.Name == "" || sched.AppName == "" || sched.Command == "" {
+            return nil, fmt.Errorf("schedule %q needs a name, an app name and a command", sched.Name)
+        }
+        if seen[sched.Name] {
+            return nil, fmt.Errorf("more than one schedule named %s", sched.Name)
+        }
+        seen[sched.Name] = true
+
+        cron, err := ParseCron(sched.Cron)
+        if err != nil {
+            return nil, fmt.Errorf("schedule %s: %s", sched.Name, err)
+        }
+        if sched.Task.Name == "" {
+            sched.Task.Name = sched.Name
+        }
+        if sched.Location == nil {
+            sched.Location = time.UTC
+        }
+
+        s.entries = append(s.entries, &entry{Schedule: sched, cron: cron})
+    }
+
+    return s, nil
+}
+
+// Run starts tasks on their schedules and refreshes the state of unfinished
+// runs until ctx is done, which also cancels their requests. It waits for
+// runs that are starting and returns ctx.Err().
+func (s *Scheduler) Run(ctx context.Context) error {
+    var wg sync.WaitGroup
+    defer wg.Wait()
+
+    status := time.NewTicker(s.statusInterval)
+    defer status.Stop()
+
+    for _, e := range s.entries {
+        e.next = e.cron.Next(s.now().In(e.Location))
+    }
+
+    for {
+        next := s.nextEntry()
+        var timer *time.Timer
+        var fire <-chan time.Time
+        if next != nil {
+            timer = time.NewTimer(next.next.Sub(s.now()))
+            fire = timer.C
+        }
+
+        select {
+        case <-ctx.Done():
+            stopTimer(timer)
+            return ctx.Err()
+        case <-status.C:
+            stopTimer(timer)
+            err := s.RefreshContext(ctx)
+            if err != nil {
+                s.logger.Error("unable to refresh scheduled runs", slog.String("error", err.Error()))
+            }
+        case <-fire:
+            scheduledAt := next.next
+            next.next = next.cron.Next(scheduledAt)
+
+            wg.Add(1)
+            go func(e *entry) {
+                defer wg.Done()
+                s.fire(ctx, e, scheduledAt)
+            }(next)
+        }
+    }
+}
+
+func stopTimer(t *time.Timer) {
+    if t != nil {
+        t.Stop()
+    }
+}
+
+// nextEntry returns the entry that fires first, or nil if none will
+func (s *Scheduler) nextEntry() *entry {
+    var next *entry
+    for _, e := range s.entries {
+        if e.next.IsZero() {
+            continue
+        }
+        if next == nil || e.next.Before(next.next) {
+            next = e
+        }
+    }
+    return next
+}
+
+func (s *Scheduler) fire(ctx context.Context, e *entry, scheduledAt time.Time) {
+    if e.Jitter > 0 {
+        s.mu.Lock()
+        delay := time.Duration(s.random.Int63n(int64(e.Jitter)))
+        s.mu.Unlock()
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(delay):
+        }
+    }
+
+    s.start(ctx, e, scheduledAt)
+}
+
+// RunNow starts a run of the named schedule right away, without jitter
+func (s *Scheduler) RunNow(name string) (Run, error) {
+    return s.RunNowContext(context.Background(), name)
+}
+
+// RunNowContext is RunNow with a context
+func (s *Scheduler) RunNowContext(ctx context.Context, name string) (Run, error) {
+    for _, e := range s.entries {
+        if e.Name == name {
+            return s.start(ctx, e, s.now()), nil
+        }
+    }
+
+    return Run{}, fmt.Errorf("no schedule named %s", name)
+}
+
+func (s *Scheduler) start(ctx context.Context, e *entry, scheduledAt time.Time) Run {
+    run := &Run{
+        Schedule:    e.Name,
+        AppName:     e.AppName,
+        ScheduledAt: scheduledAt,
+        StartedAt:   s.now(),
+    }
+
+    s.createTask(ctx, e, run)
+    if run.Done() {
+        run.FinishedAt = run.StartedAt
+    }
+
+    s.record(run)
+    return *run
+}
+
+// createTask creates the task of the run unless the previous one is still
+// pending or running, and sets the state of the run
+func (s *Scheduler) createTask(ctx context.Context, e *entry, run *Run) {
+    e.starting.Lock()
+    defer e.starting.Unlock()
+
+    running, err := s.client.TasksContext(ctx, e.AppName, map[string]string{
+        "names":  e.Task.Name,
+        "states": "PENDING,RUNNING",
+    })
+    switch {
+    case err != nil:
+        run.State = RunErrored
+        run.Reason = "unable to list running tasks"
+        run.Err = err
+    case len(running) > 0:
+        run.State = RunSkipped
+        run.Reason = fmt.Sprintf("task %s is still %s", running[0].Guid, running[0].State)
+    default:
+        task, err := s.client.CreateTaskContext(ctx, e.AppName, e.Command, e.Task)
+        var dryRun *models.DryRunError
+        if errors.As(err, &dryRun) {
+            run.State = RunDryRun
+            run.Reason = "would send " + dryRun.Request.String()
+            break
+        }
+        if err != nil {
+            run.State = RunErrored
+            run.Reason = "unable to create the task"
+            run.Err = err
+            break
+        }
+
+        run.TaskGuid = task.Guid
+        run.State = task.State
+        if run.State == "" {
+            run.State = "PENDING"
+        }
+    }
+}
+
+// Refresh updates the state of runs whose task has not finished yet. A run
+// whose task is not listed by several refreshes in a row ends up RunLost.
+func (s *Scheduler) Refresh() error {
+    return s.RefreshContext(context.Background())
+}
+
+// RefreshContext is Refresh with a context
+func (s *Scheduler) RefreshContext(ctx context.Context) error {
+    s.mu.Lock()
+    pending := map[*entry][]*Run{}
+    for _, r := range s.history {
+        if !r.Done() {
+            e := s.entry(r.Schedule)
+            pending[e] = append(pending[e], r)
+        }
+    }
+    s.mu.Unlock()
+
+    var firstErr error
+    for e, runs := range pending {
+        tasks, err := s.client.TasksContext(ctx, e.AppName, map[string]string{"names": e.Task.Name})
+        if err != nil {
+            if firstErr == nil {
+                firstErr = err
+            }
+            continue
+        }
+
+        states := map[string]string{}
+        for _, t := range tasks {
+            states[t.Guid] = t.State
+        }
+
+        for _, r := range runs {
+            state, ok := states[r.TaskGuid]
+            if !ok {
+                s.missed(r)
+                continue
+            }
+            s.update(r, state)
+        }
+    }
+
+    return firstErr
+}
+
+// History returns the most recent runs, oldest first
+func (s *Scheduler) History() []Run {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    runs := make([]Run, 0, len(s.history))
+    for _, r := range s.history {
+        runs = append(runs, *r)
+    }
+    return runs
+}
+
+func (s *Scheduler) entry(name string) *entry {
+    for _, e := range s.entries {
+        if e.Name == name {
+            return e
+        }
+    }
+    return nil
+}
+
+// missed counts a refresh that did not list the task of the run and gives up
+// on the run after maxMissedRefreshes
+func (s *Scheduler) missed(r *Run) {
+    s.mu.Lock()
+    r.missed++
+    lost := r.missed >= maxMissedRefreshes
+    s.mu.Unlock()
+
+    if lost {
+        s.update(r, RunLost)
+    }
+}
+
+func (s *Scheduler) update(r *Run, state string) {
+    s.mu.Lock()
+    if state != RunLost {
+        r.missed = 0
+    }
+    if state == "" || state == r.State {
+        s.mu.Unlock()
+        return
+    }
+    r.State = state
+    if state == RunLost {
+        r.Reason = fmt.Sprintf("task %s was not listed by %d refreshes", r.TaskGuid, r.missed)
+    }
+    if r.Done() {
+        r.FinishedAt = s.now()
+    }
+    run := *r
+    s.mu.Unlock()
+
+    s.log(run)
+    if run.Done() && s.onRun != nil {
+        s.onRun(run)
+    }
+}
+
+func (s *Scheduler) record(r *Run) {
+    s.mu.Lock()
+    s.history = append(s.history, r)
+    if len(s.history) > s.historySize {
+        s.history = s.history[len(s.history)-s.historySize:]
+    }
+    run := *r
+    s.mu.Unlock()
+
+    s.log(run)
+    if s.onRun != nil {
+        s.onRun(run)
+    }
+}
+
+func (s *Scheduler) log(r Run) {
+    attrs := []any{
+        slog.String("schedule", r.Schedule),
+        slog.String("app", r.AppName),
+        slog.String("state", r.State),
+    }
+    if r.TaskGuid != "" {
+        attrs = append(attrs, slog.String("task_guid", r.TaskGuid))
+    }
+    if r.Reason != "" {
+        attrs = append(attrs, slog.String("reason", r.Reason))
+    }
+
+    switch {
+    case r.Err != nil:
+        s.logger.Error("scheduled task failed to start", append(attrs, slog.String("error", r.Err.Error()))...)
+    case r.State == "FAILED" || r.State == RunLost:
+        s.logger.Error("scheduled task failed", attrs...)
+    default:
+        s.logger.Info("scheduled task", attrs...)
+    }
+}
@@ -0,0 +1,13 @@
+package scheduler_test
+
+import (
+    "testing"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+func TestScheduler(t *testing.T) {
+    RegisterFailHandler(Fail)
+    RunSpecs(t, "Scheduler Suite")
+}
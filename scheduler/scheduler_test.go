@@ -0,0 +1,360 @@
+package scheduler_test
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+    "github.com/pivotal-cf/app-automator-cf-client/cftest"
+    "github.com/pivotal-cf/app-automator-cf-client/models"
+    "github.com/pivotal-cf/app-automator-cf-client/scheduler"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scheduler", func() {
+    var (
+        server  *cftest.Server
+        reports cftest.App
+        c       *client.Client
+        nightly scheduler.Schedule
+    )
+
+    BeforeEach(func() {
+        server = cftest.NewServer()
+        reports = server.AddApp(cftest.App{Name: "reports"})
+        c = client.New(server.Config())
+
+        nightly = scheduler.Schedule{
+            Name:    "nightly-report",
+            AppName: "reports",
+            Cron:    "30 2 * * *",
+            Command: "bin/report",
+            Task:    models.TaskConfig{MemoryInMB: 512},
+        }
+    })
+
+    AfterEach(func() {
+        server.Close()
+    })
+
+    It("creates a task named after the schedule", func() {
+        s, err := scheduler.New(c, []scheduler.Schedule{nightly})
+        Expect(err).ToNot(HaveOccurred())
+
+        run, err := s.RunNow("nightly-report")
+        Expect(err).ToNot(HaveOccurred())
+        Expect(run.Err).ToNot(HaveOccurred())
+        Expect(run.State).To(Equal("RUNNING"))
+
+        tasks := server.Tasks(reports.Guid)
+        Expect(tasks).To(HaveLen(1))
+        Expect(tasks[0].Guid).To(Equal(run.TaskGuid))
+        Expect(tasks[0].Name).To(Equal("nightly-report"))
+        Expect(tasks[0].Command).To(Equal("bin/report"))
+        Expect(tasks[0].MemoryInMB).To(BeEquivalentTo(512))
+    })
+
+    It("skips a run while the previous task is still running", func() {
+        s, err := scheduler.New(c, []scheduler.Schedule{nightly})
+        Expect(err).ToNot(HaveOccurred())
+
+        first, err := s.RunNow("nightly-report")
+        Expect(err).ToNot(HaveOccurred())
+
+        second, err := s.RunNow("nightly-report")
+        Expect(err).ToNot(HaveOccurred())
+        Expect(second.State).To(Equal(scheduler.RunSkipped))
+        Expect(second.Reason).To(Equal("task " + first.TaskGuid + " is still RUNNING"))
+        Expect(server.Tasks(reports.Guid)).To(HaveLen(1))
+
+        server.SetTaskState(first.TaskGuid, "SUCCEEDED")
+        third, err := s.RunNow("nightly-report")
+        Expect(err).ToNot(HaveOccurred())
+        Expect(third.State).To(Equal("RUNNING"))
+    })
+
+    It("follows the task state in the history", func() {
+        var mu sync.Mutex
+        var handled []scheduler.Run
+        s, err := scheduler.New(c, []scheduler.Schedule{nightly}, scheduler.WithRunHandler(func(r scheduler.Run) {
+            mu.Lock()
+            handled = append(handled, r)
+            mu.Unlock()
+        }))
+        Expect(err).ToNot(HaveOccurred())
+
+        run, _ := s.RunNow("nightly-report")
+        Expect(s.Refresh()).To(Succeed())
+        Expect(s.History()[0].Done()).To(BeFalse())
+
+        server.SetTaskState(run.TaskGuid, "FAILED")
+        Expect(s.Refresh()).To(Succeed())
+
+        history := s.History()
+        Expect(history).To(HaveLen(1))
+        Expect(history[0].State).To(Equal("FAILED"))
+        Expect(history[0].Succeeded()).To(BeFalse())
+        Expect(history[0].FinishedAt).ToNot(BeZero())
+        Expect(handled).To(HaveLen(2))
+    })
+
+    It("gives up on runs whose task is no longer listed", func() {
+        var handled []scheduler.Run
+        s, err := scheduler.New(&forgetfulClient{}, []scheduler.Schedule{nightly}, scheduler.WithRunHandler(func(r scheduler.Run) {
+            handled = append(handled, r)
+        }))
+        Expect(err).ToNot(HaveOccurred())
+
+        run, _ := s.RunNow("nightly-report")
+        Expect(s.Refresh()).To(Succeed())
+        Expect(s.Refresh()).To(Succeed())
+        Expect(s.History()[0].Done()).To(BeFalse())
+
+        Expect(s.Refresh()).To(Succeed())
+        history := s.History()
+        Expect(history[0].State).To(Equal(scheduler.RunLost))
+        Expect(history[0].Reason).To(Equal("task " + run.TaskGuid + " was not listed by 3 refreshes"))
+        Expect(history[0].Done()).To(BeTrue())
+        Expect(history[0].FinishedAt).ToNot(BeZero())
+        Expect(handled).To(HaveLen(2))
+    })
+
+    It("records runs whose task cannot be created", func() {
+        server.Fail(http.MethodPost, "/v3/apps/*/tasks", http.StatusUnprocessableEntity, 1)
+        s, err := scheduler.New(c, []scheduler.Schedule{nightly}, scheduler.WithHistorySize(1))
+        Expect(err).ToNot(HaveOccurred())
+
+        run, err := s.RunNow("nightly-report")
+        Expect(err).ToNot(HaveOccurred())
+        Expect(run.State).To(Equal(scheduler.RunErrored))
+        Expect(run.Err).To(HaveOccurred())
+        Expect(run.Done()).To(BeTrue())
+
+        s.RunNow("nightly-report")
+        Expect(s.History()).To(HaveLen(1))
+        Expect(s.History()[0].State).To(Equal("RUNNING"))
+    })
+
+    It("finishes dry runs without creating a task", func() {
+        cfg := server.Config()
+        cfg.DryRun = true
+        s, err := scheduler.New(client.New(cfg), []scheduler.Schedule{nightly})
+        Expect(err).ToNot(HaveOccurred())
+
+        run, err := s.RunNow("nightly-report")
+        Expect(err).ToNot(HaveOccurred())
+        Expect(run.Err).ToNot(HaveOccurred())
+        Expect(run.State).To(Equal(scheduler.RunDryRun))
+        Expect(run.Reason).To(HavePrefix("would send POST "))
+        Expect(run.Done()).To(BeTrue())
+        Expect(server.Tasks(reports.Guid)).To(BeEmpty())
+    })
+
+    It("runs schedules when their cron expression matches", func() {
+        // a second before a run is due
+        now := time.Date(2024, 5, 16, 2, 29, 59, 900000000, time.UTC)
+        nightly.Jitter = 10 * time.Millisecond
+        s, err := scheduler.New(c, []scheduler.Schedule{nightly}, scheduler.WithClock(func() time.Time { return now }))
+        Expect(err).ToNot(HaveOccurred())
+
+        ctx, cancel := context.WithCancel(context.Background())
+        done := make(chan error)
+        go func() { done <- s.Run(ctx) }()
+
+        Eventually(s.History).Should(HaveLen(1))
+        Expect(s.History()[0].ScheduledAt).To(Equal(time.Date(2024, 5, 16, 2, 30, 0, 0, time.UTC)))
+        Consistently(s.History, 200*time.Millisecond).Should(HaveLen(1))
+
+        cancel()
+        Eventually(done).Should(Receive(Equal(context.Canceled)))
+    })
+
+    It("waits for the jitter before it starts a run", func() {
+        now := time.Date(2024, 5, 16, 2, 29, 59, 900000000, time.UTC)
+        nightly.Jitter = 24 * time.Hour
+        s, err := scheduler.New(c, []scheduler.Schedule{nightly}, scheduler.WithClock(func() time.Time { return now }))
+        Expect(err).ToNot(HaveOccurred())
+
+        ctx, cancel := context.WithCancel(context.Background())
+        done := make(chan error)
+        go func() { done <- s.Run(ctx) }()
+
+        Consistently(s.History, 300*time.Millisecond).Should(BeEmpty())
+
+        cancel()
+        Eventually(done).Should(Receive(Equal(context.Canceled)))
+        Expect(s.History()).To(BeEmpty())
+        Expect(server.Tasks(reports.Guid)).To(BeEmpty())
+    })
+
+    It("cancels the requests of starting runs when it stops", func() {
+        now := time.Date(2024, 5, 16, 2, 29, 59, 900000000, time.UTC)
+        tc := &blockingClient{listing: make(chan struct{})}
+        s, err := scheduler.New(tc, []scheduler.Schedule{nightly}, scheduler.WithClock(func() time.Time { return now }))
+        Expect(err).ToNot(HaveOccurred())
+
+        ctx, cancel := context.WithCancel(context.Background())
+        done := make(chan error)
+        go func() { done <- s.Run(ctx) }()
+
+        Eventually(tc.listing).Should(BeClosed())
+        cancel()
+        Eventually(done).Should(Receive(Equal(context.Canceled)))
+
+        history := s.History()
+        Expect(history).To(HaveLen(1))
+        Expect(history[0].State).To(Equal(scheduler.RunErrored))
+        Expect(history[0].Err).To(MatchError(context.Canceled))
+    })
+
+    It("keeps the default status interval if the given one is not positive", func() {
+        s, err := scheduler.New(c, []scheduler.Schedule{nightly}, scheduler.WithStatusInterval(0))
+        Expect(err).ToNot(HaveOccurred())
+
+        ctx, cancel := context.WithCancel(context.Background())
+        done := make(chan error)
+        go func() { done <- s.Run(ctx) }()
+
+        Consistently(done, 50*time.Millisecond).ShouldNot(Receive())
+        cancel()
+        Eventually(done).Should(Receive(Equal(context.Canceled)))
+    })
+
+    It("keeps the default history size if the given one is not positive", func() {
+        s, err := scheduler.New(&failingClient{}, []scheduler.Schedule{nightly}, scheduler.WithHistorySize(-1))
+        Expect(err).ToNot(HaveOccurred())
+
+        for i := 0; i < 3; i++ {
+            s.RunNow("nightly-report")
+        }
+
+        Expect(s.History()).To(HaveLen(3))
+    })
+
+    It("creates one task for runs that start at the same time", func() {
+        tc := &slowClient{}
+        s, err := scheduler.New(tc, []scheduler.Schedule{nightly})
+        Expect(err).ToNot(HaveOccurred())
+
+        var wg sync.WaitGroup
+        for i := 0; i < 5; i++ {
+            wg.Add(1)
+            go func() {
+                defer GinkgoRecover()
+                defer wg.Done()
+                _, err := s.RunNow("nightly-report")
+                Expect(err).ToNot(HaveOccurred())
+            }()
+        }
+        wg.Wait()
+
+        Expect(tc.created()).To(Equal(1))
+        var skipped int
+        for _, r := range s.History() {
+            if r.State == scheduler.RunSkipped {
+                skipped++
+            }
+        }
+        Expect(skipped).To(Equal(4))
+    })
+
+    It("rejects invalid schedules", func() {
+        _, err := scheduler.New(c, []scheduler.Schedule{{Name: "report", AppName: "reports", Command: "bin/report", Cron: "* *"}})
+        Expect(err).To(MatchError(ContainSubstring("schedule report: invalid cron expression")))
+
+        _, err = scheduler.New(c, []scheduler.Schedule{nightly, nightly})
+        Expect(err).To(MatchError("more than one schedule named nightly-report"))
+
+        _, err = scheduler.New(c, []scheduler.Schedule{{Name: "report", Cron: "@daily"}})
+        Expect(err).To(HaveOccurred())
+    })
+
+    It("returns an error for unknown schedules", func() {
+        s, err := scheduler.New(c, nil)
+        Expect(err).ToNot(HaveOccurred())
+
+        _, err = s.RunNow("lemons")
+        Expect(err).To(MatchError("no schedule named lemons"))
+    })
+
+    It("errors the run if running tasks cannot be listed", func() {
+        s, err := scheduler.New(&failingClient{}, []scheduler.Schedule{nightly})
+        Expect(err).ToNot(HaveOccurred())
+
+        run, _ := s.RunNow("nightly-report")
+        Expect(run.State).To(Equal(scheduler.RunErrored))
+        Expect(run.Reason).To(Equal("unable to list running tasks"))
+    })
+})
+
+type failingClient struct{}
+
+func (failingClient) CreateTaskContext(ctx context.Context, appName, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
+    return models.Task{}, errors.New("expected")
+}
+
+func (failingClient) TasksContext(ctx context.Context, appName string, query map[string]string) ([]models.Task, error) {
+    return nil, errors.New("expected")
+}
+
+// forgetfulClient creates tasks but never lists them, as if they were deleted
+type forgetfulClient struct{}
+
+func (forgetfulClient) CreateTaskContext(ctx context.Context, appName, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
+    return models.Task{Guid: "task-guid", Name: cfg.Name, State: "RUNNING"}, nil
+}
+
+func (forgetfulClient) TasksContext(ctx context.Context, appName string, query map[string]string) ([]models.Task, error) {
+    return nil, nil
+}
+
+// slowClient takes a while to list tasks, so that runs starting at the same
+// time would all miss each other's task unless they are serialized
+type slowClient struct {
+    mu    sync.Mutex
+    tasks []models.Task
+}
+
+func (c *slowClient) CreateTaskContext(ctx context.Context, appName, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    task := models.Task{Guid: fmt.Sprintf("task-%d", len(c.tasks)), Name: cfg.Name, State: "RUNNING"}
+    c.tasks = append(c.tasks, task)
+    return task, nil
+}
+
+func (c *slowClient) TasksContext(ctx context.Context, appName string, query map[string]string) ([]models.Task, error) {
+    c.mu.Lock()
+    tasks := append([]models.Task(nil), c.tasks...)
+    c.mu.Unlock()
+
+    time.Sleep(20 * time.Millisecond)
+    return tasks, nil
+}
+
+func (c *slowClient) created() int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return len(c.tasks)
+}
+
+// blockingClient lists tasks until the context of the request is done
+type blockingClient struct {
+    listing chan struct{}
+}
+
+func (c *blockingClient) CreateTaskContext(ctx context.Context, appName, command string, cfg models.TaskConfig, opts ...models.HeaderOption) (models.Task, error) {
+    return models.Task{}, errors.New("unexpected")
+}
+
+func (c *blockingClient) TasksContext(ctx context.Context, appName string, query map[string]string) ([]models.Task, error) {
+    close(c.listing)
+    <-ctx.Done()
+    return nil, ctx.Err()
+}
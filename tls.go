@@ -0,0 +1,200 @@
+package client
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+// TLSOptions describes how to verify CAPI and UAA and how to present a
+// client certificate to them. Certificates and keys are either inline PEM or
+// a path to a PEM file. A client key pair given as paths is reloaded when the
+// files change.
+type TLSOptions struct {
+    CACert     string
+    ClientCert string
+    ClientKey  string
+
+    // MinVersion is one of the tls.VersionTLS* constants
+    MinVersion uint16
+
+    SkipSslValidation bool
+}
+
+// TLSConfig builds a *tls.Config from the options
+func (o TLSOptions) TLSConfig() (*tls.Config, error) {
+    cfg := &tls.Config{
+        MinVersion:         o.MinVersion,
+        InsecureSkipVerify: o.SkipSslValidation,
+    }
+
+    err := o.setRootCAs(cfg)
+    if err != nil {
+        return nil, err
+    }
+
+    err = o.setClientCertificate(cfg)
+    if err != nil {
+        return nil, err
+    }
+
+    return cfg, nil
+}
+
+func (o TLSOptions) setRootCAs(cfg *tls.Config) error {
+    if o.CACert == "" {
+        return nil
+    }
+
+    pem, err := readPem(o.CACert)
+    if err != nil {
+        return fmt.Errorf("unable to read CA cert: %s", err)
+    }
+
+    pool, err := x509.SystemCertPool()
+    if err != nil || pool == nil {
+        pool = x509.NewCertPool()
+    }
+    if !pool.AppendCertsFromPEM(pem) {
+        return fmt.Errorf("no certificates found in CA cert")
+    }
+    cfg.RootCAs = pool
+    return nil
+}
+
+func (o TLSOptions) setClientCertificate(cfg *tls.Config) error {
+    if o.ClientCert == "" && o.ClientKey == "" {
+        return nil
+    }
+
+    if isPem(o.ClientCert) || isPem(o.ClientKey) {
+        cert, err := loadKeyPair(o.ClientCert, o.ClientKey)
+        if err != nil {
+            return err
+        }
+        cfg.Certificates = []tls.Certificate{cert}
+        return nil
+    }
+
+    reloader, err := newCertReloader(o.ClientCert, o.ClientKey)
+    if err != nil {
+        return err
+    }
+    cfg.GetClientCertificate = reloader.GetClientCertificate
+    return nil
+}
+
+func loadKeyPair(cert, key string) (tls.Certificate, error) {
+    certPem, err := readPem(cert)
+    if err != nil {
+        return tls.Certificate{}, fmt.Errorf("unable to read client cert: %s", err)
+    }
+    keyPem, err := readPem(key)
+    if err != nil {
+        return tls.Certificate{}, fmt.Errorf("unable to read client key: %s", err)
+    }
+
+    pair, err := tls.X509KeyPair(certPem, keyPem)
+    if err != nil {
+        return tls.Certificate{}, fmt.Errorf("unable to load client key pair: %s", err)
+    }
+    return pair, nil
+}
+
+// certReloader presents a client key pair read from files and reloads it
+// when either file changes. Cloud Foundry rotates the instance identity
+// credentials in CF_INSTANCE_CERT and CF_INSTANCE_KEY while the app runs.
+type certReloader struct {
+    certPath string
+    keyPath  string
+
+    mu      sync.Mutex
+    cert    *tls.Certificate
+    certMod time.Time
+    keyMod  time.Time
+}
+
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+    r := &certReloader{certPath: certPath, keyPath: keyPath}
+
+    err := r.reload()
+    if err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+// GetClientCertificate reloads the key pair if the files changed since it
+// was last loaded. The previous pair is kept if the new one cannot be
+// loaded, e.g. while only the cert has been replaced so far.
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    certMod, keyMod := modTime(r.certPath), modTime(r.keyPath)
+    if !certMod.Equal(r.certMod) || !keyMod.Equal(r.keyMod) {
+        r.reload()
+    }
+
+    return r.cert, nil
+}
+
+func (r *certReloader) reload() error {
+    certMod, keyMod := modTime(r.certPath), modTime(r.keyPath)
+
+    pair, err := loadKeyPair(r.certPath, r.keyPath)
+    if err != nil {
+        return err
+    }
+
+    r.cert = &pair
+    r.certMod = certMod
+    r.keyMod = keyMod
+    return nil
+}
+
+func modTime(path string) time.Time {
+    info, err := os.Stat(path)
+    if err != nil {
+        return time.Time{}
+    }
+    return info.ModTime()
+}
+
+func isPem(value string) bool {
+    return strings.Contains(value, "-----BEGIN")
+}
+
+func readPem(value string) ([]byte, error) {
+    if value == "" {
+        return nil, fmt.Errorf("empty value")
+    }
+
+    if isPem(value) {
+        return []byte(value), nil
+    }
+
+    return ioutil.ReadFile(value)
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+    switch strings.TrimPrefix(strings.ToLower(version), "tls") {
+    case "":
+        return 0, nil
+    case "1.0":
+        return tls.VersionTLS10, nil
+    case "1.1":
+        return tls.VersionTLS11, nil
+    case "1.2":
+        return tls.VersionTLS12, nil
+    case "1.3":
+        return tls.VersionTLS13, nil
+    }
+
+    return 0, fmt.Errorf("unknown TLS version '%s'", version)
+}
@@ -0,0 +1,316 @@
+package client_test
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "io/ioutil"
+    "math/big"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/pivotal-cf/app-automator-cf-client"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+)
+
+var _ = Describe("TLSOptions", func() {
+    Describe("TLSConfig()", func() {
+        It("trusts an inline CA bundle and presents a client certificate", func() {
+            ca := newTestCert(nil)
+            serverCert := newTestCert(ca)
+            clientCert := newTestCert(ca)
+
+            server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+                Expect(req.TLS.PeerCertificates).To(HaveLen(1))
+                w.WriteHeader(http.StatusTeapot)
+            }))
+            server.TLS = &tls.Config{
+                Certificates: []tls.Certificate{serverCert.keyPair()},
+                ClientCAs:    ca.pool(),
+                ClientAuth:   tls.RequireAndVerifyClientCert,
+            }
+            server.StartTLS()
+            defer server.Close()
+
+            cfg, err := client.TLSOptions{
+                CACert:     string(ca.certPem),
+                ClientCert: string(clientCert.certPem),
+                ClientKey:  string(clientCert.keyPem),
+                MinVersion: tls.VersionTLS12,
+            }.TLSConfig()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(cfg.InsecureSkipVerify).To(BeFalse())
+            Expect(cfg.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+
+            httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+            resp, err := httpClient.Get(server.URL)
+            Expect(err).ToNot(HaveOccurred())
+            resp.Body.Close()
+            Expect(resp.StatusCode).To(Equal(http.StatusTeapot))
+        })
+
+        It("reads certificates and keys from files", func() {
+            ca := newTestCert(nil)
+            clientCert := newTestCert(ca)
+
+            dir, err := ioutil.TempDir("", "tls")
+            Expect(err).ToNot(HaveOccurred())
+            defer os.RemoveAll(dir)
+
+            caPath := writeTestFile(dir, "ca.pem", ca.certPem)
+            certPath := writeTestFile(dir, "cert.pem", clientCert.certPem)
+            keyPath := writeTestFile(dir, "key.pem", clientCert.keyPem)
+
+            cfg, err := client.TLSOptions{
+                CACert:     caPath,
+                ClientCert: certPath,
+                ClientKey:  keyPath,
+            }.TLSConfig()
+            Expect(err).ToNot(HaveOccurred())
+            Expect(cfg.RootCAs).ToNot(BeNil())
+
+            cert, err := cfg.GetClientCertificate(nil)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(cert.Certificate[0]).To(Equal(clientCert.cert.Raw))
+        })
+
+        It("reloads a client key pair read from files when the files change", func() {
+            ca := newTestCert(nil)
+            first := newTestCert(ca)
+            second := newTestCert(ca)
+
+            dir, err := ioutil.TempDir("", "tls")
+            Expect(err).ToNot(HaveOccurred())
+            defer os.RemoveAll(dir)
+
+            certPath := writeTestFile(dir, "cert.pem", first.certPem)
+            keyPath := writeTestFile(dir, "key.pem", first.keyPem)
+
+            cfg, err := client.TLSOptions{
+                ClientCert: certPath,
+                ClientKey:  keyPath,
+            }.TLSConfig()
+            Expect(err).ToNot(HaveOccurred())
+
+            By("rotating only the cert, which keeps the previous pair")
+            later := time.Now().Add(time.Minute)
+            writeTestFile(dir, "cert.pem", second.certPem)
+            Expect(os.Chtimes(certPath, later, later)).To(Succeed())
+
+            cert, err := cfg.GetClientCertificate(nil)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(cert.Certificate[0]).To(Equal(first.cert.Raw))
+
+            By("rotating the key as well")
+            writeTestFile(dir, "key.pem", second.keyPem)
+            Expect(os.Chtimes(keyPath, later, later)).To(Succeed())
+
+            cert, err = cfg.GetClientCertificate(nil)
+            Expect(err).ToNot(HaveOccurred())
+            Expect(cert.Certificate[0]).To(Equal(second.cert.Raw))
+        })
+
+        DescribeTable("errors", func(modify func(*client.TLSOptions)) {
+            ca := newTestCert(nil)
+            clientCert := newTestCert(ca)
+            opts := client.TLSOptions{
+                CACert:     string(ca.certPem),
+                ClientCert: string(clientCert.certPem),
+                ClientKey:  string(clientCert.keyPem),
+            }
+            modify(&opts)
+
+            _, err := opts.TLSConfig()
+            Expect(err).To(HaveOccurred())
+        },
+            Entry("CA file does not exist", func(o *client.TLSOptions) {
+                o.CACert = "/does/not/exist"
+            }),
+            Entry("CA has no certificates", func(o *client.TLSOptions) {
+                o.CACert = "-----BEGIN lemons-----"
+            }),
+            Entry("client key is missing", func(o *client.TLSOptions) {
+                o.ClientKey = ""
+            }),
+            Entry("client key does not match the cert", func(o *client.TLSOptions) {
+                o.ClientKey = string(newTestCert(nil).keyPem)
+            }),
+        )
+    })
+})
+
+var _ = Describe("TLS configuration from the environment", func() {
+    var (
+        dir     string
+        restore func()
+    )
+
+    BeforeEach(func() {
+        var err error
+        dir, err = ioutil.TempDir("", "tls")
+        Expect(err).ToNot(HaveOccurred())
+
+        restore = setTestEnv(map[string]string{
+            "VCAP_APPLICATION": `{"space_id": "space-guid", "cf_api": "https://api.example.com"}`,
+            "VCAP_SERVICES":    `{}`,
+        })
+    })
+
+    AfterEach(func() {
+        restore()
+        os.RemoveAll(dir)
+    })
+
+    It("presents the instance identity cert if no client cert is configured", func() {
+        ca := newTestCert(nil)
+        serverCert := newTestCert(ca)
+        instanceCert := newTestCert(ca)
+
+        server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+            Expect(req.TLS.PeerCertificates[0].Raw).To(Equal(instanceCert.cert.Raw))
+            w.WriteHeader(http.StatusTeapot)
+        }))
+        server.TLS = &tls.Config{
+            Certificates: []tls.Certificate{serverCert.keyPair()},
+            ClientCAs:    ca.pool(),
+            ClientAuth:   tls.RequireAndVerifyClientCert,
+        }
+        server.StartTLS()
+        defer server.Close()
+
+        defer setTestEnv(map[string]string{
+            "CA_CERT":          string(ca.certPem),
+            "CF_INSTANCE_CERT": writeTestFile(dir, "instance.crt", instanceCert.certPem),
+            "CF_INSTANCE_KEY":  writeTestFile(dir, "instance.key", instanceCert.keyPem),
+        })()
+
+        cfg, err := client.ConfigFromEnv()
+        Expect(err).ToNot(HaveOccurred())
+
+        httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg.TLSConfig}}
+        resp, err := httpClient.Get(server.URL)
+        Expect(err).ToNot(HaveOccurred())
+        resp.Body.Close()
+        Expect(resp.StatusCode).To(Equal(http.StatusTeapot))
+    })
+
+    DescribeTable("MIN_TLS_VERSION", func(value string, expected uint16) {
+        defer setTestEnv(map[string]string{"MIN_TLS_VERSION": value})()
+
+        cfg, err := client.ConfigFromEnv()
+        Expect(err).ToNot(HaveOccurred())
+        Expect(cfg.TLSConfig.MinVersion).To(Equal(expected))
+    },
+        Entry("unset", "", uint16(0)),
+        Entry("1.0", "1.0", uint16(tls.VersionTLS10)),
+        Entry("1.1", "1.1", uint16(tls.VersionTLS11)),
+        Entry("1.2", "1.2", uint16(tls.VersionTLS12)),
+        Entry("TLS1.3", "TLS1.3", uint16(tls.VersionTLS13)),
+        Entry("tls1.2", "tls1.2", uint16(tls.VersionTLS12)),
+    )
+
+    It("returns an error for an unknown MIN_TLS_VERSION", func() {
+        defer setTestEnv(map[string]string{"MIN_TLS_VERSION": "1.4"})()
+
+        _, err := client.ConfigFromEnv()
+        Expect(err).To(MatchError(ContainSubstring("unknown TLS version '1.4'")))
+    })
+})
+
+// setTestEnv sets the variables in the process environment and returns a
+// func that restores their previous values
+func setTestEnv(vars map[string]string) func() {
+    previous := map[string]*string{}
+    for k, v := range vars {
+        if old, ok := os.LookupEnv(k); ok {
+            previous[k] = &old
+        } else {
+            previous[k] = nil
+        }
+        os.Setenv(k, v)
+    }
+
+    return func() {
+        for k, old := range previous {
+            if old == nil {
+                os.Unsetenv(k)
+            } else {
+                os.Setenv(k, *old)
+            }
+        }
+    }
+}
+
+type testCert struct {
+    cert    *x509.Certificate
+    key     *ecdsa.PrivateKey
+    certPem []byte
+    keyPem  []byte
+}
+
+func newTestCert(ca *testCert) *testCert {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    Expect(err).ToNot(HaveOccurred())
+
+    template := &x509.Certificate{
+        SerialNumber: big.NewInt(time.Now().UnixNano()),
+        Subject:      pkix.Name{CommonName: "127.0.0.1"},
+        IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(time.Hour),
+        KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+    }
+
+    parent, signer := template, key
+    if ca == nil {
+        template.IsCA = true
+        template.BasicConstraintsValid = true
+    } else {
+        parent, signer = ca.cert, ca.key
+    }
+
+    der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+    Expect(err).ToNot(HaveOccurred())
+    cert, err := x509.ParseCertificate(der)
+    Expect(err).ToNot(HaveOccurred())
+
+    keyDer, err := x509.MarshalECPrivateKey(key)
+    Expect(err).ToNot(HaveOccurred())
+
+    return &testCert{
+        cert:    cert,
+        key:     key,
+        certPem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+        keyPem:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+    }
+}
+
+func (c *testCert) keyPair() tls.Certificate {
+    pair, err := tls.X509KeyPair(c.certPem, c.keyPem)
+    Expect(err).ToNot(HaveOccurred())
+    return pair
+}
+
+func (c *testCert) pool() *x509.CertPool {
+    pool := x509.NewCertPool()
+    pool.AddCert(c.cert)
+    return pool
+}
+
+func writeTestFile(dir, name string, contents []byte) string {
+    path := filepath.Join(dir, name)
+    Expect(ioutil.WriteFile(path, contents, 0600)).To(Succeed())
+    return path
+}